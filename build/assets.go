@@ -0,0 +1,10 @@
+// Package build holds assets of the API documentation (API console),
+// they are generated by api-console and embedded into the binary.
+package build
+
+import "embed"
+
+// FS holds the assets, index.html is at the root
+//
+//go:embed index.html api.json bower_components
+var FS embed.FS
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+)
+
+var errKeysUsage = errors.New("usage: drivers [flags] keys [-tenant TENANT] create NAME SCOPE... | rotate ID | revoke ID")
+
+// keysCommand runs "keys" subcommand with the args:
+//   - create NAME SCOPE... issues a new API key with the scopes
+//   - rotate ID replaces the secret of the key
+//   - revoke ID revokes the key
+//
+// keys are managed within -tenant, the default tenant if it is not set;
+// a plain key is printed only when it is created or rotated,
+// the first admin key is issued this way
+func keysCommand(ctx context.Context, svc service.KeysService, args []string, out io.Writer) error {
+	tenant := store.DefaultTenant
+	if len(args) > 0 && strings.HasPrefix(args[0], "-tenant=") {
+		tenant, args = strings.TrimPrefix(args[0], "-tenant="), args[1:]
+	} else if len(args) > 1 && args[0] == "-tenant" {
+		tenant, args = args[1], args[2:]
+	}
+	if !store.ValidTenant(tenant) {
+		return service.ErrInvalidTenant
+	}
+	ctx = store.WithTenant(ctx, tenant)
+
+	if len(args) < 2 {
+		return errKeysUsage
+	}
+
+	if args[0] == "create" {
+		if len(args) < 3 {
+			return errKeysUsage
+		}
+		issued, err := svc.Create(ctx, args[1], args[2:])
+		if err != nil {
+			return errors.Unwrap(err)
+		}
+		printKey(out, issued)
+		return nil
+	}
+
+	if len(args) != 2 {
+		return errKeysUsage
+	}
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid id of API key %q", args[1])
+	}
+
+	switch args[0] {
+	case "rotate":
+		issued, err := svc.Rotate(ctx, id)
+		if err != nil {
+			return errors.Unwrap(err)
+		}
+		printKey(out, issued)
+		return nil
+	case "revoke":
+		if err = svc.Revoke(ctx, id); err != nil {
+			return errors.Unwrap(err)
+		}
+		fmt.Fprintf(out, "API key %d revoked\n", id)
+		return nil
+	}
+	return errKeysUsage
+}
+
+func printKey(out io.Writer, issued *service.IssuedKey) {
+	fmt.Fprintf(out, "id:     %d\nname:   %s\nscopes: %s\ntenant: %s\n",
+		issued.ID, issued.Name, strings.Join(issued.Scopes, " "), issued.Tenant)
+	fmt.Fprintf(out, "key:    %s\n", issued.Key)
+	fmt.Fprintln(out, "the key is shown only once, keep it in a secret store")
+}
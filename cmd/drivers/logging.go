@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// leveledLogger is a logger which level can be changed at runtime
+type leveledLogger struct {
+	log.SwapLogger
+	base log.Logger
+}
+
+// newLogger constructs a logger which writes to w in the format:
+// "logfmt" or "json" and drops records below the level:
+// "debug", "info", "warn", "error" or "none",
+// records without a level are never dropped
+func newLogger(w io.Writer, format, lvl string) (*leveledLogger, error) {
+	l := &leveledLogger{}
+	switch format {
+	case "logfmt":
+		l.base = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	case "json":
+		l.base = log.NewJSONLogger(log.NewSyncWriter(w))
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	if err := l.SetLevel(lvl); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetLevel swaps the level filter, records being logged
+// concurrently are filtered either by the old or by the new level
+func (l *leveledLogger) SetLevel(lvl string) error {
+	var allow level.Option
+	switch lvl {
+	case "debug":
+		allow = level.AllowDebug()
+	case "info":
+		allow = level.AllowInfo()
+	case "warn":
+		allow = level.AllowWarn()
+	case "error":
+		allow = level.AllowError()
+	case "none":
+		allow = level.AllowNone()
+	default:
+		return fmt.Errorf("unknown log level %q", lvl)
+	}
+
+	l.Swap(level.NewFilter(l.base, allow))
+	return nil
+}
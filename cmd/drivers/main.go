@@ -6,150 +6,478 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
-	"os/signal"
 	"strings"
-	"time"
 
 	_ "github.com/lib/pq"
 
-	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/konjoot/drivers-go-kit/build"
 	"github.com/konjoot/drivers-go-kit/src/drivers"
+	"github.com/konjoot/drivers-go-kit/src/drivers/admin"
+	"github.com/konjoot/drivers-go-kit/src/drivers/auth"
+	"github.com/konjoot/drivers-go-kit/src/drivers/certs"
+	"github.com/konjoot/drivers-go-kit/src/drivers/codec"
+	"github.com/konjoot/drivers-go-kit/src/drivers/config"
 	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/health"
+	"github.com/konjoot/drivers-go-kit/src/drivers/lifecycle"
+	dbmigrations "github.com/konjoot/drivers-go-kit/src/drivers/migrations"
+	"github.com/konjoot/drivers-go-kit/src/drivers/ratelimit"
+	"github.com/konjoot/drivers-go-kit/src/drivers/redact"
+	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	migrate "github.com/rubenv/sql-migrate"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // Drivers app constructs, runs and stops here
 func main() {
 
-	// prepare default values from ENV
+	// configuration from the config file, DRIVERS_* ENV and flags
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:], os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	// DATABASE_URL used on Heroku to connect to PostgreSQL
-	defaultDbURL := os.Getenv("DATABASE_URL")
-	if defaultDbURL == "" {
-		defaultDbURL = "postgres://drivers@localhost/drivers_dev?sslmode=disable"
+	// subcommands which don't need the DB
+	var command string
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "", "migrate", "keys":
+	case "config":
+		if len(args) != 2 || args[1] != "print" {
+			fmt.Fprintln(os.Stderr, "usage: drivers [flags] config print")
+			os.Exit(2)
+		}
+		if err = cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown subcommand %q; should be migrate, keys or config\n", command)
+		os.Exit(2)
 	}
 
-	// PORT used on Heroku for HTTP-listening
-	defaultPort := os.Getenv("PORT")
-	if defaultPort == "" {
-		defaultPort = "8080"
+	// Logger initialization
+	logger, err := newLogger(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// application flags
-	httpAddr := flag.String("http.addr",
-		":"+defaultPort,
-		"HTTP listen address",
-	)
-	dbURL := flag.String("db.url",
-		defaultDbURL,
-		"DB connection URL",
-	)
-	dbPoolSize := flag.Int("db.pool_size",
-		16,
-		"Number of idle connections allowed",
-	)
-	flag.Parse()
+	// reloadable rules of DriversService
+	settings, err := service.NewAtomicSettings(serviceSettings(cfg))
+	if err != nil {
+		level.Error(logger).Log("func", "service.NewAtomicSettings", "err", err)
+		os.Exit(1)
+	}
 
-	// Logger initialization
-	logger := log.NewLogfmtLogger(os.Stderr)
+	// reloadable rate limits of clients, buckets are kept in-process
+	budgets, err := ratelimit.NewAtomicBudgets(rateLimitBudgets(cfg))
+	if err != nil {
+		level.Error(logger).Log("func", "ratelimit.NewAtomicBudgets", "err", err)
+		os.Exit(1)
+	}
+
+	// license numbers of the validation rule at start are masked in logs and errors
+	redactor, err := redact.New(cfg.Rules.LicenseNumberPattern)
+	if err != nil {
+		level.Error(logger).Log("func", "redact.New", "err", err)
+		os.Exit(1)
+	}
+
+	// Drivers app options, the config is validated already
+	encodings, _ := cfg.Encodings()
+	appOptions := []drivers.Option{
+		drivers.WithSettings(settings),
+		drivers.WithRedactor(redactor),
+		drivers.WithRateLimit(ratelimit.NewMemory(), budgets),
+		drivers.WithMaxBodyBytes(cfg.Limits.MaxBodyBytes),
+		drivers.WithMaxDecompressedBytes(cfg.Limits.MaxDecompressedBodyBytes),
+		drivers.WithCompression(encodings, cfg.Compression.MinBytes),
+		drivers.WithErrorRedaction(cfg.API.RedactErrors),
+		drivers.WithTrustedProxies(cfg.HTTP.TrustedProxies),
+		drivers.WithCORS(drivers.CORS{
+			AllowedOrigins:   config.List(cfg.CORS.AllowedOrigins),
+			AllowedMethods:   config.List(cfg.CORS.AllowedMethods),
+			AllowedHeaders:   config.List(cfg.CORS.AllowedHeaders),
+			AllowCredentials: cfg.CORS.AllowCredentials,
+			MaxAge:           cfg.CORS.MaxAge,
+		}),
+	}
+	if cfg.API.StrictDecoding {
+		appOptions = append(appOptions, drivers.WithCodecs(codec.Strict))
+	}
+	if v1Sunset, _ := cfg.V1Sunset(); !v1Sunset.IsZero() {
+		appOptions = append(appOptions, drivers.WithV1Sunset(v1Sunset))
+	}
+
+	// tracing initialization
+	tp, err := newTracerProvider(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		level.Error(logger).Log("func", "newTracerProvider", "err", err)
+		os.Exit(1)
+	}
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	appOptions = append(appOptions, drivers.WithTracerProvider(tp))
 
 	// DB connection initialization
-	db, err := sql.Open("postgres", *dbURL)
+	db, err := sql.Open("postgres", cfg.DB.URL)
 	if err != nil {
-		logger.Log("func", "sql.Open", "err", err)
+		level.Error(logger).Log("func", "sql.Open", "err", err)
 		os.Exit(1)
 	}
-	defer db.Close()
 
-	db.SetMaxOpenConns(*dbPoolSize * 3 / 2)
-	db.SetMaxIdleConns(*dbPoolSize)
+	db.SetMaxOpenConns(cfg.DB.PoolSize * 3 / 2)
+	db.SetMaxIdleConns(cfg.DB.PoolSize)
 
 	if err = db.Ping(); err != nil {
-		logger.Log("func", "db.Ping", "err", err)
+		level.Error(logger).Log("func", "db.Ping", "err", err)
 		os.Exit(1)
 	}
 
-	// apply migrations
+	// encryption of license numbers
+	var cipher store.Cipher
+	kr, err := cfg.Keyring()
+	if err != nil {
+		level.Error(logger).Log("func", "cfg.Keyring", "err", err)
+		os.Exit(1)
+	}
+	if kr != nil {
+		cipher = kr
+	}
+
 	migrate.SetTable("migrations")
-	migrations := &migrate.FileMigrationSource{
-		Dir: "./src/drivers/migrations",
+	migrations := dbmigrations.Source(cfg.DB.MigrationsDir)
+
+	// run "migrate" subcommand
+	if command == "migrate" {
+		err = migrateCommand(context.Background(), db, migrations, cipher, args[1:], os.Stdout)
+		db.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// apply migrations
+	if cfg.Migrate.OnStart {
+		var n int
+		err = dbmigrations.WithLock(context.Background(), db, func() (err error) {
+			n, err = migrate.ExecMax(db, dbmigrations.Dialect, migrations, migrate.Up, 0)
+			return err
+		})
+		if err != nil {
+			level.Error(logger).Log("func", "migrate.ExecMax", "err", err)
+			os.Exit(1)
+		}
+		if n == 1 {
+			level.Info(logger).Log("message", fmt.Sprintf("%d migration applied", n))
+		} else {
+			level.Info(logger).Log("message", fmt.Sprintf("%d migrations applied", n))
+		}
 	}
 
-	n, err := migrate.ExecMax(db, "postgres", migrations, migrate.Up, 0)
+	// plaintext license numbers are indexed before encrypted drivers
+	// are written, so uniqueness is checked between them
+	if cipher != nil {
+		n, err := store.IndexDrivers(context.Background(), db, cipher, defaultEncryptBatchSize)
+		if err != nil {
+			level.Error(logger).Log("func", "store.IndexDrivers", "err", err)
+			os.Exit(1)
+		}
+		if n == 1 {
+			level.Info(logger).Log("message", fmt.Sprintf("%d driver indexed", n))
+		} else if n > 1 {
+			level.Info(logger).Log("message", fmt.Sprintf("%d drivers indexed", n))
+		}
+	}
+
+	// API keys initialization
+	keysStore, err := store.NewAPIKeysStore(db)
 	if err != nil {
-		logger.Log("func", "migrate.ExecMax", "err", err)
+		level.Error(logger).Log("func", "store.NewAPIKeysStore", "err", err)
 		os.Exit(1)
 	}
-	if n == 1 {
-		logger.Log("message", fmt.Sprintf("%d migration applied", n))
-	} else {
-		logger.Log("message", fmt.Sprintf("%d migrations applied", n))
+
+	// run "keys" subcommand
+	if command == "keys" {
+		err = keysCommand(context.Background(), service.NewKeysService(keysStore), args[1:], os.Stdout)
+		db.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// authentication of API clients
+	schemes := auth.Schemes{}
+	if cfg.Auth.APIKeys {
+		schemes[auth.SchemeAPIKey] = auth.NewAPIKeys(keysStore)
+		appOptions = append(appOptions, drivers.WithAPIKeys(keysStore))
+	}
+	if cfg.Auth.JWKS != "" {
+		permissions, _ := cfg.JWTPermissions() // validated by config.Load
+		schemes[auth.SchemeBearer] = auth.NewJWT(
+			auth.NewJWKS(cfg.Auth.JWKS, cfg.Auth.JWKSRefresh, nil),
+			cfg.Auth.JWTIssuer,
+			cfg.Auth.JWTAudience,
+			auth.WithScopeClaim(cfg.Auth.JWTScopeClaim),
+			auth.WithTenantClaim(cfg.Auth.JWTTenantClaim),
+			auth.WithPermissions(permissions),
+			auth.WithLeeway(cfg.Auth.JWTLeeway),
+		)
+	}
+	if len(schemes) > 0 {
+		appOptions = append(appOptions, drivers.WithAuthenticator(schemes))
 	}
 
 	// DriversStore initialization
-	dStore, err := store.NewDriversStore(db)
+	var storeOptions []store.DriversStoreOption
+	if cipher != nil {
+		storeOptions = append(storeOptions, store.WithCipher(cipher))
+	}
+	dStore, err := store.NewDriversStore(db, storeOptions...)
 	if err != nil {
-		logger.Log("func", "store.NewDriversStore", "err", err)
+		level.Error(logger).Log("func", "store.NewDriversStore", "err", err)
 		os.Exit(1)
 	}
 
+	// audit events are written by DriversStore
+	var auditOptions []store.AuditStoreOption
+	if cipher != nil {
+		auditOptions = append(auditOptions, store.WithAuditCipher(cipher))
+	}
+	auditStore, err := store.NewAuditStore(db, auditOptions...)
+	if err != nil {
+		level.Error(logger).Log("func", "store.NewAuditStore", "err", err)
+		os.Exit(1)
+	}
+	appOptions = append(appOptions, drivers.WithAudit(auditStore))
+
+	// metrics initialization
+	stdprometheus.MustRegister(collectors.NewDBStatsCollector(db, "drivers"))
+
+	dStore = store.NewInstrumentingStore(dStore,
+		kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "drivers",
+			Subsystem: "store",
+			Name:      "query_duration_seconds",
+			Help:      "Latency of datastore queries.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, []string{"method", "success"}),
+		kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "drivers",
+			Subsystem: "store",
+			Name:      "batch_size",
+			Help:      "Number of drivers in imported batches.",
+			Buckets:   []float64{1, 10, 50, 100, 250, 500, 1000},
+		}, []string{}),
+	)
+
+	dStore = store.NewLoggingStore(dStore)
+	dStore = store.NewTracingStore(dStore, tp.Tracer("github.com/konjoot/drivers-go-kit/src/drivers/datastore"))
+
+	endpointLabels := []string{"endpoint", "status"}
+	appOptions = append(appOptions, drivers.WithMetrics(drivers.EndpointMetrics{
+		Requests: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "drivers",
+			Subsystem: "api",
+			Name:      "requests_total",
+			Help:      "Number of requests received.",
+		}, endpointLabels),
+		Errors: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "drivers",
+			Subsystem: "api",
+			Name:      "errors_total",
+			Help:      "Number of requests failed.",
+		}, endpointLabels),
+		Latency: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "drivers",
+			Subsystem: "api",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of requests.",
+			Buckets:   stdprometheus.DefBuckets,
+		}, endpointLabels),
+	}))
+
+	// health checks initialization
+	checks := health.New(health.DefaultTimeout)
+	checks.Register("db", health.Ping(db))
+	checks.Register("migrations", health.Migrations(db, dbmigrations.Dialect, migrations))
+	checks.Register("db_pool", health.PoolSaturation(db, 0.9))
+
+	// in-flight imports are drained on shutdown
+	drainingStore := store.NewDrainingStore(dStore)
+	dStore = drainingStore
+
+	// API documentation assets
+	assets := http.FileSystem(http.FS(build.FS))
+	if cfg.HTTP.AssetsDir != "" {
+		assets = http.Dir(cfg.HTTP.AssetsDir)
+	}
+
 	// HTTP-handler initialization
 	handler := &server{
-		assets: http.FileServer(http.Dir("./build")),
-		api:    drivers.New(logger, dStore),
+		assets:  http.FileServer(assets),
+		api:     drivers.New(logger, dStore, appOptions...),
+		healthz: checks.LivenessHandler(),
+		readyz:  checks.ReadinessHandler(),
 	}
 
 	// HTTP-server initialization
 	srv := &http.Server{
-		Addr:    *httpAddr,
-		Handler: handler,
+		Addr:              cfg.HTTP.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Limits.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Limits.ReadTimeout,
+		WriteTimeout:      cfg.Limits.WriteTimeout,
+		IdleTimeout:       cfg.Limits.IdleTimeout,
+		MaxHeaderBytes:    cfg.Limits.MaxHeaderBytes,
+	}
+
+	// HTTP/2 is negotiated by TLS, internal clients may
+	// speak it without TLS (h2c with prior knowledge) if http.h2c is set
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(true)
+	srv.Protocols.SetUnencryptedHTTP2(cfg.HTTP.H2C)
+
+	// TLS initialization, mutual TLS if client CAs are set
+	var certReloader *certs.Reloader
+	if cfg.TLS.Cert != "" {
+		certReloader, err = certs.NewReloader(cfg.TLS.Cert, cfg.TLS.Key)
+		if err != nil {
+			level.Error(logger).Log("func", "certs.NewReloader", "err", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig, err = certs.ServerConfig(certReloader, cfg.TLS.ClientCA)
+		if err != nil {
+			level.Error(logger).Log("func", "certs.ServerConfig", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// reloadable settings and the current config
+	reload := &reloader{
+		cfg: cfg,
+		load: func() (config.Config, error) {
+			next, _, err := config.Load(os.Args[0], os.Args[1:], os.Getenv, io.Discard)
+			return next, err
+		},
+		logger:   logger,
+		settings: settings,
+		budgets:  budgets,
+	}
+
+	// admin HTTP-server initialization, diagnostics are not exposed
+	// on the public listener
+	adminSrv := &http.Server{
+		Addr:              cfg.Admin.Addr,
+		Handler:           admin.NewHandler(promhttp.Handler(), db, reload.printConfig),
+		ReadHeaderTimeout: cfg.Limits.ReadHeaderTimeout,
 	}
 
 	// run the world
-	errs := make(chan error, 1)
+	errs := make(chan error, 2)
 	go func() {
-		logger.Log("message", "HTTP-server is listening on "+(*httpAddr))
+		if srv.TLSConfig != nil {
+			level.Info(logger).Log("message", "HTTPS-server is listening on "+cfg.HTTP.Addr)
+			errs <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		level.Info(logger).Log("message", "HTTP-server is listening on "+cfg.HTTP.Addr)
 		errs <- srv.ListenAndServe()
 	}()
-
-	// listen os.Interrupt signal
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
-
-	// stop the app if
-	var exitCode int
-	select {
-	case <-stop:
-		// os.Interrupt signal appeared
-	case err = <-errs:
-		// HTTP-server accedentally stops
-		logger.Log("func", "srv.ListenAndServe", "err", err)
-		exitCode = 1
+	if cfg.Admin.Addr != "" {
+		go func() {
+			level.Info(logger).Log("message", "admin HTTP-server is listening on "+cfg.Admin.Addr)
+			errs <- adminSrv.ListenAndServe()
+		}()
 	}
 
-	// shutting app down
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err = srv.Shutdown(ctx); err != nil {
-		logger.Log("func", "srv.Shutdown", "err", err)
+	// reload settings on SIGHUP or changes of the config file
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	go reload.run(reloadCtx, cfg.Reload.WatchInterval)
+	if certReloader != nil && cfg.TLS.WatchInterval > 0 {
+		go certReloader.Watch(reloadCtx, cfg.TLS.WatchInterval, logger)
 	}
 
-	logger.Log("message", "service is gracefully stopped")
+	// shutdown stages, they run in order within the grace period
+	var failure error
+	lc := lifecycle.New(logger, cfg.Shutdown.GracePeriod)
+	lc.OnShutdown("reload", func(context.Context) error {
+		stopReload()
+		return nil
+	})
+	lc.OnShutdown("readiness", func(ctx context.Context) error {
+		// let load balancers notice that the app is not ready,
+		// unless one of HTTP-servers is already stopped
+		checks.Shutdown()
+		if failure != nil {
+			return nil
+		}
+		return lifecycle.Sleep(cfg.Health.DrainDelay)(ctx)
+	})
+	lc.OnShutdown("imports", drainingStore.Drain)
+	lc.OnShutdown("http", srv.Shutdown)
+	lc.OnShutdown("admin", adminSrv.Shutdown)
+	lc.OnShutdown("tracing", tp.Shutdown)
+	lc.OnShutdown("db", func(context.Context) error {
+		return db.Close()
+	})
 
-	os.Exit(exitCode)
+	// stop the app on SIGTERM, SIGINT or if
+	// one of HTTP-servers accedentally stops
+	failure = lc.Wait(errs)
+	if err = lc.Shutdown(); err != nil {
+		level.Error(logger).Log("message", "service is stopped with errors")
+		os.Exit(1)
+	}
+	level.Info(logger).Log("message", "service is gracefully stopped")
+
+	if failure != nil {
+		os.Exit(1)
+	}
 }
 
 // server is a decorator for http.Handler
-// it provides capabilities to serve API and
-// static files for API documentation
+// it provides capabilities to serve API,
+// health probes and static files for API documentation
 type server struct {
-	assets http.Handler
-	api    http.Handler
+	assets  http.Handler
+	api     http.Handler
+	healthz http.Handler
+	readyz  http.Handler
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		s.healthz.ServeHTTP(w, r)
+		return
+	case "/readyz":
+		s.readyz.ServeHTTP(w, r)
+		return
+	}
+
 	if strings.HasPrefix(r.URL.Path, "/api/") {
 		s.api.ServeHTTP(w, r)
 		return
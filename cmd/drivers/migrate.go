@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/migrations"
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+var errMigrateUsage = errors.New("usage: drivers [flags] migrate up [n] | down [n] | status | redo | encrypt [batch size]")
+
+// defaultEncryptBatchSize is a number of drivers or audit events encrypted in a transaction
+const defaultEncryptBatchSize = 1000
+
+// migrateCommand runs "migrate" subcommand with the args:
+//   - up [n] applies n (all by default) pending migrations and indexes
+//     plaintext license numbers of drivers if cipher is set
+//   - down [n] rolls back n (1 by default) applied migrations
+//   - status prints all migrations with the time they were applied
+//   - redo rolls back the last applied migration and applies it again
+//   - encrypt encrypts plaintext license numbers of drivers and their audit
+//     events by cipher and reencrypts ones of previous keys, batches of n
+//     (1000 by default) rows are encrypted in transactions
+//
+// up, down and redo hold Postgres advisory lock
+func migrateCommand(ctx context.Context, db *sql.DB, source migrate.MigrationSource, cipher store.Cipher, args []string, out io.Writer) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errMigrateUsage
+	}
+
+	n := 0
+	if args[0] == "down" {
+		n = 1
+	}
+	if args[0] == "encrypt" {
+		n = defaultEncryptBatchSize
+	}
+	if len(args) == 2 {
+		if args[0] != "up" && args[0] != "down" && args[0] != "encrypt" {
+			return errMigrateUsage
+		}
+		var err error
+		// ExecMax treats 0 as no limit, so "down 0" would roll back everything
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			return fmt.Errorf("invalid number %q, it should be greater than 0; %w", args[1], errMigrateUsage)
+		}
+	}
+
+	switch args[0] {
+	case "up":
+		err := migrations.WithLock(ctx, db, func() error {
+			return execMigrations(db, source, migrate.Up, n, out)
+		})
+		if err != nil || cipher == nil {
+			return err
+		}
+		indexed, err := store.IndexDrivers(ctx, db, cipher, defaultEncryptBatchSize)
+		if indexed == 1 {
+			fmt.Fprintf(out, "%d driver indexed\n", indexed)
+		} else {
+			fmt.Fprintf(out, "%d drivers indexed\n", indexed)
+		}
+		return err
+	case "down":
+		return migrations.WithLock(ctx, db, func() error {
+			return execMigrations(db, source, migrate.Down, n, out)
+		})
+	case "redo":
+		return migrations.WithLock(ctx, db, func() error {
+			if err := execMigrations(db, source, migrate.Down, 1, out); err != nil {
+				return err
+			}
+			return execMigrations(db, source, migrate.Up, 1, out)
+		})
+	case "status":
+		return migrationsStatus(db, source, out)
+	case "encrypt":
+		if cipher == nil {
+			return errors.New("migrate encrypt requires crypto.keys or crypto.keys_file")
+		}
+		changed, err := store.EncryptDrivers(ctx, db, cipher, n)
+		if changed == 1 {
+			fmt.Fprintf(out, "%d driver encrypted\n", changed)
+		} else {
+			fmt.Fprintf(out, "%d drivers encrypted\n", changed)
+		}
+		if err != nil {
+			return err
+		}
+		changed, err = store.EncryptAuditEvents(ctx, db, cipher, n)
+		if changed == 1 {
+			fmt.Fprintf(out, "%d audit event encrypted\n", changed)
+		} else {
+			fmt.Fprintf(out, "%d audit events encrypted\n", changed)
+		}
+		return err
+	}
+	return errMigrateUsage
+}
+
+func execMigrations(db *sql.DB, source migrate.MigrationSource, dir migrate.MigrationDirection, max int, out io.Writer) error {
+	n, err := migrate.ExecMax(db, migrations.Dialect, source, dir, max)
+	if err != nil {
+		return err
+	}
+
+	verb := "applied"
+	if dir == migrate.Down {
+		verb = "rolled back"
+	}
+	if n == 1 {
+		fmt.Fprintf(out, "%d migration %s\n", n, verb)
+	} else {
+		fmt.Fprintf(out, "%d migrations %s\n", n, verb)
+	}
+	return nil
+}
+
+func migrationsStatus(db *sql.DB, source migrate.MigrationSource, out io.Writer) error {
+	found, err := source.FindMigrations()
+	if err != nil {
+		return err
+	}
+	records, err := migrate.GetMigrationRecords(db, migrations.Dialect)
+	if err != nil {
+		return err
+	}
+
+	appliedAt := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		appliedAt[record.Id] = record.AppliedAt
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tAPPLIED AT")
+	for _, m := range found {
+		at, ok := appliedAt[m.Id]
+		if !ok {
+			fmt.Fprintf(w, "%s\tpending\n", m.Id)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", m.Id, at.UTC().Format(time.RFC3339))
+		delete(appliedAt, m.Id)
+	}
+	for id := range appliedAt {
+		fmt.Fprintf(w, "%s\tapplied, but missing in the source\n", id)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMigrateCommandUsage(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+	}{
+		{name: "NoArgs"},
+		{name: "Unknown", args: []string{"sideways"}},
+		{name: "TooManyArgs", args: []string{"up", "1", "2"}},
+		{name: "StatusWithNumber", args: []string{"status", "1"}},
+		{name: "NotNumber", args: []string{"up", "all"}},
+		{name: "UpZero", args: []string{"up", "0"}},
+		{name: "DownZero", args: []string{"down", "0"}},
+		{name: "DownNegative", args: []string{"down", "-1"}},
+		{name: "EncryptZero", args: []string{"encrypt", "0"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// no database is touched, it would panic on nil *sql.DB
+			var out bytes.Buffer
+			err := migrateCommand(context.Background(), nil, nil, nil, tc.args, &out)
+			t.Log("err =>", err)
+			if !errors.Is(err, errMigrateUsage) {
+				t.Error("Expected =>", errMigrateUsage)
+			}
+			t.Log("out =>", out.String())
+			if out.Len() != 0 {
+				t.Error("Expected no output")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/konjoot/drivers-go-kit/src/drivers/config"
+	"github.com/konjoot/drivers-go-kit/src/drivers/ratelimit"
+	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+)
+
+// reloader applies reloadable settings of the config: the log level,
+// import limits, validation rules and rate limits, on SIGHUP or when the config
+// file is modified, other changed settings are logged as ignored
+type reloader struct {
+	mu       sync.Mutex
+	cfg      config.Config
+	load     func() (config.Config, error)
+	logger   *leveledLogger
+	settings *service.AtomicSettings
+	budgets  *ratelimit.AtomicBudgets
+}
+
+// printConfig writes the current config with redacted secrets
+func (r *reloader) printConfig(w io.Writer) error {
+	r.mu.Lock()
+	cfg := r.cfg
+	r.mu.Unlock()
+
+	return cfg.Print(w)
+}
+
+// serviceSettings returns rules of DriversService from the config
+func serviceSettings(cfg config.Config) service.Settings {
+	return service.Settings{
+		MaxImportSize:        cfg.Import.MaxBatchSize,
+		MinNameLength:        cfg.Rules.NameMinLength,
+		MaxNameLength:        cfg.Rules.NameMaxLength,
+		LicenseNumberPattern: cfg.Rules.LicenseNumberPattern,
+	}
+}
+
+// rateLimitBudgets returns rate limits of clients from the config
+func rateLimitBudgets(cfg config.Config) ratelimit.Budgets {
+	return ratelimit.Budgets{
+		Read:   ratelimit.Limit{Rate: cfg.RateLimit.ReadRate, Burst: cfg.RateLimit.ReadBurst},
+		Import: ratelimit.Limit{Rate: cfg.RateLimit.ImportRate, Burst: cfg.RateLimit.ImportBurst},
+		IP:     ratelimit.Limit{Rate: cfg.RateLimit.IPRate, Burst: cfg.RateLimit.IPBurst},
+	}
+}
+
+// run reloads the config until ctx is done, the config file
+// is checked for modifications every interval, if it is positive
+func (r *reloader) run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 && r.cfg.File != "" {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	modTime := r.modTime()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			// the file is read by the reload, so it isn't reloaded again by the tick
+			modTime = r.modTime()
+			level.Info(r.logger).Log("message", "reloading config", "signal", syscall.SIGHUP)
+			r.reload()
+		case <-tick:
+			mt := r.modTime()
+			if mt.Equal(modTime) {
+				continue
+			}
+			modTime = mt
+			level.Info(r.logger).Log("message", "reloading config", "file", r.cfg.File)
+			r.reload()
+		}
+	}
+}
+
+// modTime returns the time the config file was modified,
+// it is zero if the file is missing or not set
+func (r *reloader) modTime() time.Time {
+	if r.cfg.File == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(r.cfg.File)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reload loads the config and applies it, current settings
+// are kept if the config or one of the settings is invalid
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		level.Error(r.logger).Log("message", "config is not reloaded", "err", err)
+		return
+	}
+
+	reloadable, static := r.cfg.Changes(next)
+	if len(static) > 0 {
+		level.Warn(r.logger).Log("message", "changed settings require a restart, they are ignored",
+			"settings", strings.Join(static, ","))
+	}
+	if len(reloadable) == 0 {
+		level.Info(r.logger).Log("message", "no reloadable settings changed")
+		return
+	}
+
+	if err = r.settings.Store(serviceSettings(next)); err != nil {
+		level.Error(r.logger).Log("message", "config is not reloaded", "err", err)
+		return
+	}
+	if err = r.budgets.Store(rateLimitBudgets(next)); err != nil {
+		level.Error(r.logger).Log("message", "rate limits are not reloaded", "err", err)
+		next.RateLimit = r.cfg.RateLimit
+	}
+	if err = r.logger.SetLevel(next.Log.Level); err != nil {
+		level.Error(r.logger).Log("message", "log level is not reloaded", "err", err)
+		next.Log.Level = r.cfg.Log.Level
+	}
+
+	r.cfg.Log.Level = next.Log.Level
+	r.cfg.Import = next.Import
+	r.cfg.Rules = next.Rules
+	r.cfg.RateLimit = next.RateLimit
+	level.Info(r.logger).Log("message", "config is reloaded", "settings", strings.Join(reloadable, ","))
+}
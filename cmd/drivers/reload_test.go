@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/config"
+)
+
+func TestReloaderSignalAfterModification(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "drivers.yaml")
+	if err := os.WriteFile(file, []byte("log:\n  level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	logger, err := newLogger(io.Discard, "logfmt", "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var loads int32
+	r := &reloader{
+		cfg: config.Config{File: file},
+		load: func() (config.Config, error) {
+			atomic.AddInt32(&loads, 1)
+			return config.Config{}, errors.New("not reloaded")
+		},
+		logger: logger,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.run(ctx, 200*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// the file is modified and reloaded by the signal before the tick
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+	<-done
+
+	t.Log("loads =>", atomic.LoadInt32(&loads))
+	if atomic.LoadInt32(&loads) != 1 {
+		t.Error("Expected =>", 1)
+	}
+}
@@ -0,0 +1,117 @@
+// Package admin serves diagnostics of the Drivers app: metrics, pprof,
+// build info, DB pool stats and the current config. They are served by
+// a separate listener, which should not be reachable from the public.
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/health"
+)
+
+// ConfigPrinter writes the current config, secrets should be redacted
+type ConfigPrinter func(w io.Writer) error
+
+// NewHandler returns a handler of the admin listener, it serves:
+//   - /metrics by the metrics handler
+//   - /debug/pprof/ profiles of net/http/pprof
+//   - /buildinfo version, commit and Go version of the binary
+//   - /dbstats statistics of the DB connection pool
+//   - /config the current config
+func NewHandler(metrics http.Handler, db health.Statser, config ConfigPrinter) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.HandleFunc("/buildinfo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, readBuildInfo())
+	})
+	mux.HandleFunc("/dbstats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, newDBStats(db))
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := config(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		buf.WriteTo(w)
+	})
+
+	return mux
+}
+
+// BuildInfo describes the binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	CommitAt  string `json:"commit_at,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo returns info embedded into the binary by the Go toolchain,
+// the commit is known when the binary is built from a VCS checkout
+func readBuildInfo() BuildInfo {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return BuildInfo{Version: "unknown"}
+	}
+
+	info := BuildInfo{Version: bi.Main.Version, GoVersion: bi.GoVersion}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			info.CommitAt = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// DBStats are statistics of the DB connection pool
+type DBStats struct {
+	MaxOpenConnections int    `json:"max_open_connections"`
+	OpenConnections    int    `json:"open_connections"`
+	InUse              int    `json:"in_use"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"wait_count"`
+	WaitDuration       string `json:"wait_duration"`
+	MaxIdleClosed      int64  `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64  `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64  `json:"max_lifetime_closed"`
+}
+
+func newDBStats(db health.Statser) DBStats {
+	stats := db.Stats()
+	return DBStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       stats.WaitDuration.String(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
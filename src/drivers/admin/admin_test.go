@@ -0,0 +1,139 @@
+package admin_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/admin"
+)
+
+func TestHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		path           string
+		configErr      error
+		expCode        int
+		expContentType string
+		expBody        []string
+	}{
+		{
+			name:           "Metrics",
+			path:           "/metrics",
+			expCode:        http.StatusOK,
+			expContentType: "text/plain; charset=utf-8",
+			expBody:        []string{"drivers_api_requests_total 1"},
+		},
+		{
+			name:           "Pprof",
+			path:           "/debug/pprof/",
+			expCode:        http.StatusOK,
+			expContentType: "text/html; charset=utf-8",
+			expBody:        []string{"goroutine"},
+		},
+		{
+			name:           "PprofProfile",
+			path:           "/debug/pprof/goroutine?debug=1",
+			expCode:        http.StatusOK,
+			expContentType: "text/plain; charset=utf-8",
+			expBody:        []string{"goroutine profile:"},
+		},
+		{
+			name:           "BuildInfo",
+			path:           "/buildinfo",
+			expCode:        http.StatusOK,
+			expContentType: "application/json; charset=utf-8",
+			expBody:        []string{`"version":`, `"go_version":"go`},
+		},
+		{
+			name:           "DBStats",
+			path:           "/dbstats",
+			expCode:        http.StatusOK,
+			expContentType: "application/json; charset=utf-8",
+			expBody: []string{
+				`"max_open_connections":24`,
+				`"open_connections":3`,
+				`"in_use":2`,
+				`"idle":1`,
+				`"wait_count":5`,
+				`"wait_duration":"1.5s"`,
+			},
+		},
+		{
+			name:           "Config",
+			path:           "/config",
+			expCode:        http.StatusOK,
+			expContentType: "application/yaml",
+			expBody:        []string{"log:\n  level: info\n"},
+		},
+		{
+			name:           "ConfigError",
+			path:           "/config",
+			configErr:      errors.New("no config"),
+			expCode:        http.StatusInternalServerError,
+			expContentType: "text/plain; charset=utf-8",
+			expBody:        []string{"no config"},
+		},
+		{
+			name:           "NotFound",
+			path:           "/api/drivers",
+			expCode:        http.StatusNotFound,
+			expContentType: "text/plain; charset=utf-8",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				fmt.Fprintln(w, "drivers_api_requests_total 1")
+			})
+			config := func(w io.Writer) error {
+				if tc.configErr != nil {
+					return tc.configErr
+				}
+				_, err := io.WriteString(w, "log:\n  level: info\n")
+				return err
+			}
+			handler := admin.NewHandler(metrics, statser{}, config)
+
+			request := httptest.NewRequest("GET", tc.path, nil)
+			response := httptest.NewRecorder()
+
+			handler.ServeHTTP(response, request)
+
+			t.Log("response.Code =>", response.Code)
+			if response.Code != tc.expCode {
+				t.Error("Expected =>", tc.expCode)
+			}
+			contentType := response.Header().Get("Content-Type")
+			t.Log("Content-Type =>", contentType)
+			if contentType != tc.expContentType {
+				t.Error("Expected =>", tc.expContentType)
+			}
+			t.Log("response.Body =>", response.Body.String())
+			for _, exp := range tc.expBody {
+				if !strings.Contains(response.Body.String(), exp) {
+					t.Error("Expected =>", exp)
+				}
+			}
+		})
+	}
+}
+
+type statser struct{}
+
+func (statser) Stats() sql.DBStats {
+	return sql.DBStats{
+		MaxOpenConnections: 24,
+		OpenConnections:    3,
+		InUse:              2,
+		Idle:               1,
+		WaitCount:          5,
+		WaitDuration:       1500 * time.Millisecond,
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+// APIKeyPrefix marks API keys, so leaked ones are easy to find
+const APIKeyPrefix = "drv_"
+
+// NewAPIKey generates a random API key, only its hash should be stored
+func NewAPIKey() (key string, hash []byte, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns a hash of the key, keys are random
+// and long enough, so a fast hash is safe
+func HashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// APIKeyFinder finds API keys which are not revoked by hash,
+// like datastore.APIKeysStore
+type APIKeyFinder interface {
+	GetAPIKeyByHash(ctx context.Context, hash []byte) (*store.APIKey, error)
+}
+
+// APIKeys is an Authenticator of API keys
+type APIKeys struct {
+	keys APIKeyFinder
+}
+
+// NewAPIKeys is a constructor of APIKeys
+func NewAPIKeys(keys APIKeyFinder) *APIKeys {
+	return &APIKeys{keys: keys}
+}
+
+// Challenge implements Challenger
+func (a *APIKeys) Challenge() string {
+	return SchemeAPIKey + ` realm="` + Realm + `"`
+}
+
+// Authenticate implements Authenticator, the subject of a key is "apikey:<id>",
+// the principal is bound to the tenant of the key
+func (a *APIKeys) Authenticate(ctx context.Context, c Credentials) (Principal, error) {
+	if c.Token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	key, err := a.keys.GetAPIKeyByHash(ctx, HashAPIKey(c.Token))
+	if err == sql.ErrNoRows {
+		return Principal{}, fmt.Errorf("%w; API key is unknown or revoked", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+
+	return Principal{
+		Subject: fmt.Sprintf("apikey:%d", key.ID),
+		Scopes:  key.Scopes,
+		Tenant:  key.Tenant,
+	}, nil
+}
@@ -0,0 +1,190 @@
+// Package auth authenticates clients of the Drivers app and carries
+// their identity in context. Transports put credentials into context,
+// endpoints authenticate them and check scopes, so authentication
+// works the same way for every transport.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// Scopes of permissions
+const (
+	// ScopeRead permits reading drivers
+	ScopeRead = "drivers:read"
+	// ScopeImport permits importing and updating drivers
+	ScopeImport = "drivers:import"
+	// ScopeAdmin permits everything within the tenant of the client,
+	// including management of API keys
+	ScopeAdmin = "drivers:admin"
+	// ScopeTenants permits choosing a tenant by X-Tenant-ID header,
+	// it is never implied by ScopeAdmin
+	ScopeTenants = "drivers:tenants"
+)
+
+// Scopes are all known scopes
+var Scopes = []string{ScopeRead, ScopeImport, ScopeAdmin, ScopeTenants}
+
+// ValidScope reports whether the scope is known
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Schemes of credentials
+const (
+	SchemeAPIKey = "ApiKey"
+	SchemeBearer = "Bearer"
+)
+
+// APIKeyHeader is a header with an API key,
+// "Authorization: ApiKey <key>" is accepted as well
+const APIKeyHeader = "X-API-Key"
+
+// Plain errors
+var (
+	ErrNoCredentials      = errors.New("unauthenticated; credentials are missing")
+	ErrInvalidCredentials = errors.New("unauthenticated; credentials are invalid")
+)
+
+// Unauthenticated reports whether err is caused by missing or invalid credentials
+func Unauthenticated(err error) bool {
+	return errors.Is(err, ErrNoCredentials) || errors.Is(err, ErrInvalidCredentials)
+}
+
+// Credentials are presented by a client
+type Credentials struct {
+	Scheme string
+	Token  string
+}
+
+// Principal is an authenticated client
+type Principal struct {
+	// Subject identifies the client, e.g. "apikey:42"
+	Subject string
+	Scopes  []string
+	// Tenant binds the client to drivers of the tenant, the default
+	// one if it is empty; only clients with ScopeTenants choose another
+	Tenant string
+	// Claims of a token, they are nil for API keys
+	Claims map[string]interface{}
+}
+
+// Allows reports whether the principal has the scope,
+// ScopeAdmin allows everything but ScopeTenants
+func (p Principal) Allows(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin && scope != ScopeTenants {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies credentials, errors caused by the credentials
+// wrap ErrNoCredentials or ErrInvalidCredentials
+type Authenticator interface {
+	Authenticate(context.Context, Credentials) (Principal, error)
+}
+
+// Schemes is an Authenticator which delegates
+// to an Authenticator of the scheme of credentials
+type Schemes map[string]Authenticator
+
+// Authenticate implements Authenticator
+func (s Schemes) Authenticate(ctx context.Context, c Credentials) (Principal, error) {
+	if c.Token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	a, ok := s[c.Scheme]
+	if !ok {
+		return Principal{}, fmt.Errorf("%w; unsupported scheme %q", ErrInvalidCredentials, c.Scheme)
+	}
+	return a.Authenticate(ctx, c)
+}
+
+// Challenger is an Authenticator which tells clients
+// how to authenticate in WWW-Authenticate header
+type Challenger interface {
+	Challenge() string
+}
+
+// Challenge implements Challenger, challenges of the schemes are joined
+func (s Schemes) Challenge() string {
+	var challenges []string
+	for _, a := range s {
+		if c, ok := a.(Challenger); ok {
+			challenges = append(challenges, c.Challenge())
+		}
+	}
+	sort.Strings(challenges)
+	return strings.Join(challenges, ", ")
+}
+
+// Realm is a realm of challenges
+const Realm = "drivers"
+
+// ctxKey type is needed to avoid
+// key collisions in context
+type ctxKey int
+
+const (
+	credentialsKey ctxKey = iota
+	principalKey
+)
+
+// HTTPToContext returns a request function which stores credentials
+// of Authorization or X-API-Key header into context
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			return WithCredentials(ctx, Credentials{Scheme: SchemeAPIKey, Token: key})
+		}
+
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok {
+			return ctx
+		}
+		// schemes are case-insensitive (RFC 7235)
+		for _, known := range []string{SchemeAPIKey, SchemeBearer} {
+			if strings.EqualFold(scheme, known) {
+				scheme = known
+			}
+		}
+		return WithCredentials(ctx, Credentials{Scheme: scheme, Token: strings.TrimSpace(token)})
+	}
+}
+
+// WithCredentials returns a copy of ctx which carries the credentials
+func WithCredentials(ctx context.Context, c Credentials) context.Context {
+	return context.WithValue(ctx, credentialsKey, c)
+}
+
+// CredentialsFromContext returns the credentials stored in ctx
+func CredentialsFromContext(ctx context.Context) Credentials {
+	c, _ := ctx.Value(credentialsKey).(Credentials)
+	return c
+}
+
+// NewContext returns a copy of ctx which carries the principal
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// FromContext returns the principal stored in ctx,
+// ok is false if the client is not authenticated
+func FromContext(ctx context.Context) (p Principal, ok bool) {
+	p, ok = ctx.Value(principalKey).(Principal)
+	return p, ok
+}
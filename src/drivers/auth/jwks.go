@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultJWKSRefresh is an interval of refreshes of a JWKS document
+const DefaultJWKSRefresh = time.Hour
+
+// jwksMinRefresh limits refreshes caused by unknown key ids and retries
+// of failed ones, so forged tokens can't flood the source of keys
+const jwksMinRefresh = 30 * time.Second
+
+// maxJWKSSize limits a JWKS document
+const maxJWKSSize = 1 << 20
+
+// JWKS is a cached set of public keys (RFC 7517) loaded from a file or URL,
+// the set is refreshed when it gets older than the refresh interval
+// or when a token is signed by an unknown key (the signer has rotated keys);
+// the set is fetched without holding the lock by a single caller at a time
+type JWKS struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+	group   singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	attempted time.Time
+}
+
+// NewJWKS is a constructor of JWKS, the source is
+// an http(s) URL or a path of a file, the client fetches URLs
+func NewJWKS(source string, refresh time.Duration, client *http.Client) *JWKS {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKS{source: source, refresh: refresh, client: client}
+}
+
+// Key returns a public key by id, it is an error wrapping
+// ErrInvalidCredentials if the key is unknown, the cached keys
+// are used if they can't be refreshed
+func (s *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	now := time.Now()
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	loaded := s.keys != nil
+	due := !loaded || (!ok || now.Sub(s.fetched) >= s.refresh) && now.Sub(s.attempted) >= min(s.refresh, jwksMinRefresh)
+	if due {
+		s.attempted = now
+	}
+	s.mu.Unlock()
+
+	if due {
+		keys, err := s.load(ctx)
+		if err != nil && !loaded {
+			return nil, err
+		}
+		if err == nil {
+			key, ok = keys[kid]
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w; signing key %q is unknown", ErrInvalidCredentials, kid)
+	}
+	return key, nil
+}
+
+// load fetches the keys and caches them, concurrent callers share
+// a single fetch, which isn't canceled when one of them gives up
+func (s *JWKS) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	ch := s.group.DoChan("", func() (interface{}, error) {
+		keys, err := s.fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.keys, s.fetched = keys, time.Now()
+		s.mu.Unlock()
+		return keys, nil
+	})
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(map[string]crypto.PublicKey), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch loads and parses the document, keys of unsupported
+// types and keys for encryption are skipped
+func (s *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("jwks %s: %v", s.source, err)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("jwks %s: %v", s.source, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks %s: key %q: %v", s.source, k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (s *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "https://") && !strings.HasPrefix(s.source, "http://") {
+		return os.ReadFile(s.source)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/jwk-set+json, application/json")
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, maxJWKSSize))
+}
+
+// jwk is a public key of JWKS
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key, it is nil if the type is not supported
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer %q", s)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+// DefaultScopeClaim is a claim of a token with permissions of the subject
+const DefaultScopeClaim = "scope"
+
+// signingMethods are algorithms of accepted tokens, symmetric
+// ones are not accepted, because keys of JWKS are public
+var signingMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// KeySet finds public keys of token signers by key id, like JWKS,
+// errors caused by unknown keys wrap ErrInvalidCredentials
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// JWT is an Authenticator of bearer JSON Web Tokens (RFC 7519) issued by SSO,
+// a token should be signed by a key of the key set, be issued by the issuer
+// for the audience and have not expired
+type JWT struct {
+	keys        KeySet
+	parser      *jwt.Parser
+	scopeClaim  string
+	tenantClaim string
+	permissions map[string][]string
+	leeway      time.Duration
+}
+
+// JWTOption sets an optional parameter of JWT
+type JWTOption func(*JWT)
+
+// WithScopeClaim sets a claim with permissions of the subject,
+// it is either a space-separated string (like "scope" of OAuth 2.0)
+// or an array of strings (like "roles"), DefaultScopeClaim by default
+func WithScopeClaim(name string) JWTOption {
+	return func(j *JWT) { j.scopeClaim = name }
+}
+
+// WithTenantClaim sets a claim with a tenant the subject is bound to,
+// tokens without a valid tenant in the claim are rejected
+func WithTenantClaim(name string) JWTOption {
+	return func(j *JWT) { j.tenantClaim = name }
+}
+
+// WithPermissions maps values of the scope claim to scopes,
+// values which are scopes themselves (e.g. "drivers:read") are kept anyway
+func WithPermissions(permissions map[string][]string) JWTOption {
+	return func(j *JWT) { j.permissions = permissions }
+}
+
+// WithLeeway allows clocks of the issuer and the service to differ
+func WithLeeway(d time.Duration) JWTOption {
+	return func(j *JWT) { j.leeway = d }
+}
+
+// NewJWT is a constructor of JWT
+func NewJWT(keys KeySet, issuer, audience string, opts ...JWTOption) *JWT {
+	j := &JWT{keys: keys, scopeClaim: DefaultScopeClaim}
+	for _, opt := range opts {
+		opt(j)
+	}
+	j.parser = jwt.NewParser(
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(j.leeway),
+	)
+	return j
+}
+
+// Challenge implements Challenger
+func (j *JWT) Challenge() string {
+	return SchemeBearer + ` realm="` + Realm + `"`
+}
+
+// Authenticate implements Authenticator, the subject of a token
+// is "jwt:<sub>", its claims are kept in the principal
+func (j *JWT) Authenticate(ctx context.Context, c Credentials) (Principal, error) {
+	if c.Token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	// errors of the key set are returned as they are, because
+	// the key set may fail to be refreshed (it's not a client's fault)
+	var keyErr error
+	claims := jwt.MapClaims{}
+	_, err := j.parser.ParseWithClaims(c.Token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		var key crypto.PublicKey
+		key, keyErr = j.keys.Key(ctx, kid)
+		return key, keyErr
+	})
+	if keyErr != nil {
+		return Principal{}, keyErr
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w; %v", ErrInvalidCredentials, err)
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return Principal{}, fmt.Errorf("%w; token has no subject", ErrInvalidCredentials)
+	}
+
+	var tenant string
+	if j.tenantClaim != "" {
+		tenant, _ = claims[j.tenantClaim].(string)
+		if !store.ValidTenant(tenant) {
+			return Principal{}, fmt.Errorf("%w; token has no valid %s claim", ErrInvalidCredentials, j.tenantClaim)
+		}
+	}
+
+	return Principal{
+		Subject: "jwt:" + sub,
+		Scopes:  j.scopes(claims[j.scopeClaim]),
+		Tenant:  tenant,
+		Claims:  claims,
+	}, nil
+}
+
+// scopes maps values of the scope claim to scopes
+func (j *JWT) scopes(claim interface{}) []string {
+	var values []string
+	switch v := claim.(type) {
+	case string:
+		values = strings.Fields(v)
+	case []interface{}:
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var scopes []string
+	seen := make(map[string]bool)
+	add := func(scope string) {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	for _, value := range values {
+		if ValidScope(value) {
+			add(value)
+		}
+		for _, scope := range j.permissions[value] {
+			add(scope)
+		}
+	}
+	return scopes
+}
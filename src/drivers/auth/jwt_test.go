@@ -0,0 +1,479 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/konjoot/drivers-go-kit/src/drivers/auth"
+)
+
+const (
+	testIssuer   = "https://sso.example.com"
+	testAudience = "drivers"
+)
+
+func TestJWT(t *testing.T) {
+	ecKey := newECKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := newECKey(t)
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, map[string]crypto.PublicKey{"ec": &ecKey.PublicKey, "rsa": &rsaKey.PublicKey})
+
+	authenticator := auth.Schemes{auth.SchemeBearer: auth.NewJWT(
+		auth.NewJWKS(jwksFile, time.Hour, nil),
+		testIssuer,
+		testAudience,
+		auth.WithScopeClaim("roles"),
+		auth.WithPermissions(map[string][]string{
+			"importer": {auth.ScopeImport, auth.ScopeRead},
+			"viewer":   {auth.ScopeRead},
+		}),
+	)}
+
+	t.Log("challenge =>", authenticator.Challenge())
+	if authenticator.Challenge() != `Bearer realm="drivers"` {
+		t.Error("Expected =>", `Bearer realm="drivers"`)
+	}
+
+	claims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":   testIssuer,
+			"aud":   []string{testAudience, "reports"},
+			"sub":   "jane@example.com",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": []string{"importer"},
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+
+	for _, tc := range []struct {
+		name         string
+		token        string
+		expSubject   string
+		expScopes    string
+		expEmail     interface{}
+		expErr       error
+		expErrString string
+	}{
+		{
+			name:       "Import",
+			token:      sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(nil)),
+			expSubject: "jwt:jane@example.com",
+			expScopes:  "[drivers:import drivers:read]",
+		},
+		{
+			name: "Read",
+			token: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(func(c jwt.MapClaims) {
+				c["roles"] = []string{"viewer", "unknown"}
+				c["email"] = "jane@example.com"
+			})),
+			expSubject: "jwt:jane@example.com",
+			expScopes:  "[drivers:read]",
+			expEmail:   "jane@example.com",
+		},
+		{
+			name: "ScopesAsString",
+			token: sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(func(c jwt.MapClaims) {
+				c["roles"] = "drivers:read viewer"
+			})),
+			expSubject: "jwt:jane@example.com",
+			expScopes:  "[drivers:read]",
+		},
+		{
+			name: "NoPermissions",
+			token: sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(func(c jwt.MapClaims) {
+				delete(c, "roles")
+			})),
+			expSubject: "jwt:jane@example.com",
+			expScopes:  "[]",
+		},
+		{
+			name:   "NoCredentials",
+			expErr: auth.ErrNoCredentials,
+		},
+		{
+			name:         "Malformed",
+			token:        "drv_key",
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "token is malformed",
+		},
+		{
+			name: "Expired",
+			token: sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(func(c jwt.MapClaims) {
+				c["exp"] = time.Now().Add(-time.Minute).Unix()
+			})),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "token is expired",
+		},
+		{
+			name: "NoExpiration",
+			token: sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(func(c jwt.MapClaims) {
+				delete(c, "exp")
+			})),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "exp claim is required",
+		},
+		{
+			name: "WrongAudience",
+			token: sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(func(c jwt.MapClaims) {
+				c["aud"] = "reports"
+			})),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "token has invalid audience",
+		},
+		{
+			name: "WrongIssuer",
+			token: sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(func(c jwt.MapClaims) {
+				c["iss"] = "https://evil.example.com"
+			})),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "token has invalid issuer",
+		},
+		{
+			name: "NoSubject",
+			token: sign(t, jwt.SigningMethodES256, "ec", ecKey, claims(func(c jwt.MapClaims) {
+				delete(c, "sub")
+			})),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "token has no subject",
+		},
+		{
+			name:         "ForgedSignature",
+			token:        sign(t, jwt.SigningMethodES256, "ec", otherKey, claims(nil)),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "signature is invalid",
+		},
+		{
+			name:         "UnknownKey",
+			token:        sign(t, jwt.SigningMethodES256, "other", otherKey, claims(nil)),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: `signing key "other" is unknown`,
+		},
+		{
+			name:         "WrongKeyType",
+			token:        sign(t, jwt.SigningMethodES256, "rsa", ecKey, claims(nil)),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "key is of invalid type",
+		},
+		{
+			name:         "SymmetricAlgorithm",
+			token:        sign(t, jwt.SigningMethodHS256, "ec", []byte("secret"), claims(nil)),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "signing method HS256 is invalid",
+		},
+		{
+			name:         "NoneAlgorithm",
+			token:        sign(t, jwt.SigningMethodNone, "ec", jwt.UnsafeAllowNoneSignatureType, claims(nil)),
+			expErr:       auth.ErrInvalidCredentials,
+			expErrString: "signing method none is invalid",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(context.Background(),
+				auth.Credentials{Scheme: auth.SchemeBearer, Token: tc.token})
+
+			t.Log("principal.Subject =>", principal.Subject)
+			if principal.Subject != tc.expSubject {
+				t.Error("Expected =>", tc.expSubject)
+			}
+			if tc.expScopes != "" {
+				t.Log("principal.Scopes =>", principal.Scopes)
+				if fmt.Sprint(principal.Scopes) != tc.expScopes {
+					t.Error("Expected =>", tc.expScopes)
+				}
+			}
+			t.Log("principal.Claims[email] =>", principal.Claims["email"])
+			if principal.Claims["email"] != tc.expEmail {
+				t.Error("Expected =>", tc.expEmail)
+			}
+			t.Log("err =>", err)
+			if !errors.Is(err, tc.expErr) {
+				t.Error("Expected =>", tc.expErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tc.expErrString) {
+				t.Error("Expected =>", tc.expErrString)
+			}
+		})
+	}
+}
+
+func TestJWTTenantClaim(t *testing.T) {
+	key := newECKey(t)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, map[string]crypto.PublicKey{"ec": &key.PublicKey})
+
+	authenticator := auth.NewJWT(
+		auth.NewJWKS(jwksFile, time.Hour, nil),
+		testIssuer,
+		testAudience,
+		auth.WithTenantClaim("org"),
+	)
+
+	for _, tc := range []struct {
+		name         string
+		org          interface{}
+		expTenant    string
+		expErrString string
+	}{
+		{
+			name:      "Tenant",
+			org:       "acme",
+			expTenant: "acme",
+		},
+		{
+			name:         "NoTenant",
+			expErrString: "token has no valid org claim",
+		},
+		{
+			name:         "InvalidTenant",
+			org:          "Acme Inc.",
+			expErrString: "token has no valid org claim",
+		},
+		{
+			name:         "NotString",
+			org:          []string{"acme"},
+			expErrString: "token has no valid org claim",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"iss": testIssuer,
+				"aud": testAudience,
+				"sub": "jane@example.com",
+				"exp": time.Now().Add(time.Hour).Unix(),
+			}
+			if tc.org != nil {
+				claims["org"] = tc.org
+			}
+			principal, err := authenticator.Authenticate(context.Background(),
+				auth.Credentials{Scheme: auth.SchemeBearer, Token: sign(t, jwt.SigningMethodES256, "ec", key, claims)})
+
+			t.Log("principal.Tenant =>", principal.Tenant)
+			if principal.Tenant != tc.expTenant {
+				t.Error("Expected =>", tc.expTenant)
+			}
+			t.Log("err =>", err)
+			if tc.expErrString == "" && err != nil {
+				t.Error("Unexpected error =>", err)
+			}
+			if tc.expErrString != "" && (!errors.Is(err, auth.ErrInvalidCredentials) || !strings.Contains(err.Error(), tc.expErrString)) {
+				t.Error("Expected =>", tc.expErrString)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	oldKey, newKey := newECKey(t), newECKey(t)
+
+	var requests int32
+	var keys atomic.Value
+	keys.Store(map[string]crypto.PublicKey{"old": &oldKey.PublicKey})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		json.NewEncoder(w).Encode(jwksDocument(keys.Load().(map[string]crypto.PublicKey)))
+	}))
+	defer server.Close()
+
+	jwks := auth.NewJWKS(server.URL, 50*time.Millisecond, server.Client())
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := jwks.Key(ctx, "old"); err != nil {
+			t.Error("Unexpected error =>", err)
+		}
+	}
+	t.Log("requests =>", atomic.LoadInt32(&requests))
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Error("Expected the keys to be cached")
+	}
+
+	// the signer rotates keys
+	keys.Store(map[string]crypto.PublicKey{"new": &newKey.PublicKey})
+	time.Sleep(100 * time.Millisecond)
+
+	key, err := jwks.Key(ctx, "new")
+	t.Log("err =>", err)
+	if err != nil || !newKey.PublicKey.Equal(key) {
+		t.Error("Expected the keys to be refreshed")
+	}
+	_, err = jwks.Key(ctx, "old")
+	t.Log("err =>", err)
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Error("Expected =>", auth.ErrInvalidCredentials)
+	}
+
+	// the cached keys are used while the source is unavailable
+	server.Close()
+	time.Sleep(100 * time.Millisecond)
+	if _, err = jwks.Key(ctx, "new"); err != nil {
+		t.Error("Unexpected error =>", err)
+	}
+
+	_, err = auth.NewJWKS(server.URL, time.Hour, nil).Key(ctx, "new")
+	t.Log("err =>", err)
+	if err == nil || auth.Unauthenticated(err) {
+		t.Error("Expected a failure of the source")
+	}
+}
+
+func TestJWKSSlowSource(t *testing.T) {
+	key := newECKey(t)
+
+	var requests int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first fetch is fast, the next ones wait for the release
+		if atomic.AddInt32(&requests, 1) > 1 {
+			<-release
+		}
+		json.NewEncoder(w).Encode(jwksDocument(map[string]crypto.PublicKey{"old": &key.PublicKey}))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	jwks := auth.NewJWKS(server.URL, 500*time.Millisecond, server.Client())
+	ctx := context.Background()
+	if _, err := jwks.Key(ctx, "old"); err != nil {
+		t.Fatal("Unexpected error =>", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	// an unknown key refreshes the keys, the fetch doesn't block other tokens
+	refreshed := make(chan error)
+	go func() {
+		_, err := jwks.Key(ctx, "unknown")
+		refreshed <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := jwks.Key(ctx, "old"); err != nil {
+			t.Error("Unexpected error =>", err)
+		}
+		// a flood of unknown keys doesn't fetch the keys again
+		for i := 0; i < 10; i++ {
+			_, err := jwks.Key(ctx, fmt.Sprint("forged", i))
+			if !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Error("Expected =>", auth.ErrInvalidCredentials)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("Expected keys to be read while they are fetched")
+	}
+
+	release <- struct{}{}
+	err := <-refreshed
+	t.Log("err =>", err)
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Error("Expected =>", auth.ErrInvalidCredentials)
+	}
+	t.Log("requests =>", atomic.LoadInt32(&requests))
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Error("Expected =>", 2)
+	}
+
+	// callers of a missing set share a single fetch
+	atomic.StoreInt32(&requests, 1)
+	jwks = auth.NewJWKS(server.URL, time.Hour, server.Client())
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := jwks.Key(ctx, "old"); err != nil {
+				t.Error("Unexpected error =>", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	release <- struct{}{}
+	wg.Wait()
+	t.Log("requests =>", atomic.LoadInt32(&requests))
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Error("Expected =>", 2)
+	}
+}
+
+func newECKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func writeJWKS(t *testing.T, path string, keys map[string]crypto.PublicKey) {
+	data, err := json.Marshal(jwksDocument(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func jwksDocument(keys map[string]crypto.PublicKey) map[string]interface{} {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	var jwks []map[string]string
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *ecdsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "EC", "kid": kid, "use": "sig", "crv": "P-256",
+				"x": b64(k.X.FillBytes(make([]byte, 32))),
+				"y": b64(k.Y.FillBytes(make([]byte, 32))),
+			})
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig",
+				"n": b64(k.N.Bytes()),
+				"e": b64(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": jwks}
+}
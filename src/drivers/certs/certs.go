@@ -0,0 +1,185 @@
+// Package certs serves TLS of the Drivers app: it holds the server
+// certificate, which is reloaded when its files change on disk, and
+// verifies client certificates for mutual TLS.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// DefaultWatchInterval is a default interval of checks of certificate files
+const DefaultWatchInterval = 10 * time.Second
+
+// Reloader holds a certificate loaded from a pair of PEM files,
+// it is swapped atomically, so handshakes always get a whole one
+type Reloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// NewReloader is a constructor of Reloader, the certificate is loaded at once
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate from the files,
+// the current one is kept if the files are invalid
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reload()
+}
+
+func (r *Reloader) reload() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert.Store(&cert)
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate returns the current certificate,
+// it suits tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Watch checks the files every interval and reloads the certificate
+// when one of them is modified, until ctx is done, failures are logged
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, logger log.Logger) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reloadModified()
+		if err != nil {
+			// the pair may be half-written, it is retried on the next tick
+			level.Error(logger).Log("message", "certificate is not reloaded", "err", err)
+			continue
+		}
+		if reloaded {
+			level.Info(logger).Log("message", "certificate is reloaded", "file", r.certFile)
+		}
+	}
+}
+
+// reloadModified reloads the certificate if one of the files
+// is modified since the last reload
+func (r *Reloader) reloadModified() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.lastModified()
+	if err != nil {
+		return false, err
+	}
+	if !modTime.After(r.modTime) {
+		return false, nil
+	}
+	return true, r.reload()
+}
+
+// lastModified returns the latest modification time of the files
+func (r *Reloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
+
+// ServerConfig returns TLS settings of a server with the certificate of r,
+// if clientCAFile is not empty, clients have to present a certificate
+// signed by one of its CAs (mutual TLS)
+func ServerConfig(r *Reloader, clientCAFile string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
+
+// ErrNoClientCertificate is returned when a client is not verified by a certificate
+var ErrNoClientCertificate = errors.New("no verified client certificate")
+
+// ClientSubject returns the subject of the verified client certificate
+// of the connection, e.g. "CN=importer,O=Drivers"
+func ClientSubject(state *tls.ConnectionState) (string, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", ErrNoClientCertificate
+	}
+	return state.VerifiedChains[0][0].Subject.String(), nil
+}
+
+// ctxKey type is needed to avoid
+// key collisions in context
+type ctxKey int
+
+const subjectKey ctxKey = 0
+
+// NewContext returns a copy of ctx which carries the client subject
+func NewContext(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey, subject)
+}
+
+// SubjectFromContext returns the client subject stored in ctx,
+// it is empty if the client is not verified by a certificate
+func SubjectFromContext(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey).(string)
+	return subject
+}
@@ -0,0 +1,330 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	stdlog "log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/konjoot/drivers-go-kit/src/drivers/certs"
+)
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "Drivers CA")
+	untrustedCA := newCA(t, "Untrusted CA")
+	certFile, keyFile := ca.issue(t, dir, "server", pkix.Name{CommonName: "localhost"})
+	clientCAFile := ca.writeCert(t, dir)
+	client := ca.keyPair(t, pkix.Name{CommonName: "importer", Organization: []string{"Drivers"}})
+	untrusted := untrustedCA.keyPair(t, pkix.Name{CommonName: "importer"})
+
+	for _, tc := range []struct {
+		name         string
+		clientCAFile string
+		clientCerts  []tls.Certificate
+		expSubject   string
+		expErr       bool
+	}{
+		{
+			name:       "TLS",
+			expSubject: certs.ErrNoClientCertificate.Error(),
+		},
+		{
+			name:        "TLSWithClientCertificate",
+			clientCerts: []tls.Certificate{client},
+			expSubject:  certs.ErrNoClientCertificate.Error(),
+		},
+		{
+			name:         "MutualTLS",
+			clientCAFile: clientCAFile,
+			clientCerts:  []tls.Certificate{client},
+			expSubject:   "CN=importer,O=Drivers",
+		},
+		{
+			name:         "MutualTLSWithoutClientCertificate",
+			clientCAFile: clientCAFile,
+			expErr:       true,
+		},
+		{
+			name:         "MutualTLSWithUntrustedClientCertificate",
+			clientCAFile: clientCAFile,
+			clientCerts:  []tls.Certificate{untrusted},
+			expErr:       true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reloader, err := certs.NewReloader(certFile, keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := certs.ServerConfig(reloader, tc.clientCAFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			url := serve(t, cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subject, err := certs.ClientSubject(r.TLS)
+				if err != nil {
+					subject = err.Error()
+				}
+				io.WriteString(w, subject)
+			}))
+
+			subject, err := get(url, ca.pool(), tc.clientCerts)
+
+			t.Log("err =>", err)
+			if (err != nil) != tc.expErr {
+				t.Error("Expected error =>", tc.expErr)
+			}
+			t.Log("subject =>", subject)
+			if subject != tc.expSubject {
+				t.Error("Expected =>", tc.expSubject)
+			}
+		})
+	}
+}
+
+func TestServerConfigInvalidClientCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "Drivers CA")
+	certFile, keyFile := ca.issue(t, dir, "server", pkix.Name{CommonName: "localhost"})
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = certs.ServerConfig(reloader, keyFile)
+
+	t.Log("err =>", err)
+	if err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Error("Expected =>", "no certificates found")
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "Drivers CA")
+	certFile, keyFile := ca.issue(t, dir, "server", pkix.Name{CommonName: "server-1"})
+
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := certs.ServerConfig(reloader, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond, log.NewNopLogger())
+
+	served := func() string {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: ca.pool(), ServerName: "localhost"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	t.Log("served =>", served())
+	if served() != "server-1" {
+		t.Error("Expected =>", "server-1")
+	}
+
+	// invalid files are rejected, the current certificate is kept
+	writeFile(t, certFile, "garbage")
+	err = reloader.Reload()
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected an error")
+	}
+	if served() != "server-1" {
+		t.Error("Expected =>", "server-1")
+	}
+
+	// modified files are reloaded by Watch
+	ca.issue(t, dir, "server", pkix.Name{CommonName: "server-2"})
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{certFile, keyFile} {
+		if err = os.Chtimes(name, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for served() != "server-2" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Log("served =>", served())
+	if served() != "server-2" {
+		t.Error("Expected =>", "server-2")
+	}
+}
+
+// serve runs an HTTPS-server with cfg until the test ends
+func serve(t *testing.T, cfg *tls.Config, handler http.Handler) string {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler:  handler,
+		ErrorLog: stdlog.New(io.Discard, "", 0),
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	return "https://" + ln.Addr().String()
+}
+
+func get(url string, roots *x509.CertPool, clientCerts []tls.Certificate) (string, error) {
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: clientCerts},
+	}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+// testCA is a self-signed CA issuing certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T, name string) *testCA {
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// sign returns PEM of a certificate of the key signed by ca,
+// it is valid for localhost both as a server and as a client
+func (ca *testCA) sign(t *testing.T, subject pkix.Name, key *ecdsa.PrivateKey) []byte {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// issue writes a certificate and its key into dir/name.crt and dir/name.key
+func (ca *testCA) issue(t *testing.T, dir, name string, subject pkix.Name) (certFile, keyFile string) {
+	key := newKey(t)
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	writeFile(t, certFile, string(ca.sign(t, subject, key)))
+	writeFile(t, keyFile, string(keyPEM(t, key)))
+	return certFile, keyFile
+}
+
+func (ca *testCA) keyPair(t *testing.T, subject pkix.Name) tls.Certificate {
+	key := newKey(t)
+	cert, err := tls.X509KeyPair(ca.sign(t, subject, key), keyPEM(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func (ca *testCA) writeCert(t *testing.T, dir string) string {
+	name := filepath.Join(dir, "ca.crt")
+	writeFile(t, name, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})))
+	return name
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func keyPEM(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+// Package codec provides encoders and decoders of the Drivers API
+// representations and a content negotiation between them.
+package codec
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Negotiation related errors
+var (
+	ErrNotAcceptable        = errors.New("none of the accepted media types is supported")
+	ErrUnsupportedMediaType = errors.New("media type of the request body is not supported")
+	ErrUnsupportedType      = errors.New("value has no representation in the media type")
+)
+
+// Decoding related errors
+var (
+	ErrTrailingData = errors.New("unexpected data after the value")
+	ErrUnknownField = errors.New("unknown field")
+)
+
+// DecodeError is an error of a malformed request body,
+// Path is a JSON path of the invalid value, e.g. "$[1].name"
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Codec encodes and decodes values in a particular media type
+type Codec interface {
+	// MediaTypes returns media types served by the codec, the first one is the main
+	MediaTypes() []string
+	// ContentType returns a value of Content-Type header for encoded values
+	ContentType() string
+	Encode(io.Writer, interface{}) error
+	Decode(io.Reader, interface{}) error
+}
+
+// Default is a registry of all codecs of the package with JSON as a default one
+var Default = NewRegistry(JSON, MsgPack, Protobuf, XML)
+
+// Strict is Default with strict JSON and MessagePack codecs,
+// they reject unknown fields of request bodies
+var Strict = NewRegistry(StrictJSON, StrictMsgPack, Protobuf, XML)
+
+// NewRegistry is a constructor of Registry,
+// the first codec is used when a client has no preferences
+func NewRegistry(codecs ...Codec) *Registry {
+	if len(codecs) == 0 {
+		panic("codec.NewRegistry without codecs")
+	}
+
+	r := &Registry{
+		codecs: codecs,
+		byType: make(map[string]Codec),
+	}
+	for _, c := range codecs {
+		for _, mediaType := range c.MediaTypes() {
+			r.byType[mediaType] = c
+		}
+	}
+	return r
+}
+
+// Registry is a set of codecs keyed by media types
+type Registry struct {
+	codecs []Codec
+	byType map[string]Codec
+}
+
+// Default returns the codec which is used when a client has no preferences
+func (r *Registry) Default() Codec {
+	return r.codecs[0]
+}
+
+// Negotiate picks a codec for a response by a value of Accept header
+// according to media ranges and their quality values,
+// the default codec is used when the header is empty
+func (r *Registry) Negotiate(accept string) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		return r.Default(), nil
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		switch {
+		case mediaRange == "*/*":
+			return r.Default(), nil
+		case strings.HasSuffix(mediaRange, "/*"):
+			prefix := strings.TrimSuffix(mediaRange, "*")
+			for _, c := range r.codecs {
+				if strings.HasPrefix(c.MediaTypes()[0], prefix) {
+					return c, nil
+				}
+			}
+		default:
+			if c, ok := r.byType[mediaRange]; ok {
+				return c, nil
+			}
+		}
+	}
+
+	return nil, ErrNotAcceptable
+}
+
+// Lookup picks a codec for a request body by a value of Content-Type header,
+// the default codec is used when the header is empty
+func (r *Registry) Lookup(contentType string) (Codec, error) {
+	if strings.TrimSpace(contentType) == "" {
+		return r.Default(), nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+
+	if c, ok := r.byType[mediaType]; ok {
+		return c, nil
+	}
+	return nil, ErrUnsupportedMediaType
+}
+
+// parseAccept returns acceptable media ranges of Accept header
+// ordered by their quality values
+func parseAccept(accept string) []string {
+	type weighted struct {
+		mediaRange string
+		q          float64
+	}
+
+	var ranges []weighted
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if qValue, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qValue, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, weighted{mediaRange, q})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	mediaRanges := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		mediaRanges = append(mediaRanges, r.mediaRange)
+	}
+	return mediaRanges
+}
@@ -0,0 +1,350 @@
+package codec_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/codec"
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		accept   string
+		expCodec codec.Codec
+		expErr   error
+	}{
+		{
+			name:     "Empty",
+			accept:   "",
+			expCodec: codec.JSON,
+		},
+		{
+			name:     "Any",
+			accept:   "*/*",
+			expCodec: codec.JSON,
+		},
+		{
+			name:     "JSON",
+			accept:   "application/json",
+			expCodec: codec.JSON,
+		},
+		{
+			name:     "MsgPack",
+			accept:   "application/x-msgpack",
+			expCodec: codec.MsgPack,
+		},
+		{
+			name:     "Protobuf",
+			accept:   "application/protobuf",
+			expCodec: codec.Protobuf,
+		},
+		{
+			name:     "XML",
+			accept:   "text/xml",
+			expCodec: codec.XML,
+		},
+		{
+			name:     "QualityValues",
+			accept:   "application/json;q=0.5, application/xml;q=0.9, image/png",
+			expCodec: codec.XML,
+		},
+		{
+			name:     "Range",
+			accept:   "image/png, application/*;q=0.1",
+			expCodec: codec.JSON,
+		},
+		{
+			name:     "Excluded",
+			accept:   "application/json;q=0, application/msgpack",
+			expCodec: codec.MsgPack,
+		},
+		{
+			name:   "NotAcceptable",
+			accept: "image/png, text/html",
+			expErr: codec.ErrNotAcceptable,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := codec.Default.Negotiate(tc.accept)
+			t.Log("err =>", err)
+			if err != tc.expErr {
+				t.Error("Expected =>", tc.expErr)
+			}
+			t.Log("codec =>", c)
+			if c != tc.expCodec {
+				t.Error("Expected =>", tc.expCodec)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		expCodec    codec.Codec
+		expErr      error
+	}{
+		{
+			name:        "Empty",
+			contentType: "",
+			expCodec:    codec.JSON,
+		},
+		{
+			name:        "JSONWithCharset",
+			contentType: "application/json; charset=utf-8",
+			expCodec:    codec.JSON,
+		},
+		{
+			name:        "Protobuf",
+			contentType: "application/x-protobuf",
+			expCodec:    codec.Protobuf,
+		},
+		{
+			name:        "Unsupported",
+			contentType: "text/plain",
+			expErr:      codec.ErrUnsupportedMediaType,
+		},
+		{
+			name:        "Malformed",
+			contentType: "application/",
+			expErr:      codec.ErrUnsupportedMediaType,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := codec.Default.Lookup(tc.contentType)
+			t.Log("err =>", err)
+			if err != tc.expErr {
+				t.Error("Expected =>", tc.expErr)
+			}
+			t.Log("codec =>", c)
+			if c != tc.expCodec {
+				t.Error("Expected =>", tc.expCodec)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	drivers := []*store.Driver{
+		{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		{ID: 1 << 40, Name: "Jöhn Doe", LicenseNumber: "11-222-34"},
+	}
+
+	for _, c := range []codec.Codec{codec.JSON, codec.MsgPack, codec.Protobuf, codec.XML} {
+		t.Run(c.MediaTypes()[0], func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := c.Encode(&buf, drivers); err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			var decoded []*store.Driver
+			if err := c.Decode(&buf, &decoded); err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			t.Log("len(decoded) =>", len(decoded))
+			if len(decoded) != len(drivers) {
+				t.Error("Expected =>", len(drivers))
+				t.FailNow()
+			}
+			for i, driver := range decoded {
+				t.Log("driver =>", driver)
+				if fmt.Sprint(driver) != fmt.Sprint(drivers[i]) {
+					t.Error("Expected =>", drivers[i])
+				}
+			}
+
+			buf.Reset()
+			if err := c.Encode(&buf, drivers[1]); err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			driver := &store.Driver{}
+			if err := c.Decode(&buf, driver); err != nil {
+				t.Error(err)
+			}
+			t.Log("driver =>", driver)
+			if fmt.Sprint(driver) != fmt.Sprint(drivers[1]) {
+				t.Error("Expected =>", drivers[1])
+			}
+		})
+	}
+}
+
+func TestProtobufInvalidMessage(t *testing.T) {
+	var drivers []*store.Driver
+	err := codec.Protobuf.Decode(bytes.NewReader([]byte{0x0a, 0x05, 0x08}), &drivers)
+	t.Log("err =>", err)
+	if err != codec.ErrInvalidProto {
+		t.Error("Expected =>", codec.ErrInvalidProto)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	msgpackBody := func(v interface{}) string {
+		b, err := msgpack.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	driver := map[string]interface{}{"id": 1, "name": "John", "license_number": "11-222-33"}
+	unknown := map[string]interface{}{"id": 2, "name": "Jane", "license_number": "11-222-34", "age": 30}
+
+	for _, tc := range []struct {
+		name    string
+		codec   codec.Codec
+		body    string
+		single  bool
+		expPath string
+		expErr  string
+	}{
+		{
+			name:  "UnknownField",
+			codec: codec.JSON,
+			body:  `[{"id":1,"name":"John","age":30}]`,
+		},
+		{
+			name:    "StrictUnknownField",
+			codec:   codec.StrictJSON,
+			body:    `[{"id":1,"name":"John"},{"id":2,"name":"Jane","age":30}]`,
+			expPath: "$[1].age",
+			expErr:  "$[1].age: unknown field",
+		},
+		{
+			name:    "InvalidType",
+			codec:   codec.JSON,
+			body:    `[{"id":1},{"id":"2"}]`,
+			expPath: "$[1].id",
+			expErr:  "$[1].id: should be integer, but not string",
+		},
+		{
+			name:    "NegativeID",
+			codec:   codec.JSON,
+			body:    `[{"id":-1}]`,
+			expPath: "$[0].id",
+			expErr:  "$[0].id: should be integer, but not number -1",
+		},
+		{
+			name:    "NotArray",
+			codec:   codec.JSON,
+			body:    `{"id":1}`,
+			expPath: "$",
+			expErr:  "$: should be array, but not object",
+		},
+		{
+			name:    "Syntax",
+			codec:   codec.JSON,
+			body:    `[{"id":1},{"id" 2}]`,
+			expPath: "$[1]",
+			expErr:  "$[1]: invalid character '2' after object key",
+		},
+		{
+			name:    "Truncated",
+			codec:   codec.JSON,
+			body:    `[{"id":1}`,
+			expPath: "$[1]",
+			expErr:  "$[1]: unexpected end of JSON input",
+		},
+		{
+			name:    "Empty",
+			codec:   codec.JSON,
+			expPath: "$",
+			expErr:  "$: unexpected EOF",
+		},
+		{
+			name:    "TrailingValue",
+			codec:   codec.JSON,
+			body:    `[] []`,
+			expPath: "$",
+			expErr:  "$: unexpected data after the value",
+		},
+		{
+			name:    "TrailingGarbage",
+			codec:   codec.JSON,
+			body:    `[]x`,
+			expPath: "$",
+			expErr:  "$: unexpected data after the value",
+		},
+		{
+			name:    "SingleInvalidType",
+			codec:   codec.JSON,
+			body:    `{"id":1,"name":5}`,
+			single:  true,
+			expPath: "$.name",
+			expErr:  "$.name: should be string, but not number",
+		},
+		{
+			name:    "SingleTrailing",
+			codec:   codec.JSON,
+			body:    `{"id":1}{"id":2}`,
+			single:  true,
+			expPath: "$",
+			expErr:  "$: unexpected data after the value",
+		},
+		{
+			name:  "MsgPackUnknownField",
+			codec: codec.MsgPack,
+			body:  msgpackBody([]interface{}{driver, unknown}),
+		},
+		{
+			name:    "MsgPackStrictUnknownField",
+			codec:   codec.StrictMsgPack,
+			body:    msgpackBody([]interface{}{driver, unknown}),
+			expPath: "$[1]",
+			expErr:  "$[1]: msgpack: unknown field \"age\"",
+		},
+		{
+			name:    "MsgPackTrailing",
+			codec:   codec.MsgPack,
+			body:    msgpackBody([]interface{}{driver}) + "x",
+			expPath: "$",
+			expErr:  "$: unexpected data after the value",
+		},
+		{
+			name:   "XMLTrailing",
+			codec:  codec.XML,
+			body:   `<drivers><driver><id>1</id></driver></drivers><drivers/>`,
+			expErr: "unexpected data after the value",
+		},
+		{
+			name:  "XMLTrailingSpace",
+			codec: codec.XML,
+			body:  "<drivers><driver><id>1</id></driver></drivers>\n<!-- end -->\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			if tc.single {
+				err = tc.codec.Decode(strings.NewReader(tc.body), &store.Driver{})
+			} else {
+				var drivers []*store.Driver
+				err = tc.codec.Decode(strings.NewReader(tc.body), &drivers)
+			}
+
+			t.Log("err =>", err)
+			if fmt.Sprint(err) != tc.expErr && (err != nil || tc.expErr != "") {
+				t.Error("Expected =>", tc.expErr)
+			}
+			var decodeErr *codec.DecodeError
+			var path string
+			if errors.As(err, &decodeErr) {
+				path = decodeErr.Path
+			}
+			t.Log("path =>", path)
+			if path != tc.expPath {
+				t.Error("Expected =>", tc.expPath)
+			}
+		})
+	}
+}
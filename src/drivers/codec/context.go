@@ -0,0 +1,40 @@
+package codec
+
+import "context"
+
+// ctxKey type is needed to avoid
+// key collisions in context
+type ctxKey int
+
+const (
+	registryKey ctxKey = iota
+	acceptedKey
+)
+
+// NewContext returns a copy of ctx which carries the registry
+func NewContext(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, registryKey, r)
+}
+
+// FromContext returns the registry stored in ctx, or Default
+func FromContext(ctx context.Context) *Registry {
+	if r, ok := ctx.Value(registryKey).(*Registry); ok {
+		return r
+	}
+	return Default
+}
+
+// WithAccepted returns a copy of ctx which carries
+// the codec negotiated for a response
+func WithAccepted(ctx context.Context, c Codec) context.Context {
+	return context.WithValue(ctx, acceptedKey, c)
+}
+
+// Accepted returns the codec negotiated for a response,
+// or the default codec of the registry stored in ctx
+func Accepted(ctx context.Context) Codec {
+	if c, ok := ctx.Value(acceptedKey).(Codec); ok {
+		return c
+	}
+	return FromContext(ctx).Default()
+}
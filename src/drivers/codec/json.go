@@ -0,0 +1,149 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+// JSON is a codec of application/json
+var JSON Codec = jsonCodec{}
+
+// StrictJSON is JSON which rejects unknown fields
+var StrictJSON Codec = jsonCodec{strict: true}
+
+type jsonCodec struct {
+	strict bool
+}
+
+func (jsonCodec) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+func (jsonCodec) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Decode decodes a single JSON value, errors are *DecodeError,
+// drivers of a collection are decoded one by one, so errors name their index
+func (c jsonCodec) Decode(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	if c.strict {
+		dec.DisallowUnknownFields()
+	}
+
+	if drivers, ok := v.(*[]*store.Driver); ok {
+		if err := decodeJSONDrivers(dec, drivers); err != nil {
+			return err
+		}
+	} else if err := dec.Decode(v); err != nil {
+		return jsonError("$", err)
+	}
+
+	_, err := dec.Token()
+	var syntaxErr *json.SyntaxError
+	if err == io.EOF {
+		return nil
+	}
+	if err == nil || errors.As(err, &syntaxErr) {
+		return &DecodeError{Path: "$", Err: ErrTrailingData}
+	}
+	return jsonError("$", err)
+}
+
+func decodeJSONDrivers(dec *json.Decoder, drivers *[]*store.Driver) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return jsonError("$", err)
+	}
+	if tok == nil {
+		*drivers = nil
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return &DecodeError{Path: "$", Err: fmt.Errorf("should be array, but not %s", jsonKind(tok))}
+	}
+
+	*drivers = []*store.Driver{}
+	for i := 0; dec.More(); i++ {
+		driver := &store.Driver{}
+		if err := dec.Decode(driver); err != nil {
+			return jsonError("$["+strconv.Itoa(i)+"]", err)
+		}
+		*drivers = append(*drivers, driver)
+	}
+	if _, err := dec.Token(); err != nil {
+		return jsonError("$", err)
+	}
+	return nil
+}
+
+// jsonError wraps an error of decoding of a value at the path into *DecodeError,
+// fields of type errors and unknown fields are appended to the path,
+// a body is never empty, so EOF is unexpected
+func jsonError(path string, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field != "" {
+			path += "." + typeErr.Field
+		}
+		return &DecodeError{Path: path, Err: fmt.Errorf("should be %s, but not %s", jsonType(typeErr.Type), typeErr.Value)}
+	}
+
+	// encoding/json has no type of errors of unknown fields
+	if field := strings.TrimPrefix(err.Error(), "json: unknown field "); field != err.Error() {
+		if name, unquoteErr := strconv.Unquote(field); unquoteErr == nil {
+			return &DecodeError{Path: path + "." + name, Err: ErrUnknownField}
+		}
+	}
+	return &DecodeError{Path: path, Err: err}
+}
+
+// jsonType returns a JSON type of values of t
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Ptr:
+		return jsonType(t.Elem())
+	}
+	return t.String()
+}
+
+// jsonKind returns a JSON type of a token
+func jsonKind(tok json.Token) string {
+	switch tok.(type) {
+	case json.Delim:
+		return "object"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	}
+	return "number"
+}
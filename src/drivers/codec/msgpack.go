@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgPack is a codec of application/msgpack,
+// it uses the same field names as JSON
+var MsgPack Codec = msgpackCodec{}
+
+// StrictMsgPack is MsgPack which rejects unknown fields
+var StrictMsgPack Codec = msgpackCodec{strict: true}
+
+// maxMsgPackPrealloc limits a capacity of a collection allocated
+// by an untrusted length of a MessagePack array
+const maxMsgPackPrealloc = 1024
+
+type msgpackCodec struct {
+	strict bool
+}
+
+func (msgpackCodec) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Encode(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+// Decode decodes a single MessagePack value, errors are *DecodeError,
+// drivers of a collection are decoded one by one, so errors name their index
+func (c msgpackCodec) Decode(r io.Reader, v interface{}) error {
+	br := bufio.NewReader(r)
+	dec := msgpack.NewDecoder(br)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(c.strict)
+
+	if drivers, ok := v.(*[]*store.Driver); ok {
+		if err := decodeMsgPackDrivers(dec, drivers); err != nil {
+			return err
+		}
+	} else if err := dec.Decode(v); err != nil {
+		return &DecodeError{Path: "$", Err: err}
+	}
+
+	if _, err := br.ReadByte(); err != io.EOF {
+		if err != nil {
+			return &DecodeError{Path: "$", Err: err}
+		}
+		return &DecodeError{Path: "$", Err: ErrTrailingData}
+	}
+	return nil
+}
+
+func decodeMsgPackDrivers(dec *msgpack.Decoder, drivers *[]*store.Driver) error {
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return &DecodeError{Path: "$", Err: err}
+	}
+	if n < 0 {
+		*drivers = nil
+		return nil
+	}
+
+	*drivers = make([]*store.Driver, 0, min(n, maxMsgPackPrealloc))
+	for i := 0; i < n; i++ {
+		driver := &store.Driver{}
+		if err := dec.Decode(driver); err != nil {
+			return &DecodeError{Path: "$[" + strconv.Itoa(i) + "]", Err: err}
+		}
+		*drivers = append(*drivers, driver)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf is a codec of application/protobuf,
+// messages are described in drivers.proto:
+// a driver is represented as Driver message
+// and a collection of drivers as Drivers message,
+// other values should implement ProtoMarshaler
+var Protobuf Codec = protobufCodec{}
+
+// ErrInvalidProto is returned when a request body is not a valid protobuf message
+var ErrInvalidProto = errors.New("invalid protobuf message")
+
+// ProtoMarshaler is implemented by values which have a protobuf representation
+type ProtoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) MediaTypes() []string {
+	return []string{"application/protobuf", "application/x-protobuf", "application/vnd.google.protobuf"}
+}
+
+func (protobufCodec) ContentType() string {
+	return "application/protobuf"
+}
+
+func (protobufCodec) Encode(w io.Writer, v interface{}) error {
+	var (
+		b   []byte
+		err error
+	)
+	switch value := v.(type) {
+	case *store.Driver:
+		b = AppendProtoDriver(nil, value, "")
+	case []*store.Driver:
+		for _, driver := range value {
+			b = protowire.AppendTag(b, 1, protowire.BytesType)
+			b = protowire.AppendBytes(b, AppendProtoDriver(nil, driver, ""))
+		}
+	case ProtoMarshaler:
+		if b, err = value.MarshalProto(); err != nil {
+			return err
+		}
+	default:
+		return ErrUnsupportedType
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+func (protobufCodec) Decode(r io.Reader, v interface{}) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case *store.Driver:
+		return consumeProtoDriver(b, value)
+	case *[]*store.Driver:
+		drivers := []*store.Driver{}
+		err = consumeProtoFields(b, func(num protowire.Number, typ protowire.Type, field []byte) (int, error) {
+			if num != 1 || typ != protowire.BytesType {
+				return protowire.ConsumeFieldValue(num, typ, field), nil
+			}
+			m, n := protowire.ConsumeBytes(field)
+			if n < 0 {
+				return n, nil
+			}
+			driver := &store.Driver{}
+			if err := consumeProtoDriver(m, driver); err != nil {
+				return 0, err
+			}
+			drivers = append(drivers, driver)
+			return n, nil
+		})
+		if err != nil {
+			return err
+		}
+		*value = drivers
+		return nil
+	}
+	return ErrUnsupportedType
+}
+
+// AppendProtoDriver appends Driver message to b,
+// self is a link to the driver, it is omitted when empty
+func AppendProtoDriver(b []byte, driver *store.Driver, self string) []byte {
+	if driver.ID != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, driver.ID)
+	}
+	b = AppendProtoString(b, 2, driver.Name)
+	b = AppendProtoString(b, 3, driver.LicenseNumber)
+	if self != "" {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, AppendProtoString(nil, 1, self))
+	}
+	return b
+}
+
+// AppendProtoString appends a string field to b, empty strings are omitted
+func AppendProtoString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func consumeProtoDriver(b []byte, driver *store.Driver) error {
+	return consumeProtoFields(b, func(num protowire.Number, typ protowire.Type, field []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(field)
+			driver.ID = v
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(field)
+			driver.Name = v
+			return n, nil
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(field)
+			driver.LicenseNumber = v
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, field), nil
+	})
+}
+
+// consumeProtoFields walks through fields of a message,
+// consume reads a value of a field and returns its length
+// or a negative number if the value is malformed
+func consumeProtoFields(b []byte, consume func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		b = b[n:]
+
+		n, err := consume(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		b = b[n:]
+	}
+	return nil
+}
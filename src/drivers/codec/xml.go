@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"time"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+// XML is a codec of application/xml,
+// a driver is represented as <driver> element
+// and a collection of drivers as <drivers> element
+var XML Codec = xmlCodec{}
+
+type xmlCodec struct{}
+
+// xmlDriver is an XML representation of store.Driver
+type xmlDriver struct {
+	ID            uint64    `xml:"id"`
+	Name          string    `xml:"name"`
+	LicenseNumber string    `xml:"license_number"`
+	Version       uint64    `xml:"-"`
+	UpdatedAt     time.Time `xml:"-"`
+}
+
+type xmlDrivers struct {
+	XMLName xml.Name     `xml:"drivers"`
+	Drivers []*xmlDriver `xml:"driver"`
+}
+
+func (xmlCodec) MediaTypes() []string {
+	return []string{"application/xml", "text/xml"}
+}
+
+func (xmlCodec) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	enc := xml.NewEncoder(w)
+	switch value := v.(type) {
+	case *store.Driver:
+		return enc.EncodeElement((*xmlDriver)(value), xml.StartElement{
+			Name: xml.Name{Local: "driver"},
+		})
+	case []*store.Driver:
+		drivers := xmlDrivers{Drivers: make([]*xmlDriver, 0, len(value))}
+		for _, driver := range value {
+			drivers.Drivers = append(drivers.Drivers, (*xmlDriver)(driver))
+		}
+		return enc.Encode(drivers)
+	}
+	return enc.Encode(v)
+}
+
+// Decode decodes a single XML element, only whitespace,
+// comments and processing instructions may follow it
+func (xmlCodec) Decode(r io.Reader, v interface{}) error {
+	dec := xml.NewDecoder(r)
+	switch value := v.(type) {
+	case *store.Driver:
+		if err := dec.Decode((*xmlDriver)(value)); err != nil {
+			return err
+		}
+	case *[]*store.Driver:
+		var drivers xmlDrivers
+		if err := dec.Decode(&drivers); err != nil {
+			return err
+		}
+		*value = make([]*store.Driver, 0, len(drivers.Drivers))
+		for _, driver := range drivers.Drivers {
+			*value = append(*value, (*store.Driver)(driver))
+		}
+	default:
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+	}
+	return xmlEnd(dec)
+}
+
+// xmlEnd reports data after the decoded element
+func xmlEnd(dec *xml.Decoder) error {
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.Comment, xml.ProcInst:
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return ErrTrailingData
+			}
+		default:
+			return ErrTrailingData
+		}
+	}
+}
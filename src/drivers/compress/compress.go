@@ -0,0 +1,216 @@
+// Package compress provides content codings of HTTP bodies of the Drivers API:
+// a negotiation of compressed responses and decompression of request bodies.
+package compress
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ErrUnsupportedEncoding is an error of a request body
+// compressed by an unknown or by several content codings
+var ErrUnsupportedEncoding = errors.New("content encoding of the request body is not supported")
+
+// Encoding is a content coding of HTTP bodies
+type Encoding interface {
+	// Name is a token of the coding in Content-Encoding and Accept-Encoding headers
+	Name() string
+	// NewWriter returns a writer compressing into w, it should be closed
+	// to flush the compressed body, w is not closed
+	NewWriter(w io.Writer) io.WriteCloser
+	// NewReader returns a reader decompressing r, errors of a malformed body
+	// are returned by Read, Close closes r
+	NewReader(r io.ReadCloser) io.ReadCloser
+}
+
+// Encodings
+var (
+	Gzip   Encoding = &encoding{name: "gzip", newWriter: newGzipWriter, newReader: newGzipReader}
+	Brotli Encoding = &encoding{name: "br", newWriter: newBrotliWriter, newReader: newBrotliReader}
+)
+
+// Default are encodings of the package, brotli is preferred,
+// it compresses JSON better than gzip
+var Default = Encodings{Brotli, Gzip}
+
+// Named returns encodings of the package by their names in the same order
+func Named(names ...string) (Encodings, error) {
+	encodings := make(Encodings, 0, len(names))
+	for _, name := range names {
+		enc := Default.byName(name)
+		if enc == nil {
+			return nil, errors.New("unknown content encoding " + strconv.Quote(name))
+		}
+		encodings = append(encodings, enc)
+	}
+	return encodings, nil
+}
+
+// Encodings is a list of encodings in order of preference of the server
+type Encodings []Encoding
+
+// Negotiate picks an encoding of a response by a value of Accept-Encoding
+// header according to quality values of codings, the preference
+// of the server breaks ties, nil means the response is not compressed
+func (e Encodings) Negotiate(acceptEncoding string) Encoding {
+	qs := parseAcceptEncoding(acceptEncoding)
+
+	var best Encoding
+	var bestQ float64
+	for _, enc := range e {
+		q, ok := qs[enc.Name()]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// Lookup picks an encoding of a request body by a value of Content-Encoding
+// header, nil means the body is not compressed
+func (e Encodings) Lookup(contentEncoding string) (Encoding, error) {
+	name := strings.ToLower(strings.TrimSpace(contentEncoding))
+	if name == "" || name == "identity" {
+		return nil, nil
+	}
+	if enc := e.byName(name); enc != nil {
+		return enc, nil
+	}
+	return nil, ErrUnsupportedEncoding
+}
+
+// byName returns the encoding of the name or of its alias (x-gzip)
+func (e Encodings) byName(name string) Encoding {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "x-gzip" {
+		name = "gzip"
+	}
+	for _, enc := range e {
+		if enc.Name() == name {
+			return enc
+		}
+	}
+	return nil
+}
+
+// parseAcceptEncoding returns quality values of codings of Accept-Encoding header,
+// codings with invalid quality values are skipped
+func parseAcceptEncoding(acceptEncoding string) map[string]float64 {
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+
+		q := 1.0
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			var err error
+			if q, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+				continue
+			}
+		}
+		qs[coding] = q
+	}
+	return qs
+}
+
+// encoding is an Encoding with pools of writers, they are costly to allocate
+type encoding struct {
+	name      string
+	newWriter func(w io.Writer) resetWriter
+	newReader func(r io.Reader) (io.Reader, error)
+	writers   sync.Pool
+}
+
+// resetWriter is a compressing writer which can be reused
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func (e *encoding) Name() string {
+	return e.name
+}
+
+func (e *encoding) NewWriter(w io.Writer) io.WriteCloser {
+	if zw, ok := e.writers.Get().(resetWriter); ok {
+		zw.Reset(w)
+		return &pooledWriter{zw, e}
+	}
+	return &pooledWriter{e.newWriter(w), e}
+}
+
+func (e *encoding) NewReader(r io.ReadCloser) io.ReadCloser {
+	return &lazyReader{src: r, newReader: e.newReader}
+}
+
+// pooledWriter returns the writer to the pool when it is closed
+type pooledWriter struct {
+	resetWriter
+	e *encoding
+}
+
+func (pw *pooledWriter) Close() error {
+	if pw.resetWriter == nil {
+		return nil
+	}
+	err := pw.resetWriter.Close()
+	pw.resetWriter.Reset(nil)
+	pw.e.writers.Put(pw.resetWriter)
+	pw.resetWriter = nil
+	return err
+}
+
+// lazyReader creates the decompressing reader on the first Read,
+// so errors of headers of a body are read errors
+type lazyReader struct {
+	src       io.ReadCloser
+	newReader func(r io.Reader) (io.Reader, error)
+	r         io.Reader
+	err       error
+}
+
+func (lr *lazyReader) Read(p []byte) (int, error) {
+	if lr.r == nil && lr.err == nil {
+		lr.r, lr.err = lr.newReader(lr.src)
+	}
+	if lr.err != nil {
+		return 0, lr.err
+	}
+	return lr.r.Read(p)
+}
+
+func (lr *lazyReader) Close() error {
+	return lr.src.Close()
+}
+
+func newGzipWriter(w io.Writer) resetWriter {
+	return gzip.NewWriter(w)
+}
+
+func newGzipReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+func newBrotliWriter(w io.Writer) resetWriter {
+	// level 5 is a usual trade-off between speed and ratio of dynamic responses
+	return brotli.NewWriterLevel(w, 5)
+}
+
+func newBrotliReader(r io.Reader) (io.Reader, error) {
+	return brotli.NewReader(r), nil
+}
@@ -0,0 +1,202 @@
+package compress_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/compress"
+)
+
+func name(enc compress.Encoding) string {
+	if enc == nil {
+		return "identity"
+	}
+	return enc.Name()
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		encodings      compress.Encodings
+		acceptEncoding string
+		expEncoding    compress.Encoding
+	}{
+		{
+			name:           "Empty",
+			encodings:      compress.Default,
+			acceptEncoding: "",
+		},
+		{
+			name:           "Gzip",
+			encodings:      compress.Default,
+			acceptEncoding: "gzip",
+			expEncoding:    compress.Gzip,
+		},
+		{
+			name:           "XGzip",
+			encodings:      compress.Default,
+			acceptEncoding: "x-gzip",
+			expEncoding:    compress.Gzip,
+		},
+		{
+			name:           "PreferenceOfServer",
+			encodings:      compress.Default,
+			acceptEncoding: "gzip, deflate, br",
+			expEncoding:    compress.Brotli,
+		},
+		{
+			name:           "QualityValues",
+			encodings:      compress.Default,
+			acceptEncoding: "br;q=0.5, gzip;q=0.8",
+			expEncoding:    compress.Gzip,
+		},
+		{
+			name:           "Any",
+			encodings:      compress.Default,
+			acceptEncoding: "*",
+			expEncoding:    compress.Brotli,
+		},
+		{
+			name:           "AnyButBrotli",
+			encodings:      compress.Default,
+			acceptEncoding: "*, br;q=0",
+			expEncoding:    compress.Gzip,
+		},
+		{
+			name:           "Identity",
+			encodings:      compress.Default,
+			acceptEncoding: "identity",
+		},
+		{
+			name:           "Unknown",
+			encodings:      compress.Default,
+			acceptEncoding: "zstd",
+		},
+		{
+			name:           "InvalidQuality",
+			encodings:      compress.Default,
+			acceptEncoding: "br;q=high, gzip",
+			expEncoding:    compress.Gzip,
+		},
+		{
+			name:           "NoEncodings",
+			acceptEncoding: "gzip, br",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			enc := tc.encodings.Negotiate(tc.acceptEncoding)
+			t.Log("enc =>", name(enc))
+			if enc != tc.expEncoding {
+				t.Error("Expected =>", name(tc.expEncoding))
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		contentEncoding string
+		expEncoding     compress.Encoding
+		expErr          error
+	}{
+		{
+			name:            "Empty",
+			contentEncoding: "",
+		},
+		{
+			name:            "Identity",
+			contentEncoding: "identity",
+		},
+		{
+			name:            "Gzip",
+			contentEncoding: "GZIP",
+			expEncoding:     compress.Gzip,
+		},
+		{
+			name:            "Brotli",
+			contentEncoding: "br",
+			expEncoding:     compress.Brotli,
+		},
+		{
+			name:            "Unknown",
+			contentEncoding: "deflate",
+			expErr:          compress.ErrUnsupportedEncoding,
+		},
+		{
+			name:            "Several",
+			contentEncoding: "gzip, br",
+			expErr:          compress.ErrUnsupportedEncoding,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			enc, err := compress.Default.Lookup(tc.contentEncoding)
+			t.Log("enc, err =>", name(enc), err)
+			if enc != tc.expEncoding {
+				t.Error("Expected =>", name(tc.expEncoding))
+			}
+			if err != tc.expErr {
+				t.Error("Expected =>", tc.expErr)
+			}
+		})
+	}
+}
+
+func TestNamed(t *testing.T) {
+	encodings, err := compress.Named("gzip", "br")
+	if err != nil {
+		t.Fatal("Unexpected error =>", err)
+	}
+	t.Log("encodings =>", len(encodings))
+	if len(encodings) != 2 || encodings[0] != compress.Gzip || encodings[1] != compress.Brotli {
+		t.Error("Expected =>", "gzip, br")
+	}
+
+	_, err = compress.Named("gzip", "zstd")
+	t.Log("err =>", err)
+	if err == nil || err.Error() != `unknown content encoding "zstd"` {
+		t.Error("Expected =>", `unknown content encoding "zstd"`)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	body := strings.Repeat(`{"id":1,"name":"John","license_number":"11-222-33"},`, 100)
+
+	for _, enc := range compress.Default {
+		t.Run(enc.Name(), func(t *testing.T) {
+			// writers are reused, so every body is compressed twice
+			for i := 0; i < 2; i++ {
+				var compressed bytes.Buffer
+				w := enc.NewWriter(&compressed)
+				if _, err := io.WriteString(w, body); err != nil {
+					t.Fatal("Unexpected error =>", err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal("Unexpected error =>", err)
+				}
+				t.Log("compressed.Len() =>", compressed.Len())
+				if compressed.Len() >= len(body)/10 {
+					t.Error("Expected less than =>", len(body)/10)
+				}
+
+				decompressed, err := io.ReadAll(enc.NewReader(io.NopCloser(&compressed)))
+				if err != nil {
+					t.Fatal("Unexpected error =>", err)
+				}
+				if string(decompressed) != body {
+					t.Error("Expected the body to be decompressed")
+				}
+			}
+		})
+	}
+
+	// errors of malformed bodies are read errors
+	r := compress.Gzip.NewReader(io.NopCloser(strings.NewReader(`[{"id":1}]`)))
+	_, err := io.ReadAll(r)
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected an error of the gzip header")
+	}
+}
@@ -0,0 +1,646 @@
+// Package config holds settings of the Drivers app runner.
+//
+// Settings are loaded from defaults, a YAML or TOML file, DRIVERS_* environment
+// variables and flags, every next source overrides the previous ones.
+// A flag "a.b_c" is "DRIVERS_A_B_C" environment variable and "b_c" key
+// of "a" section of the file.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/konjoot/drivers-go-kit/src/drivers/compress"
+	"github.com/konjoot/drivers-go-kit/src/drivers/keyring"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is a prefix of environment variables of settings
+const EnvPrefix = "DRIVERS_"
+
+// Redacted replaces secrets in the printed config
+const Redacted = "REDACTED"
+
+// Config is a typed set of settings of the Drivers app
+type Config struct {
+	File string `yaml:"-" toml:"-"`
+
+	HTTP        HTTP        `yaml:"http" toml:"http"`
+	TLS         TLS         `yaml:"tls" toml:"tls"`
+	Admin       Admin       `yaml:"admin" toml:"admin"`
+	DB          DB          `yaml:"db" toml:"db"`
+	Log         Log         `yaml:"log" toml:"log"`
+	Limits      Limits      `yaml:"limits" toml:"limits"`
+	Import      Import      `yaml:"import" toml:"import"`
+	Rules       Rules       `yaml:"rules" toml:"rules"`
+	Reload      Reload      `yaml:"reload" toml:"reload"`
+	Auth        Auth        `yaml:"auth" toml:"auth"`
+	RateLimit   RateLimit   `yaml:"ratelimit" toml:"ratelimit"`
+	API         API         `yaml:"api" toml:"api"`
+	Tracing     Tracing     `yaml:"tracing" toml:"tracing"`
+	Health      Health      `yaml:"health" toml:"health"`
+	Shutdown    Shutdown    `yaml:"shutdown" toml:"shutdown"`
+	Migrate     Migrate     `yaml:"migrate" toml:"migrate"`
+	Crypto      Crypto      `yaml:"crypto" toml:"crypto"`
+	CORS        CORS        `yaml:"cors" toml:"cors"`
+	Compression Compression `yaml:"compression" toml:"compression"`
+}
+
+// HTTP settings of the API server
+type HTTP struct {
+	Addr           string `yaml:"addr" toml:"addr"`
+	AssetsDir      string `yaml:"assets_dir" toml:"assets_dir"`
+	H2C            bool   `yaml:"h2c" toml:"h2c"`
+	TrustedProxies int    `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+// TLS settings of the API server
+type TLS struct {
+	Cert          string        `yaml:"cert" toml:"cert"`
+	Key           string        `yaml:"key" toml:"key"`
+	ClientCA      string        `yaml:"client_ca" toml:"client_ca"`
+	WatchInterval time.Duration `yaml:"watch_interval" toml:"watch_interval"`
+}
+
+// Admin settings of the admin server
+type Admin struct {
+	Addr string `yaml:"addr" toml:"addr"`
+}
+
+// DB settings of the connection pool and migrations
+type DB struct {
+	URL           string `yaml:"url" toml:"url"`
+	PoolSize      int    `yaml:"pool_size" toml:"pool_size"`
+	MigrationsDir string `yaml:"migrations_dir" toml:"migrations_dir"`
+}
+
+// Log settings
+type Log struct {
+	Format string `yaml:"format" toml:"format"`
+	Level  string `yaml:"level" toml:"level"`
+}
+
+// Limits of the API server
+type Limits struct {
+	ReadHeaderTimeout        time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout              time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout             time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout              time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes           int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	MaxBodyBytes             int64         `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	MaxDecompressedBodyBytes int64         `yaml:"max_decompressed_body_bytes" toml:"max_decompressed_body_bytes"`
+}
+
+// Import settings, they are reloadable
+type Import struct {
+	MaxBatchSize int `yaml:"max_batch_size" toml:"max_batch_size"`
+}
+
+// Rules of validation of drivers, they are reloadable
+type Rules struct {
+	NameMinLength        int    `yaml:"name_min_length" toml:"name_min_length"`
+	NameMaxLength        int    `yaml:"name_max_length" toml:"name_max_length"`
+	LicenseNumberPattern string `yaml:"license_number_pattern" toml:"license_number_pattern"`
+}
+
+// Reload settings
+type Reload struct {
+	WatchInterval time.Duration `yaml:"watch_interval" toml:"watch_interval"`
+}
+
+// Auth settings of authentication
+type Auth struct {
+	APIKeys        bool          `yaml:"api_keys" toml:"api_keys"`
+	JWKS           string        `yaml:"jwks" toml:"jwks"`
+	JWKSRefresh    time.Duration `yaml:"jwks_refresh" toml:"jwks_refresh"`
+	JWTIssuer      string        `yaml:"jwt_issuer" toml:"jwt_issuer"`
+	JWTAudience    string        `yaml:"jwt_audience" toml:"jwt_audience"`
+	JWTScopeClaim  string        `yaml:"jwt_scope_claim" toml:"jwt_scope_claim"`
+	JWTTenantClaim string        `yaml:"jwt_tenant_claim" toml:"jwt_tenant_claim"`
+	JWTPermissions string        `yaml:"jwt_permissions" toml:"jwt_permissions"`
+	JWTLeeway      time.Duration `yaml:"jwt_leeway" toml:"jwt_leeway"`
+}
+
+// RateLimit settings of token buckets of clients, they are reloadable,
+// a zero rate disables the limit
+type RateLimit struct {
+	ReadRate    float64 `yaml:"read_rate" toml:"read_rate"`
+	ReadBurst   int     `yaml:"read_burst" toml:"read_burst"`
+	ImportRate  float64 `yaml:"import_rate" toml:"import_rate"`
+	ImportBurst int     `yaml:"import_burst" toml:"import_burst"`
+	IPRate      float64 `yaml:"ip_rate" toml:"ip_rate"`
+	IPBurst     int     `yaml:"ip_burst" toml:"ip_burst"`
+}
+
+// API settings of versions
+type API struct {
+	V1Sunset       string `yaml:"v1_sunset" toml:"v1_sunset"`
+	StrictDecoding bool   `yaml:"strict_decoding" toml:"strict_decoding"`
+	RedactErrors   bool   `yaml:"redact_errors" toml:"redact_errors"`
+}
+
+// Tracing settings
+type Tracing struct {
+	Exporter string `yaml:"exporter" toml:"exporter"`
+}
+
+// Health settings of probes
+type Health struct {
+	DrainDelay time.Duration `yaml:"drain_delay" toml:"drain_delay"`
+}
+
+// Shutdown settings
+type Shutdown struct {
+	GracePeriod time.Duration `yaml:"grace_period" toml:"grace_period"`
+}
+
+// Migrate settings
+type Migrate struct {
+	OnStart bool `yaml:"on_start" toml:"on_start"`
+}
+
+// Crypto settings of encryption of license numbers, the keyring
+// is "id:key,id:key,index:key" of base64 encoded 32-byte keys,
+// the first key encrypts, the rest decrypt values of previous keys
+type Crypto struct {
+	Keys     string `yaml:"keys" toml:"keys"`
+	KeysFile string `yaml:"keys_file" toml:"keys_file"`
+}
+
+// CORS settings of cross-origin requests of browsers,
+// lists are comma-separated, no origins disable CORS
+type CORS struct {
+	AllowedOrigins   string        `yaml:"allowed_origins" toml:"allowed_origins"`
+	AllowedMethods   string        `yaml:"allowed_methods" toml:"allowed_methods"`
+	AllowedHeaders   string        `yaml:"allowed_headers" toml:"allowed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age"`
+}
+
+// Compression settings of responses, encodings are
+// a comma-separated list in order of preference
+type Compression struct {
+	Encodings string `yaml:"encodings" toml:"encodings"`
+	MinBytes  int    `yaml:"min_bytes" toml:"min_bytes"`
+}
+
+// Default returns default settings, DATABASE_URL and PORT
+// environment variables (used on Heroku) are defaults too
+func Default(getenv func(string) string) Config {
+	c := Config{
+		HTTP:  HTTP{Addr: ":8080"},
+		TLS:   TLS{WatchInterval: 10 * time.Second},
+		Admin: Admin{Addr: ":8081"},
+		DB: DB{
+			URL:      "postgres://drivers@localhost/drivers_dev?sslmode=disable",
+			PoolSize: 16,
+		},
+		Log: Log{Format: "logfmt", Level: "info"},
+		Limits: Limits{
+			ReadHeaderTimeout:        10 * time.Second,
+			ReadTimeout:              30 * time.Second,
+			WriteTimeout:             30 * time.Second,
+			IdleTimeout:              2 * time.Minute,
+			MaxHeaderBytes:           1 << 20,
+			MaxBodyBytes:             1 << 20,
+			MaxDecompressedBodyBytes: 16 << 20,
+		},
+		Import: Import{MaxBatchSize: 1000},
+		Rules: Rules{
+			NameMinLength:        4,
+			NameMaxLength:        1000,
+			LicenseNumberPattern: `^[0-9]{2}-[0-9]{3}-[0-9]{2}$`,
+		},
+		Auth: Auth{
+			JWKSRefresh:   time.Hour,
+			JWTScopeClaim: "scope",
+			JWTLeeway:     30 * time.Second,
+		},
+		RateLimit: RateLimit{
+			ReadRate:    20,
+			ReadBurst:   40,
+			ImportRate:  1,
+			ImportBurst: 5,
+			IPRate:      50,
+			IPBurst:     100,
+		},
+		CORS: CORS{
+			AllowedMethods: "GET,POST,PUT",
+			AllowedHeaders: "Authorization,Content-Type,If-Match,If-None-Match,X-API-Key,X-Request-ID,X-Tenant-ID,Traceparent",
+			MaxAge:         10 * time.Minute,
+		},
+		Compression: Compression{
+			Encodings: "br,gzip",
+			MinBytes:  1024,
+		},
+		API:      API{RedactErrors: true, V1Sunset: "2027-10-19"},
+		Health:   Health{DrainDelay: 5 * time.Second},
+		Shutdown: Shutdown{GracePeriod: 25 * time.Second},
+		Migrate:  Migrate{OnStart: true},
+	}
+
+	if dbURL := getenv("DATABASE_URL"); dbURL != "" {
+		c.DB.URL = dbURL
+	}
+	if port := getenv("PORT"); port != "" {
+		c.HTTP.Addr = ":" + port
+	}
+	// the Heroku router appends IPs of clients to X-Forwarded-For
+	if getenv("DYNO") != "" {
+		c.HTTP.TrustedProxies = 1
+	}
+	return c
+}
+
+// flagSet binds flags to fields of c
+func (c *Config) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	fs.StringVar(&c.File, "config", c.File, "YAML (.yaml, .yml) or TOML (.toml) config file")
+
+	fs.StringVar(&c.HTTP.Addr, "http.addr", c.HTTP.Addr, "HTTP listen address")
+	fs.StringVar(&c.HTTP.AssetsDir, "http.assets_dir", c.HTTP.AssetsDir, "Directory with API documentation assets, empty means assets embedded into the binary")
+	fs.BoolVar(&c.HTTP.H2C, "http.h2c", c.HTTP.H2C, "Serve HTTP/2 without TLS (h2c with prior knowledge) to internal clients, HTTP/1.1 is served anyway; set it only if the listener is not reachable publicly")
+	fs.IntVar(&c.HTTP.TrustedProxies, "http.trusted_proxies", c.HTTP.TrustedProxies, "Number of reverse proxies in front of the app appending to X-Forwarded-For, IPs of clients are taken from it for rate limits, audit events and logs, 0 trusts remote addresses only (1 on Heroku)")
+	fs.StringVar(&c.TLS.Cert, "tls.cert", c.TLS.Cert, "PEM certificate file of the API server, it enables HTTPS")
+	fs.StringVar(&c.TLS.Key, "tls.key", c.TLS.Key, "PEM private key file of the certificate")
+	fs.StringVar(&c.TLS.ClientCA, "tls.client_ca", c.TLS.ClientCA, "PEM file of CAs verifying client certificates, it enables mutual TLS")
+	fs.DurationVar(&c.TLS.WatchInterval, "tls.watch_interval", c.TLS.WatchInterval, "Interval of checks of the certificate files, modified ones are reloaded, 0 disables checks")
+	fs.StringVar(&c.Admin.Addr, "admin.addr", c.Admin.Addr, "Admin HTTP listen address for metrics, pprof and diagnostics, empty disables it")
+
+	fs.StringVar(&c.DB.URL, "db.url", c.DB.URL, "DB connection URL")
+	fs.IntVar(&c.DB.PoolSize, "db.pool_size", c.DB.PoolSize, "Number of idle connections allowed")
+	fs.StringVar(&c.DB.MigrationsDir, "db.migrations_dir", c.DB.MigrationsDir, "Directory with SQL migrations, empty means migrations embedded into the binary")
+
+	fs.StringVar(&c.Log.Format, "log.format", c.Log.Format, "Log format: logfmt or json")
+	fs.StringVar(&c.Log.Level, "log.level", c.Log.Level, "Minimal level of logged records: debug, info, warn, error or none (reloadable)")
+
+	fs.DurationVar(&c.Limits.ReadHeaderTimeout, "limits.read_header_timeout", c.Limits.ReadHeaderTimeout, "Time limit of reading request headers")
+	fs.DurationVar(&c.Limits.ReadTimeout, "limits.read_timeout", c.Limits.ReadTimeout, "Time limit of reading a whole request")
+	fs.DurationVar(&c.Limits.WriteTimeout, "limits.write_timeout", c.Limits.WriteTimeout, "Time limit of writing a response")
+	fs.DurationVar(&c.Limits.IdleTimeout, "limits.idle_timeout", c.Limits.IdleTimeout, "Time limit of waiting for the next request on a keep-alive connection")
+	fs.IntVar(&c.Limits.MaxHeaderBytes, "limits.max_header_bytes", c.Limits.MaxHeaderBytes, "Size limit of request headers")
+	fs.Int64Var(&c.Limits.MaxBodyBytes, "limits.max_body_bytes", c.Limits.MaxBodyBytes, "Size limit of request bodies, larger ones are rejected with 413, 0 disables the limit")
+	fs.Int64Var(&c.Limits.MaxDecompressedBodyBytes, "limits.max_decompressed_body_bytes", c.Limits.MaxDecompressedBodyBytes, "Size limit of decompressed bodies of imports (Content-Encoding gzip or br), larger ones are rejected with 413, 0 rejects compressed bodies")
+
+	fs.IntVar(&c.Import.MaxBatchSize, "import.max_batch_size", c.Import.MaxBatchSize, "Max number of drivers in an import (reloadable)")
+	fs.IntVar(&c.Rules.NameMinLength, "rules.name_min_length", c.Rules.NameMinLength, "Min length of a driver's name in UTF-8 symbols (reloadable)")
+	fs.IntVar(&c.Rules.NameMaxLength, "rules.name_max_length", c.Rules.NameMaxLength, "Max length of a driver's name in UTF-8 symbols (reloadable)")
+	fs.StringVar(&c.Rules.LicenseNumberPattern, "rules.license_number_pattern", c.Rules.LicenseNumberPattern, "Regular expression of valid license numbers (reloadable)")
+	fs.DurationVar(&c.Reload.WatchInterval, "reload.watch_interval", c.Reload.WatchInterval, "Interval of checks of the config file for changes, settings are reloaded on SIGHUP as well, 0 disables checks")
+
+	fs.BoolVar(&c.Auth.APIKeys, "auth.api_keys", c.Auth.APIKeys, "Authenticate requests by API keys (X-API-Key header), they are managed by \"keys\" subcommand and /api/v2/keys; it is off by default, so clients without keys keep working until they are issued")
+	fs.StringVar(&c.Auth.JWKS, "auth.jwks", c.Auth.JWKS, "JWKS file or http(s) URL with public keys of SSO, it enables authentication by bearer tokens (JWT)")
+	fs.DurationVar(&c.Auth.JWKSRefresh, "auth.jwks_refresh", c.Auth.JWKSRefresh, "Interval of refreshes of the JWKS, it is refreshed earlier if a token is signed by an unknown key")
+	fs.StringVar(&c.Auth.JWTIssuer, "auth.jwt_issuer", c.Auth.JWTIssuer, "Expected issuer (iss) of bearer tokens")
+	fs.StringVar(&c.Auth.JWTAudience, "auth.jwt_audience", c.Auth.JWTAudience, "Expected audience (aud) of bearer tokens")
+	fs.StringVar(&c.Auth.JWTScopeClaim, "auth.jwt_scope_claim", c.Auth.JWTScopeClaim, "Claim of bearer tokens with permissions, a space-separated string or an array of strings")
+	fs.StringVar(&c.Auth.JWTTenantClaim, "auth.jwt_tenant_claim", c.Auth.JWTTenantClaim, "Claim of bearer tokens with a tenant the subject is bound to, tokens without it are rejected; subjects belong to the default tenant if it is empty")
+	fs.StringVar(&c.Auth.JWTPermissions, "auth.jwt_permissions", c.Auth.JWTPermissions, "Scopes of permissions of bearer tokens, e.g. \"importer=drivers:import,importer=drivers:read,viewer=drivers:read\", permissions which are scopes are kept anyway")
+	fs.DurationVar(&c.Auth.JWTLeeway, "auth.jwt_leeway", c.Auth.JWTLeeway, "Allowed clock skew of checks of expiration of bearer tokens")
+
+	fs.Float64Var(&c.RateLimit.ReadRate, "ratelimit.read_rate", c.RateLimit.ReadRate, "Requests per second of a client to read endpoints, 0 disables the limit (reloadable)")
+	fs.IntVar(&c.RateLimit.ReadBurst, "ratelimit.read_burst", c.RateLimit.ReadBurst, "Burst of requests of a client to read endpoints (reloadable)")
+	fs.Float64Var(&c.RateLimit.ImportRate, "ratelimit.import_rate", c.RateLimit.ImportRate, "Requests per second of a client to import and update endpoints, 0 disables the limit (reloadable)")
+	fs.IntVar(&c.RateLimit.ImportBurst, "ratelimit.import_burst", c.RateLimit.ImportBurst, "Burst of requests of a client to import and update endpoints (reloadable)")
+	fs.Float64Var(&c.RateLimit.IPRate, "ratelimit.ip_rate", c.RateLimit.IPRate, "Requests per second of an IP to any endpoint, they are limited before authentication, 0 disables the limit (reloadable)")
+	fs.IntVar(&c.RateLimit.IPBurst, "ratelimit.ip_burst", c.RateLimit.IPBurst, "Burst of requests of an IP to any endpoint (reloadable)")
+
+	fs.StringVar(&c.API.V1Sunset, "api.v1_sunset", c.API.V1Sunset, "Date (YYYY-MM-DD) when API v1 is switched off, announced in Sunset header")
+	fs.BoolVar(&c.API.StrictDecoding, "api.strict_decoding", c.API.StrictDecoding, "Reject unknown fields of JSON and MessagePack request bodies")
+	fs.BoolVar(&c.API.RedactErrors, "api.redact_errors", c.API.RedactErrors, "Mask license numbers and names in error responses, they are masked in logs anyway")
+	fs.StringVar(&c.Tracing.Exporter, "tracing.exporter", c.Tracing.Exporter, "Exporter of trace spans: stdout or otlp (configured by OTEL_EXPORTER_OTLP_* ENV), empty disables tracing")
+	fs.DurationVar(&c.Health.DrainDelay, "health.drain_delay", c.Health.DrainDelay, "Time between failing readiness probe and shutting HTTP-server down")
+	fs.DurationVar(&c.Shutdown.GracePeriod, "shutdown.grace_period", c.Shutdown.GracePeriod, "Time limit of graceful shutdown including draining of in-flight imports")
+	fs.BoolVar(&c.Migrate.OnStart, "migrate.on_start", c.Migrate.OnStart, "Apply pending migrations on start, disable it if migrations are applied by \"migrate\" subcommand")
+	fs.StringVar(&c.Crypto.Keys, "crypto.keys", c.Crypto.Keys, "Keyring encrypting license numbers, \"id:key,...,index:key\" of base64 encoded 32-byte keys, the first one is current, prefer DRIVERS_CRYPTO_KEYS to the flag")
+	fs.StringVar(&c.CORS.AllowedOrigins, "cors.allowed_origins", c.CORS.AllowedOrigins, "Origins allowed to call the API from browsers, e.g. \"https://fleet.example.com\", * allows any origin, empty disables CORS")
+	fs.StringVar(&c.CORS.AllowedMethods, "cors.allowed_methods", c.CORS.AllowedMethods, "Methods allowed to cross-origin requests")
+	fs.StringVar(&c.CORS.AllowedHeaders, "cors.allowed_headers", c.CORS.AllowedHeaders, "Request headers allowed to cross-origin requests, * allows any header")
+	fs.BoolVar(&c.CORS.AllowCredentials, "cors.allow_credentials", c.CORS.AllowCredentials, "Allow credentials (cookies, client certificates, Authorization header) of cross-origin requests")
+	fs.DurationVar(&c.CORS.MaxAge, "cors.max_age", c.CORS.MaxAge, "Time browsers cache preflight responses for, 0 leaves it to browsers")
+	fs.StringVar(&c.Compression.Encodings, "compression.encodings", c.Compression.Encodings, "Encodings of responses (br, gzip) in order of preference, negotiated by Accept-Encoding header, empty disables compression")
+	fs.IntVar(&c.Compression.MinBytes, "compression.min_bytes", c.Compression.MinBytes, "Minimal size of compressed responses, smaller ones are not worth it")
+	fs.StringVar(&c.Crypto.KeysFile, "crypto.keys_file", c.Crypto.KeysFile, "File of the keyring, a key per line, instead of crypto.keys")
+
+	return fs
+}
+
+// Load loads settings from defaults, the config file, environment
+// and args, flags may be interleaved with positional arguments
+// (e.g. subcommands), which are returned
+func Load(name string, args []string, getenv func(string) string, output io.Writer) (Config, []string, error) {
+	c := Default(getenv)
+	fs := c.flagSet(name)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(output, "Usage of %s:\n", name)
+		fs.PrintDefaults()
+		fmt.Fprintf(output, "\nEvery flag can be set by %s* environment variable, e.g. -db.pool_size by %s\n",
+			EnvPrefix, EnvName("db.pool_size"))
+	}
+
+	// flags are parsed first to find the config file,
+	// then they are applied once again to override the file and environment
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return c, nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	file := c.File
+	if file == "" {
+		file = getenv(EnvName("config"))
+	}
+	c = Default(getenv)
+	c.File = file
+	if file != "" {
+		if err := c.loadFile(file); err != nil {
+			return c, positional, err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := explicit[f.Name]
+		if !ok {
+			value, ok = lookupEnv(getenv, EnvName(f.Name))
+		}
+		if ok && err == nil {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %v", value, f.Name, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return c, positional, err
+	}
+
+	return c, positional, c.Validate()
+}
+
+// EnvName returns a name of the environment variable of the flag
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+func lookupEnv(getenv func(string) string, name string) (string, bool) {
+	value := getenv(name)
+	return value, value != ""
+}
+
+// loadFile decodes the file into c, the format is chosen by the extension
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unknown format of config file %s; should be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate reports all invalid settings at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.HTTP.Addr != "", "http.addr should not be empty")
+	check(c.HTTP.TrustedProxies >= 0, "http.trusted_proxies should not be negative")
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls.cert and tls.key should be set together")
+	check(c.TLS.ClientCA == "" || c.TLS.Cert != "", "tls.client_ca requires tls.cert and tls.key")
+	check(c.TLS.WatchInterval >= 0, "tls.watch_interval should not be negative")
+	check(c.DB.URL != "", "db.url should not be empty")
+	check(c.DB.PoolSize > 0, "db.pool_size should be greater than 0, but not %d", c.DB.PoolSize)
+	check(oneOf(c.Log.Format, "logfmt", "json"), "log.format should be logfmt or json, but not %q", c.Log.Format)
+	check(oneOf(c.Log.Level, "debug", "info", "warn", "error", "none"),
+		"log.level should be debug, info, warn, error or none, but not %q", c.Log.Level)
+	check(c.Limits.ReadHeaderTimeout >= 0, "limits.read_header_timeout should not be negative")
+	check(c.Limits.ReadTimeout >= 0, "limits.read_timeout should not be negative")
+	check(c.Limits.WriteTimeout >= 0, "limits.write_timeout should not be negative")
+	check(c.Limits.IdleTimeout >= 0, "limits.idle_timeout should not be negative")
+	check(c.Limits.MaxHeaderBytes >= 0, "limits.max_header_bytes should not be negative")
+	check(c.Limits.MaxBodyBytes >= 0, "limits.max_body_bytes should not be negative")
+	check(c.Limits.MaxDecompressedBodyBytes >= 0, "limits.max_decompressed_body_bytes should not be negative")
+	check(c.Import.MaxBatchSize > 0, "import.max_batch_size should be greater than 0, but not %d", c.Import.MaxBatchSize)
+	check(c.Rules.NameMinLength > 0 && c.Rules.NameMinLength <= c.Rules.NameMaxLength,
+		"rules.name_min_length should be from 1 to rules.name_max_length %d, but not %d",
+		c.Rules.NameMaxLength, c.Rules.NameMinLength)
+	_, err := regexp.Compile(c.Rules.LicenseNumberPattern)
+	check(err == nil, "rules.license_number_pattern should be a regular expression: %v", err)
+	check(c.Reload.WatchInterval >= 0, "reload.watch_interval should not be negative")
+	if c.Auth.JWKS != "" {
+		check(c.Auth.JWKSRefresh > 0, "auth.jwks_refresh should be greater than 0")
+		check(c.Auth.JWTIssuer != "", "auth.jwt_issuer is required by auth.jwks")
+		check(c.Auth.JWTAudience != "", "auth.jwt_audience is required by auth.jwks")
+		check(c.Auth.JWTScopeClaim != "", "auth.jwt_scope_claim should not be empty")
+		check(c.Auth.JWTTenantClaim != c.Auth.JWTScopeClaim, "auth.jwt_tenant_claim should differ from auth.jwt_scope_claim")
+		check(c.Auth.JWTLeeway >= 0, "auth.jwt_leeway should not be negative")
+		_, err := c.JWTPermissions()
+		check(err == nil, "auth.jwt_permissions should be a list of permission=scope, but not %q", c.Auth.JWTPermissions)
+	}
+	check(c.RateLimit.ReadRate >= 0, "ratelimit.read_rate should not be negative")
+	check(c.RateLimit.ReadRate == 0 || c.RateLimit.ReadBurst > 0,
+		"ratelimit.read_burst should be greater than 0, but not %d", c.RateLimit.ReadBurst)
+	check(c.RateLimit.ImportRate >= 0, "ratelimit.import_rate should not be negative")
+	check(c.RateLimit.ImportRate == 0 || c.RateLimit.ImportBurst > 0,
+		"ratelimit.import_burst should be greater than 0, but not %d", c.RateLimit.ImportBurst)
+	check(c.RateLimit.IPRate >= 0, "ratelimit.ip_rate should not be negative")
+	check(c.RateLimit.IPRate == 0 || c.RateLimit.IPBurst > 0,
+		"ratelimit.ip_burst should be greater than 0, but not %d", c.RateLimit.IPBurst)
+	if c.API.V1Sunset != "" {
+		_, err := c.V1Sunset()
+		check(err == nil, "api.v1_sunset should be a date (YYYY-MM-DD), but not %q", c.API.V1Sunset)
+	}
+	check(oneOf(c.Tracing.Exporter, "", "none", "stdout", "otlp"),
+		"tracing.exporter should be stdout, otlp or empty, but not %q", c.Tracing.Exporter)
+	check(c.Health.DrainDelay >= 0, "health.drain_delay should not be negative")
+	check(c.Shutdown.GracePeriod > 0, "shutdown.grace_period should be greater than 0")
+	for _, origin := range List(c.CORS.AllowedOrigins) {
+		u, err := url.Parse(origin)
+		check(origin == "*" || err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == "",
+			"cors.allowed_origins should be * or origins like https://example.com, but not %q", origin)
+	}
+	check(!c.CORS.AllowCredentials || !oneOf("*", List(c.CORS.AllowedOrigins)...),
+		"cors.allow_credentials requires origins listed in cors.allowed_origins, but not *")
+	check(c.CORS.MaxAge >= 0, "cors.max_age should not be negative")
+	_, err = c.Encodings()
+	check(err == nil, "compression.encodings should be a list of br and gzip: %v", err)
+	check(c.Compression.MinBytes >= 0, "compression.min_bytes should not be negative")
+	check(c.Crypto.Keys == "" || c.Crypto.KeysFile == "", "crypto.keys and crypto.keys_file should not be set together")
+	if c.Crypto.Keys != "" {
+		_, err := keyring.Parse(c.Crypto.Keys)
+		check(err == nil, "crypto.keys should be a keyring: %v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// reloadable are names of settings which are applied without restart
+var reloadable = map[string]bool{
+	"log.level":                    true,
+	"import.max_batch_size":        true,
+	"rules.name_min_length":        true,
+	"rules.name_max_length":        true,
+	"rules.license_number_pattern": true,
+	"ratelimit.read_rate":          true,
+	"ratelimit.read_burst":         true,
+	"ratelimit.import_rate":        true,
+	"ratelimit.import_burst":       true,
+	"ratelimit.ip_rate":            true,
+	"ratelimit.ip_burst":           true,
+}
+
+// Changes returns names of settings which differ in next,
+// they are split into reloadable and static ones (which need a restart)
+func (c Config) Changes(next Config) (reloadableNames, staticNames []string) {
+	values := make(map[string]string)
+	c.flagSet("").VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	next.flagSet("").VisitAll(func(f *flag.Flag) {
+		if values[f.Name] == f.Value.String() {
+			return
+		}
+		if reloadable[f.Name] {
+			reloadableNames = append(reloadableNames, f.Name)
+		} else {
+			staticNames = append(staticNames, f.Name)
+		}
+	})
+	return reloadableNames, staticNames
+}
+
+// V1Sunset returns the date when API v1 is switched off,
+// it is zero if the date is not set
+func (c Config) V1Sunset() (time.Time, error) {
+	if c.API.V1Sunset == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", c.API.V1Sunset)
+}
+
+// JWTPermissions returns scopes of permissions of bearer tokens,
+// a permission may be listed several times to grant several scopes
+func (c Config) JWTPermissions() (map[string][]string, error) {
+	permissions := make(map[string][]string)
+	if strings.TrimSpace(c.Auth.JWTPermissions) == "" {
+		return permissions, nil
+	}
+	for _, pair := range strings.Split(c.Auth.JWTPermissions, ",") {
+		permission, scope, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || permission == "" || scope == "" {
+			return nil, fmt.Errorf("invalid permission %q", pair)
+		}
+		permissions[permission] = append(permissions[permission], scope)
+	}
+	return permissions, nil
+}
+
+// Encodings returns encodings of compression.encodings,
+// there are none if compression is disabled
+func (c Config) Encodings() (compress.Encodings, error) {
+	return compress.Named(List(c.Compression.Encodings)...)
+}
+
+// Keyring returns the keyring of crypto.keys or crypto.keys_file,
+// it is nil if license numbers are not encrypted
+func (c Config) Keyring() (*keyring.Keyring, error) {
+	switch {
+	case c.Crypto.Keys != "":
+		return keyring.Parse(c.Crypto.Keys)
+	case c.Crypto.KeysFile != "":
+		return keyring.Load(c.Crypto.KeysFile)
+	}
+	return nil, nil
+}
+
+// Redact returns a copy of c without secrets
+func (c Config) Redact() Config {
+	c.DB.URL = redactURL(c.DB.URL)
+	if c.Crypto.Keys != "" {
+		c.Crypto.Keys = Redacted
+	}
+	return c
+}
+
+// Print writes redacted c in YAML
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redact()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// redactURL hides a password of the URL, the whole value
+// is hidden if it is not a URL (e.g. "host=... password=...")
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return Redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), Redacted)
+	}
+	query := u.Query()
+	if query.Get("password") != "" {
+		query.Set("password", Redacted)
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// List splits a comma-separated list of a setting, blanks are dropped
+func List(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func oneOf(s string, values ...string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
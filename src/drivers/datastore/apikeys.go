@@ -0,0 +1,128 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKeysStore is an interface for datastore of API keys,
+// keys are stored hashed, revoked keys are never returned;
+// keys are created, got by id, rotated and revoked within
+// the tenant of ctx (see WithTenant), but found by hash in any
+type APIKeysStore interface {
+	CreateAPIKey(context.Context, *APIKey) error
+	GetAPIKey(ctx context.Context, id uint64) (*APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash []byte) (*APIKey, error)
+	RotateAPIKey(ctx context.Context, id uint64, hash []byte) (*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uint64) error
+}
+
+// APIKey is a struct for API key representation,
+// ID, Tenant, CreatedAt and RotatedAt are maintained by the store;
+// a key is bound to drivers of its tenant
+type APIKey struct {
+	ID        uint64
+	Name      string
+	Hash      []byte
+	Scopes    []string
+	Tenant    string
+	CreatedAt time.Time
+	RotatedAt time.Time
+}
+
+// NewAPIKeysStore is a constructor for APIKeysStore
+func NewAPIKeysStore(db *sql.DB) (APIKeysStore, error) {
+	if db == nil {
+		return nil, errors.New("*sql.DB is required")
+	}
+	return &apiKeysStore{db: db}, nil
+}
+
+// apiKeysStore is an implementation of APIKeysStore
+type apiKeysStore struct {
+	db *sql.DB
+}
+
+// CreateAPIKey inserts the key and sets its ID, Tenant and CreatedAt
+func (ks *apiKeysStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	key.Tenant = TenantFromContext(ctx)
+	return ks.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys (name, hash, scopes, tenant_id)
+		      VALUES ($1, $2, $3, $4)
+		   RETURNING id, created_at`,
+		key.Name, key.Hash, pq.Array(key.Scopes), key.Tenant,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAPIKey selects a key which is not revoked by its id,
+// sql.ErrNoRows is returned if there is no such key
+func (ks *apiKeysStore) GetAPIKey(ctx context.Context, id uint64) (*APIKey, error) {
+	return scanAPIKey(ks.db.QueryRowContext(ctx,
+		`SELECT id, name, hash, scopes, tenant_id, created_at, rotated_at
+		   FROM api_keys
+		  WHERE tenant_id = $1 AND id = $2 AND revoked_at IS NULL`,
+		TenantFromContext(ctx), id,
+	))
+}
+
+// GetAPIKeyByHash selects a key which is not revoked by its hash,
+// sql.ErrNoRows is returned if there is no such key
+func (ks *apiKeysStore) GetAPIKeyByHash(ctx context.Context, hash []byte) (*APIKey, error) {
+	return scanAPIKey(ks.db.QueryRowContext(ctx,
+		`SELECT id, name, hash, scopes, tenant_id, created_at, rotated_at
+		   FROM api_keys
+		  WHERE hash = $1 AND revoked_at IS NULL`,
+		hash,
+	))
+}
+
+// RotateAPIKey replaces the hash of a key which is not revoked,
+// so the previous secret stops working at once,
+// sql.ErrNoRows is returned if there is no such key
+func (ks *apiKeysStore) RotateAPIKey(ctx context.Context, id uint64, hash []byte) (*APIKey, error) {
+	return scanAPIKey(ks.db.QueryRowContext(ctx,
+		`UPDATE api_keys
+		    SET hash = $3,
+		        rotated_at = now()
+		  WHERE tenant_id = $1 AND id = $2 AND revoked_at IS NULL
+		  RETURNING id, name, hash, scopes, tenant_id, created_at, rotated_at`,
+		TenantFromContext(ctx), id, hash,
+	))
+}
+
+// RevokeAPIKey marks a key as revoked,
+// sql.ErrNoRows is returned if there is no such key or it is already revoked
+func (ks *apiKeysStore) RevokeAPIKey(ctx context.Context, id uint64) error {
+	result, err := ks.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at = now() WHERE tenant_id = $1 AND id = $2 AND revoked_at IS NULL",
+		TenantFromContext(ctx), id,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanAPIKey(row *sql.Row) (*APIKey, error) {
+	var (
+		key       APIKey
+		rotatedAt sql.NullTime
+	)
+	err := row.Scan(&key.ID, &key.Name, &key.Hash, pq.Array(&key.Scopes), &key.Tenant, &key.CreatedAt, &rotatedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.RotatedAt = rotatedAt.Time
+	return &key, nil
+}
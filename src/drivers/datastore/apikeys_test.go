@@ -0,0 +1,174 @@
+package datastore_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+func TestAPIKeys(t *testing.T) {
+	dbName, db, err := prepareTestDB()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := dropTestDB(dbName); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	kStore, err := store.NewAPIKeysStore(db)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	ctx := store.WithTenant(context.Background(), "acme")
+	other := store.WithTenant(context.Background(), "globex")
+
+	key := &store.APIKey{
+		Name:   "importer",
+		Hash:   []byte("first hash"),
+		Scopes: []string{"drivers:read", "drivers:import"},
+	}
+	if err = kStore.CreateAPIKey(ctx, key); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Log("key.ID =>", key.ID)
+	if key.ID == 0 {
+		t.Error("Expected the id to be set")
+	}
+	t.Log("key.CreatedAt =>", key.CreatedAt)
+	if key.CreatedAt.IsZero() {
+		t.Error("Expected the creation time to be set")
+	}
+
+	got, err := kStore.GetAPIKey(ctx, key.ID)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Log("got.Name =>", got.Name)
+	if got.Name != "importer" {
+		t.Error("Expected =>", "importer")
+	}
+
+	found, err := kStore.GetAPIKeyByHash(ctx, []byte("first hash"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Log("found.Name =>", found.Name)
+	if found.Name != "importer" {
+		t.Error("Expected =>", "importer")
+	}
+	t.Log("found.Scopes =>", found.Scopes)
+	if fmt.Sprint(found.Scopes) != "[drivers:read drivers:import]" {
+		t.Error("Expected =>", "[drivers:read drivers:import]")
+	}
+	t.Log("found.Tenant =>", found.Tenant)
+	if found.Tenant != "acme" {
+		t.Error("Expected =>", "acme")
+	}
+
+	for _, tc := range []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "GetOfOtherTenant",
+			call: func() error {
+				_, err := kStore.GetAPIKey(other, key.ID)
+				return err
+			},
+		},
+		{
+			name: "RotateOfOtherTenant",
+			call: func() error {
+				_, err := kStore.RotateAPIKey(other, key.ID, []byte("other hash"))
+				return err
+			},
+		},
+		{
+			name: "RevokeOfOtherTenant",
+			call: func() error { return kStore.RevokeAPIKey(other, key.ID) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call()
+			t.Log("err =>", err)
+			if err != sql.ErrNoRows {
+				t.Error("Expected =>", sql.ErrNoRows)
+			}
+		})
+	}
+
+	rotated, err := kStore.RotateAPIKey(ctx, key.ID, []byte("second hash"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Log("rotated.Hash =>", string(rotated.Hash))
+	if !bytes.Equal(rotated.Hash, []byte("second hash")) {
+		t.Error("Expected =>", "second hash")
+	}
+	t.Log("rotated.RotatedAt =>", rotated.RotatedAt)
+	if rotated.RotatedAt.IsZero() {
+		t.Error("Expected the rotation time to be set")
+	}
+
+	_, err = kStore.GetAPIKeyByHash(ctx, []byte("first hash"))
+	t.Log("err =>", err)
+	if err != sql.ErrNoRows {
+		t.Error("Expected =>", sql.ErrNoRows)
+	}
+
+	if err = kStore.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Error(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "GetRevoked",
+			call: func() error {
+				_, err := kStore.GetAPIKeyByHash(ctx, []byte("second hash"))
+				return err
+			},
+		},
+		{
+			name: "RotateRevoked",
+			call: func() error {
+				_, err := kStore.RotateAPIKey(ctx, key.ID, []byte("third hash"))
+				return err
+			},
+		},
+		{
+			name: "RevokeRevoked",
+			call: func() error { return kStore.RevokeAPIKey(ctx, key.ID) },
+		},
+		{
+			name: "RevokeMissing",
+			call: func() error { return kStore.RevokeAPIKey(ctx, key.ID+1) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call()
+			t.Log("err =>", err)
+			if err != sql.ErrNoRows {
+				t.Error("Expected =>", sql.ErrNoRows)
+			}
+		})
+	}
+}
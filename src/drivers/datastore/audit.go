@@ -0,0 +1,280 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operations of audit events
+const (
+	AuditImport = "import"
+	AuditUpdate = "update"
+)
+
+// AuditStore is an interface for reading of audit events,
+// they are written by DriversStore in transactions of mutations
+type AuditStore interface {
+	ListAuditEvents(context.Context, AuditFilter) ([]*AuditEvent, error)
+}
+
+// AuditEvent is a change of a driver made by an actor
+type AuditEvent struct {
+	ID        uint64
+	DriverID  uint64
+	Operation string
+	Actor     string
+	RequestID string
+	SourceIP  string
+	// Before is nil if the driver is created
+	Before    *AuditValues
+	After     *AuditValues
+	CreatedAt time.Time
+}
+
+// AuditValues are values of a driver before or after a change
+type AuditValues struct {
+	Name          string `json:"name"`
+	LicenseNumber string `json:"license_number"`
+}
+
+// auditValues are AuditValues stored in audit_events,
+// LicenseNumberEnc replaces LicenseNumber if a cipher is set
+type auditValues struct {
+	Name             string `json:"name"`
+	LicenseNumber    string `json:"license_number,omitempty"`
+	LicenseNumberEnc []byte `json:"license_number_enc,omitempty"`
+}
+
+// AuditFilter selects up to Limit events with ids greater than AfterID
+// created since Since, they are events of DriverID if it is not 0
+type AuditFilter struct {
+	DriverID uint64
+	Since    time.Time
+	AfterID  uint64
+	Limit    int
+}
+
+// Actor is who changes drivers, it is recorded in audit events
+type Actor struct {
+	Subject   string
+	RequestID string
+	SourceIP  string
+}
+
+// ctxKey type is needed to avoid
+// key collisions in context
+type ctxKey int
+
+const (
+	actorKey ctxKey = iota
+	tenantKey
+)
+
+// WithActor returns a copy of ctx which carries the actor
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey, a)
+}
+
+// ActorFromContext returns the actor stored in ctx
+func ActorFromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey).(Actor)
+	return a
+}
+
+// AuditStoreOption sets an optional parameter of AuditStore
+type AuditStoreOption func(*auditStore)
+
+// WithAuditCipher decrypts license numbers of audit events,
+// they are encrypted by DriversStore of the same cipher
+func WithAuditCipher(c Cipher) AuditStoreOption {
+	return func(as *auditStore) { as.cipher = c }
+}
+
+// NewAuditStore is a constructor for AuditStore
+func NewAuditStore(db *sql.DB, opts ...AuditStoreOption) (AuditStore, error) {
+	if db == nil {
+		return nil, errors.New("*sql.DB is required")
+	}
+	as := &auditStore{db: db}
+	for _, opt := range opts {
+		opt(as)
+	}
+	return as, nil
+}
+
+// auditStore is an implementation of AuditStore,
+// license numbers are decrypted if cipher is set
+type auditStore struct {
+	db     *sql.DB
+	cipher Cipher
+}
+
+// ListAuditEvents selects events of the tenant of ctx by the filter ordered by id,
+// so the last id of a page is a cursor for the next one
+func (as *auditStore) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]*AuditEvent, error) {
+	tenant := TenantFromContext(ctx)
+	rows, err := as.db.QueryContext(ctx,
+		`SELECT id, driver_id, operation, actor, request_id, source_ip, before, after, created_at
+		   FROM audit_events
+		  WHERE tenant_id = $1
+		    AND ($2::bigint = 0 OR driver_id = $2)
+		    AND created_at >= $3
+		    AND id > $4
+		  ORDER BY id
+		  LIMIT $5`,
+		tenant, filter.DriverID, filter.Since, filter.AfterID, filter.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+	for rows.Next() {
+		var before, after []byte
+		event := &AuditEvent{}
+		err = rows.Scan(
+			&event.ID,
+			&event.DriverID,
+			&event.Operation,
+			&event.Actor,
+			&event.RequestID,
+			&event.SourceIP,
+			&before,
+			&after,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if before != nil {
+			if event.Before, err = decodeAuditValues(as.cipher, tenant, event.DriverID, before); err != nil {
+				return nil, err
+			}
+		}
+		if event.After, err = decodeAuditValues(as.cipher, tenant, event.DriverID, after); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// insertAuditEvents inserts events of the actor and the tenant of ctx in the transaction,
+// license numbers are encrypted if the cipher is not nil
+func insertAuditEvents(ctx context.Context, tx *sql.Tx, c Cipher, operation string, events []*AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var (
+		actor  = ActorFromContext(ctx)
+		tenant = TenantFromContext(ctx)
+		values []string
+		attrs  = []interface{}{tenant}
+	)
+	for i, event := range events {
+		var before []byte
+		if event.Before != nil {
+			b, err := encodeAuditValues(c, tenant, event.DriverID, event.Before)
+			if err != nil {
+				return err
+			}
+			before = b
+		}
+		after, err := encodeAuditValues(c, tenant, event.DriverID, event.After)
+		if err != nil {
+			return err
+		}
+
+		values = append(values, fmt.Sprintf("$1, $%d, $%d, $%d, $%d, $%d, $%d::jsonb, $%d::jsonb",
+			7*i+2, 7*i+3, 7*i+4, 7*i+5, 7*i+6, 7*i+7, 7*i+8))
+		attrs = append(attrs, event.DriverID, operation, actor.Subject, actor.RequestID, actor.SourceIP,
+			nullBytes(before), string(after))
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO audit_events (tenant_id, driver_id, operation, actor, request_id, source_ip, before, after)
+		      VALUES (`+strings.Join(values, "),(")+`)`,
+		attrs...,
+	)
+	return err
+}
+
+// nullBytes is NULL if b is nil
+func nullBytes(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: b != nil}
+}
+
+// auditLicenseNumberAAD binds a ciphertext of audit events to the driver of the tenant,
+// it differs from licenseNumberAAD, so ciphertexts of drivers and events can't be swapped
+func auditLicenseNumberAAD(tenant string, driverID uint64) []byte {
+	return []byte("audit_events.license_number:" + tenant + ":" + strconv.FormatUint(driverID, 10))
+}
+
+// encodeAuditValues returns a jsonb value of the values of the driver
+// of the tenant, the license number is encrypted if the cipher is not nil
+func encodeAuditValues(c Cipher, tenant string, driverID uint64, v *AuditValues) ([]byte, error) {
+	stored := auditValues{Name: v.Name, LicenseNumber: v.LicenseNumber}
+	if c != nil {
+		enc, err := c.Encrypt([]byte(v.LicenseNumber), auditLicenseNumberAAD(tenant, driverID))
+		if err != nil {
+			return nil, err
+		}
+		stored.LicenseNumber, stored.LicenseNumberEnc = "", enc
+	}
+	return json.Marshal(stored)
+}
+
+// decodeAuditValues returns values of the driver of the tenant from a jsonb value
+// with either a plaintext or an encrypted license number
+func decodeAuditValues(c Cipher, tenant string, driverID uint64, b []byte) (*AuditValues, error) {
+	var stored auditValues
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+	v := &AuditValues{Name: stored.Name, LicenseNumber: stored.LicenseNumber}
+	if stored.LicenseNumberEnc == nil {
+		return v, nil
+	}
+	if c == nil {
+		return nil, ErrNoCipher
+	}
+	plaintext, err := c.Decrypt(stored.LicenseNumberEnc, auditLicenseNumberAAD(tenant, driverID))
+	if err != nil {
+		return nil, err
+	}
+	v.LicenseNumber = string(plaintext)
+	return v, nil
+}
+
+// reencryptAuditValues encrypts a plaintext license number of a jsonb value
+// or reencrypts the one of a previous key of the cipher, changed is false
+// if it is encrypted by the current key already
+func reencryptAuditValues(c Cipher, tenant string, driverID uint64, b []byte) ([]byte, bool, error) {
+	var stored auditValues
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, false, err
+	}
+	if stored.LicenseNumberEnc != nil {
+		enc, err := c.Rewrap(stored.LicenseNumberEnc)
+		if err != nil || enc == nil {
+			return b, false, err
+		}
+		stored.LicenseNumberEnc = enc
+	} else {
+		enc, err := c.Encrypt([]byte(stored.LicenseNumber), auditLicenseNumberAAD(tenant, driverID))
+		if err != nil {
+			return nil, false, err
+		}
+		stored.LicenseNumber, stored.LicenseNumberEnc = "", enc
+	}
+	b, err := json.Marshal(stored)
+	return b, err == nil, err
+}
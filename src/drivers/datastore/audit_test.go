@@ -0,0 +1,149 @@
+package datastore_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+func TestAuditEvents(t *testing.T) {
+	dbName, db, err := prepareTestDB()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := dropTestDB(dbName); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	dStore, err := store.NewDriversStore(db)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	aStore, err := store.NewAuditStore(db)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	begin := time.Now().Add(-time.Minute)
+	ctx := store.WithActor(context.Background(), store.Actor{
+		Subject:   "apikey:1",
+		RequestID: "1a2b3c",
+		SourceIP:  "192.0.2.1",
+	})
+
+	// the first import creates drivers, the second one changes
+	// a license number only, unchanged drivers are not audited
+	err = dStore.UpsertBatch(ctx, []*store.Driver{
+		{ID: 1, Name: "First", LicenseNumber: "11-222-33"},
+		{ID: 2, Name: "Second", LicenseNumber: "11-222-34"},
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = dStore.UpsertBatch(ctx, []*store.Driver{
+		{ID: 1, Name: "First", LicenseNumber: "11-222-35"},
+		{ID: 2, Name: "Second", LicenseNumber: "11-222-34"},
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	err = dStore.Update(ctx, &store.Driver{ID: 2, Name: "SecondUpdated", LicenseNumber: "11-222-34"}, 0)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// a failed import is rolled back with its events
+	err = dStore.UpsertBatch(ctx, []*store.Driver{
+		{ID: 1, Name: "First", LicenseNumber: "11-222-36"},
+		{ID: 3, Name: "Third", LicenseNumber: "11-222-34"},
+	})
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected a violation of the unique license number")
+	}
+
+	for _, tc := range []struct {
+		name      string
+		filter    store.AuditFilter
+		expEvents []string
+	}{
+		{
+			name:   "All",
+			filter: store.AuditFilter{Limit: 10},
+			expEvents: []string{
+				"1 import <nil> &{First 11-222-33}",
+				"2 import <nil> &{Second 11-222-34}",
+				"1 import &{First 11-222-33} &{First 11-222-35}",
+				"2 update &{Second 11-222-34} &{SecondUpdated 11-222-34}",
+			},
+		},
+		{
+			name:   "ByDriver",
+			filter: store.AuditFilter{DriverID: 1, Limit: 10},
+			expEvents: []string{
+				"1 import <nil> &{First 11-222-33}",
+				"1 import &{First 11-222-33} &{First 11-222-35}",
+			},
+		},
+		{
+			name:   "Page",
+			filter: store.AuditFilter{Since: begin, AfterID: 1, Limit: 2},
+			expEvents: []string{
+				"2 import <nil> &{Second 11-222-34}",
+				"1 import &{First 11-222-33} &{First 11-222-35}",
+			},
+		},
+		{
+			name:   "Since",
+			filter: store.AuditFilter{Since: time.Now().Add(time.Minute), Limit: 10},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := aStore.ListAuditEvents(context.Background(), tc.filter)
+			if err != nil {
+				t.Error(err)
+			}
+
+			t.Log("len(events) =>", len(events))
+			if len(events) != len(tc.expEvents) {
+				t.Error("Expected =>", len(tc.expEvents))
+				t.FailNow()
+			}
+			for i, event := range events {
+				e := fmt.Sprint(event.DriverID, " ", event.Operation, " ", event.Before, " ", event.After)
+				t.Log("event =>", e)
+				if e != tc.expEvents[i] {
+					t.Error("Expected =>", tc.expEvents[i])
+				}
+				actor := store.Actor{Subject: event.Actor, RequestID: event.RequestID, SourceIP: event.SourceIP}
+				if actor != store.ActorFromContext(ctx) {
+					t.Error("Expected =>", store.ActorFromContext(ctx))
+				}
+				if event.CreatedAt.Before(begin) {
+					t.Error("Expected the creation time to be set")
+				}
+			}
+		})
+	}
+
+	_, err = db.Exec("DELETE FROM audit_events")
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected audit events to be append-only")
+	}
+}
@@ -6,65 +6,329 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
-// DriversStore is an interface for datastore of Drivers
+// ErrVersionMismatch is returned when a driver is updated
+// on condition of a version, but the stored one differs
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// DriversStore is an interface for datastore of Drivers,
+// drivers are isolated per tenant of ctx (see WithTenant),
+// ids and license numbers are unique within a tenant
 type DriversStore interface {
 	UpsertBatch(context.Context, []*Driver) error
 	GetByID(context.Context, uint64) (*Driver, error)
+	List(ctx context.Context, afterID uint64, limit int) ([]*Driver, error)
+	Update(ctx context.Context, driver *Driver, ifVersion uint64) error
 }
 
-// Driver is a struct for driver representation
+// Driver is a struct for driver representation,
+// Version and UpdatedAt are maintained by the store
 type Driver struct {
-	ID            uint64 `json:"id"`
-	Name          string `json:"name"`
-	LicenseNumber string `json:"license_number"`
+	ID            uint64    `json:"id"`
+	Name          string    `json:"name"`
+	LicenseNumber string    `json:"license_number"`
+	Version       uint64    `json:"-"`
+	UpdatedAt     time.Time `json:"-"`
 }
 
 // NewDriversStore is a constructor for DriversStore
-func NewDriversStore(db *sql.DB) (DriversStore, error) {
+func NewDriversStore(db *sql.DB, opts ...DriversStoreOption) (DriversStore, error) {
 	if db == nil {
 		return nil, errors.New("*sql.DB is required")
 	}
-	return &driversStore{db: db}, nil
+	ds := &driversStore{db: db}
+	for _, opt := range opts {
+		opt(ds)
+	}
+	return ds, nil
 }
 
-// driversStore is an implementation of DriversStore
+// driversStore is an implementation of DriversStore,
+// license numbers are encrypted if cipher is set
 type driversStore struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher Cipher
 }
 
 // UpsertBatch prepares sql-statement with batch of drivers and applies it,
-// does upsert for conflicting ids
-func (ds *driversStore) UpsertBatch(ctx context.Context, drivers []*Driver) error {
+// does upsert for conflicting ids, the version of a driver
+// is incremented only if the driver is actually changed;
+// every created or changed driver is recorded in audit events
+// of the actor of ctx in the same transaction
+func (ds *driversStore) UpsertBatch(ctx context.Context, drivers []*Driver) (err error) {
+	tenant := TenantFromContext(ctx)
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	ids := make([]int64, 0, len(drivers))
+	for _, driver := range drivers {
+		ids = append(ids, int64(driver.ID))
+	}
+	before, err := ds.lockDrivers(ctx, tx, tenant, ids)
+	if err != nil {
+		return err
+	}
 
 	var (
 		values []string
-		attrs  []interface{}
+		attrs  = []interface{}{tenant}
 	)
 	for i, driver := range drivers {
-		values = append(values, fmt.Sprintf("$%d, $%d, $%d", 3*i+1, 3*i+2, 3*i+3))
-		attrs = append(attrs, driver.ID, driver.Name, driver.LicenseNumber)
+		plaintext, enc, index, err := encryptLicenseNumber(ds.cipher, tenant, driver)
+		if err != nil {
+			return err
+		}
+		values = append(values, fmt.Sprintf("$1, $%d, $%d, $%d, $%d, $%d", 5*i+2, 5*i+3, 5*i+4, 5*i+5, 5*i+6))
+		attrs = append(attrs, driver.ID, driver.Name, plaintext, enc, index)
 	}
-	_, err := ds.db.ExecContext(ctx,
-		`INSERT INTO drivers (id, name, license_number)
+	// unchanged drivers are not returned, ciphertexts differ
+	// anyway, so license numbers are compared by indexes if both
+	// rows have them; unchanged plaintext rows are kept as they are,
+	// they are encrypted by EncryptDrivers without new versions
+	rows, err := tx.QueryContext(ctx,
+		`INSERT INTO drivers (tenant_id, id, name, license_number, license_number_enc, license_number_index)
 		      VALUES (`+strings.Join(values, "),(")+`)
-		 ON CONFLICT (id) DO UPDATE
+		 ON CONFLICT (tenant_id, id) DO UPDATE
 		         SET name = EXCLUDED.name,
-		             license_number = EXCLUDED.license_number`,
+		             license_number = EXCLUDED.license_number,
+		             license_number_enc = EXCLUDED.license_number_enc,
+		             license_number_index = EXCLUDED.license_number_index,
+		             version = drivers.version + 1,
+		             updated_at = now()
+		       WHERE drivers.name IS DISTINCT FROM EXCLUDED.name
+		          OR CASE WHEN drivers.license_number_index IS NOT NULL AND EXCLUDED.license_number_index IS NOT NULL
+		                  THEN drivers.license_number_index <> EXCLUDED.license_number_index
+		                  ELSE drivers.license_number IS DISTINCT FROM EXCLUDED.license_number
+		              END
+		   RETURNING id`,
 		attrs...,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	after := make(map[uint64]*Driver, len(drivers))
+	for _, driver := range drivers {
+		after[driver.ID] = driver
+	}
+	var events []*AuditEvent
+	for rows.Next() {
+		event := &AuditEvent{}
+		if err = rows.Scan(&event.DriverID); err != nil {
+			return err
+		}
+		driver := after[event.DriverID]
+		event.Before = before[event.DriverID]
+		event.After = &AuditValues{Name: driver.Name, LicenseNumber: driver.LicenseNumber}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if err = insertAuditEvents(ctx, tx, ds.cipher, AuditImport, events); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockDrivers selects values of existing drivers of the tenant by ids
+// and locks them till the end of the transaction
+func (ds *driversStore) lockDrivers(ctx context.Context, tx *sql.Tx, tenant string, ids []int64) (map[uint64]*AuditValues, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, name, license_number, license_number_enc
+		   FROM drivers
+		  WHERE tenant_id = $1 AND id = ANY($2)
+		  ORDER BY id
+		    FOR UPDATE`,
+		tenant, pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[uint64]*AuditValues)
+	for rows.Next() {
+		var (
+			id        uint64
+			plaintext sql.NullString
+			enc       []byte
+		)
+		v := &AuditValues{}
+		if err = rows.Scan(&id, &v.Name, &plaintext, &enc); err != nil {
+			return nil, err
+		}
+		if v.LicenseNumber, err = decryptLicenseNumber(ds.cipher, tenant, id, plaintext, enc); err != nil {
+			return nil, err
+		}
+		values[id] = v
+	}
+	return values, rows.Err()
 }
 
-// GetByID selects a driver from datastore by id
+// GetByID selects a driver of the tenant of ctx from datastore by id
 func (ds *driversStore) GetByID(ctx context.Context, id uint64) (*Driver, error) {
-	driver := &Driver{ID: id}
+	var (
+		tenant    = TenantFromContext(ctx)
+		driver    = &Driver{ID: id}
+		plaintext sql.NullString
+		enc       []byte
+	)
 	err := ds.db.QueryRowContext(ctx,
-		"SELECT name, license_number FROM drivers WHERE id = $1 LIMIT 1", id,
+		"SELECT name, license_number, license_number_enc, version, updated_at FROM drivers WHERE tenant_id = $1 AND id = $2 LIMIT 1",
+		tenant, id,
 	).Scan(
 		&driver.Name,
-		&driver.LicenseNumber,
+		&plaintext,
+		&enc,
+		&driver.Version,
+		&driver.UpdatedAt,
 	)
+	if err != nil {
+		return driver, err
+	}
+	driver.LicenseNumber, err = decryptLicenseNumber(ds.cipher, tenant, id, plaintext, enc)
 	return driver, err
 }
+
+// List selects up to limit drivers of the tenant of ctx with ids greater than afterID
+// ordered by id, so the last id of a page is a cursor for the next one
+func (ds *driversStore) List(ctx context.Context, afterID uint64, limit int) ([]*Driver, error) {
+	tenant := TenantFromContext(ctx)
+	rows, err := ds.db.QueryContext(ctx,
+		`SELECT id, name, license_number, license_number_enc, version, updated_at
+		   FROM drivers
+		  WHERE tenant_id = $1 AND id > $2
+		  ORDER BY id
+		  LIMIT $3`,
+		tenant, afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drivers []*Driver
+	for rows.Next() {
+		var (
+			driver    = &Driver{}
+			plaintext sql.NullString
+			enc       []byte
+		)
+		err = rows.Scan(
+			&driver.ID,
+			&driver.Name,
+			&plaintext,
+			&enc,
+			&driver.Version,
+			&driver.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if driver.LicenseNumber, err = decryptLicenseNumber(ds.cipher, tenant, driver.ID, plaintext, enc); err != nil {
+			return nil, err
+		}
+		drivers = append(drivers, driver)
+	}
+	return drivers, rows.Err()
+}
+
+// Update updates an existing driver of the tenant of ctx, if ifVersion is not 0
+// the driver is updated only if its stored version is equal to ifVersion,
+// the version is checked by the UPDATE statement itself;
+// it returns sql.ErrNoRows if there is no such driver and
+// ErrVersionMismatch if the version differs,
+// on success Version and UpdatedAt of the driver are refreshed
+// and the change is recorded in audit events of the actor of ctx
+func (ds *driversStore) Update(ctx context.Context, driver *Driver, ifVersion uint64) (err error) {
+	tenant := TenantFromContext(ctx)
+	licenseNumber, licenseNumberEnc, licenseNumberIndex, err := encryptLicenseNumber(ds.cipher, tenant, driver)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// values before the change are selected by the same statement for audit events
+	var (
+		before    = &AuditValues{}
+		plaintext sql.NullString
+		enc       []byte
+	)
+	err = tx.QueryRowContext(ctx,
+		`WITH prev AS (
+		    SELECT name, license_number, license_number_enc
+		      FROM drivers
+		     WHERE tenant_id = $1 AND id = $2
+		       FOR UPDATE
+		 )
+		 UPDATE drivers
+		    SET name = $3,
+		        license_number = $4,
+		        license_number_enc = $5,
+		        license_number_index = $6,
+		        version = version + 1,
+		        updated_at = now()
+		   FROM prev
+		  WHERE tenant_id = $1 AND id = $2
+		    AND ($7::bigint = 0 OR version = $7)
+		 RETURNING drivers.version, drivers.updated_at, prev.name, prev.license_number, prev.license_number_enc`,
+		tenant, driver.ID, driver.Name, licenseNumber, licenseNumberEnc, licenseNumberIndex, ifVersion,
+	).Scan(
+		&driver.Version,
+		&driver.UpdatedAt,
+		&before.Name,
+		&plaintext,
+		&enc,
+	)
+	if err == sql.ErrNoRows {
+		// the driver is missing or its version differs
+		var version uint64
+		err = tx.QueryRowContext(ctx,
+			"SELECT version FROM drivers WHERE tenant_id = $1 AND id = $2",
+			tenant, driver.ID,
+		).Scan(&version)
+		if err == nil {
+			err = ErrVersionMismatch
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if before.LicenseNumber, err = decryptLicenseNumber(ds.cipher, tenant, driver.ID, plaintext, enc); err != nil {
+		return err
+	}
+
+	err = insertAuditEvents(ctx, tx, ds.cipher, AuditUpdate, []*AuditEvent{{
+		DriverID: driver.ID,
+		Before:   before,
+		After:    &AuditValues{Name: driver.Name, LicenseNumber: driver.LicenseNumber},
+	}})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	dbmigrations "github.com/konjoot/drivers-go-kit/src/drivers/migrations"
 	"github.com/lib/pq"
 	migrate "github.com/rubenv/sql-migrate"
 )
@@ -98,6 +99,232 @@ func TestDriversGetByID(t *testing.T) {
 	}
 }
 
+func TestDriversList(t *testing.T) {
+	dbName, db, err := prepareTestDB()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := dropTestDB(dbName); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	_, err = db.Exec(`
+		INSERT INTO drivers (id, name, license_number)
+		     VALUES (3, 'Third', '11-222-35'),
+		            (1, 'First', '11-222-33'),
+		            (2, 'Second', '11-222-34')`,
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	dStore, err := store.NewDriversStore(db)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	var drivers []*store.Driver
+	drivers, err = dStore.List(context.Background(), 0, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("len(drivers) =>", len(drivers))
+	if len(drivers) != 2 {
+		t.Error("Expected =>", 2)
+		t.FailNow()
+	}
+	t.Log("drivers[0].ID =>", drivers[0].ID)
+	if drivers[0].ID != 1 {
+		t.Error("Expected =>", 1)
+	}
+	t.Log("drivers[1].ID =>", drivers[1].ID)
+	if drivers[1].ID != 2 {
+		t.Error("Expected =>", 2)
+	}
+	t.Log("drivers[1].Name =>", drivers[1].Name)
+	if drivers[1].Name != "Second" {
+		t.Error("Expected =>", "Second")
+	}
+	t.Log("drivers[1].LicenseNumber =>", drivers[1].LicenseNumber)
+	if drivers[1].LicenseNumber != "11-222-34" {
+		t.Error("Expected =>", "11-222-34")
+	}
+
+	drivers, err = dStore.List(context.Background(), 2, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("len(drivers) =>", len(drivers))
+	if len(drivers) != 1 {
+		t.Error("Expected =>", 1)
+		t.FailNow()
+	}
+	t.Log("drivers[0].ID =>", drivers[0].ID)
+	if drivers[0].ID != 3 {
+		t.Error("Expected =>", 3)
+	}
+
+	drivers, err = dStore.List(context.Background(), 3, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("len(drivers) =>", len(drivers))
+	if len(drivers) != 0 {
+		t.Error("Expected =>", 0)
+	}
+}
+
+func TestDriversUpdate(t *testing.T) {
+	dbName, db, err := prepareTestDB()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := dropTestDB(dbName); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	_, err = db.Exec(`
+		INSERT INTO drivers (id, name, license_number)
+		     VALUES (1, 'First', '11-222-33'),
+		            (2, 'Second', '11-222-34')`,
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	dStore, err := store.NewDriversStore(db)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// unconditional update scenario
+
+	driver := &store.Driver{ID: 1, Name: "FirstUpdated", LicenseNumber: "11-222-33"}
+	err = dStore.Update(context.Background(), driver, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("driver.Version =>", driver.Version)
+	if driver.Version != 2 {
+		t.Error("Expected =>", 2)
+	}
+	t.Log("driver.UpdatedAt =>", driver.UpdatedAt)
+	if driver.UpdatedAt.IsZero() {
+		t.Error("Expected non zero UpdatedAt")
+	}
+
+	// conditional update scenario
+
+	driver = &store.Driver{ID: 1, Name: "FirstUpdatedAgain", LicenseNumber: "11-222-33"}
+	err = dStore.Update(context.Background(), driver, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("driver.Version =>", driver.Version)
+	if driver.Version != 3 {
+		t.Error("Expected =>", 3)
+	}
+
+	// version mismatch scenario
+
+	driver = &store.Driver{ID: 1, Name: "FirstStale", LicenseNumber: "11-222-33"}
+	err = dStore.Update(context.Background(), driver, 2)
+	t.Log("err =>", err)
+	if err != store.ErrVersionMismatch {
+		t.Error("Expected =>", store.ErrVersionMismatch)
+	}
+
+	driver, err = dStore.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("driver.Name =>", driver.Name)
+	if driver.Name != "FirstUpdatedAgain" {
+		t.Error("Expected =>", "FirstUpdatedAgain")
+	}
+	t.Log("driver.Version =>", driver.Version)
+	if driver.Version != 3 {
+		t.Error("Expected =>", 3)
+	}
+
+	// not found scenario
+
+	driver = &store.Driver{ID: 3, Name: "Third", LicenseNumber: "11-222-35"}
+	err = dStore.Update(context.Background(), driver, 1)
+	t.Log("err =>", err)
+	if err != sql.ErrNoRows {
+		t.Error("Expected =>", sql.ErrNoRows)
+	}
+
+	// upsert of an unchanged driver keeps the version scenario
+
+	err = dStore.UpsertBatch(context.Background(), []*store.Driver{
+		{ID: 1, Name: "FirstUpdatedAgain", LicenseNumber: "11-222-33"},
+		{ID: 2, Name: "SecondUpdated", LicenseNumber: "11-222-34"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	driver, err = dStore.GetByID(context.Background(), 1)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("driver.Version =>", driver.Version)
+	if driver.Version != 3 {
+		t.Error("Expected =>", 3)
+	}
+
+	driver, err = dStore.GetByID(context.Background(), 2)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("driver.Version =>", driver.Version)
+	if driver.Version != 2 {
+		t.Error("Expected =>", 2)
+	}
+
+	// concurrent updates of the same version scenario, only one of them wins
+
+	errs := make(chan error, 2)
+	for _, name := range []string{"SecondByFirstClient", "SecondBySecondClient"} {
+		go func(name string) {
+			errs <- dStore.Update(context.Background(), &store.Driver{ID: 2, Name: name, LicenseNumber: "11-222-34"}, 2)
+		}(name)
+	}
+	var mismatches int
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		t.Log("err =>", err)
+		if err == store.ErrVersionMismatch {
+			mismatches++
+		} else if err != nil {
+			t.Error(err)
+		}
+	}
+	if mismatches != 1 {
+		t.Error("Expected a single version mismatch")
+	}
+}
+
 func TestDriversUpsertBatch(t *testing.T) {
 
 	dbName, db, err := prepareTestDB()
@@ -462,8 +689,9 @@ func prepareTestDB() (string, *sql.DB, error) {
 	}
 
 	migrate.SetTable("migrations")
-	migrations := &migrate.FileMigrationSource{
-		Dir: "./../migrations",
+	migrations := &migrate.EmbedFileSystemMigrationSource{
+		FileSystem: dbmigrations.FS,
+		Root:       ".",
 	}
 
 	_, err = migrate.ExecMax(db, "postgres", migrations, migrate.Up, 0)
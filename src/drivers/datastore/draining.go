@@ -0,0 +1,62 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDraining is returned by UpsertBatch of a drained store
+var ErrDraining = errors.New("datastore is draining; imports are not accepted")
+
+// NewDrainingStore decorates DriversStore to track
+// in-flight UpsertBatch transactions, so they can be drained on shutdown
+func NewDrainingStore(next DriversStore) *DrainingStore {
+	return &DrainingStore{DriversStore: next}
+}
+
+// DrainingStore is a DriversStore decorator,
+// reads are passed to the decorated store as is
+type DrainingStore struct {
+	DriversStore
+
+	mu       sync.Mutex
+	draining bool
+	inFlight sync.WaitGroup
+}
+
+// UpsertBatch passes the batch to the decorated store
+// unless the store is draining
+func (ds *DrainingStore) UpsertBatch(ctx context.Context, drivers []*Driver) error {
+	ds.mu.Lock()
+	if ds.draining {
+		ds.mu.Unlock()
+		return ErrDraining
+	}
+	ds.inFlight.Add(1)
+	ds.mu.Unlock()
+	defer ds.inFlight.Done()
+
+	return ds.DriversStore.UpsertBatch(ctx, drivers)
+}
+
+// Drain stops accepting new batches and waits for in-flight ones
+// until they are done or ctx is done
+func (ds *DrainingStore) Drain(ctx context.Context) error {
+	ds.mu.Lock()
+	ds.draining = true
+	ds.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ds.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
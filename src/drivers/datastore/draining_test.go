@@ -0,0 +1,68 @@
+package datastore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+func TestDrainingStore(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	dStore := store.NewDrainingStore(&blockingStore{started: started, release: release})
+
+	upserted := make(chan error, 1)
+	go func() {
+		upserted <- dStore.UpsertBatch(context.Background(), make([]*store.Driver, 1))
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := dStore.Drain(ctx)
+	t.Log("Drain with in-flight batch =>", err)
+	if err != context.DeadlineExceeded {
+		t.Error("Expected =>", context.DeadlineExceeded)
+	}
+
+	err = dStore.UpsertBatch(context.Background(), make([]*store.Driver, 1))
+	t.Log("UpsertBatch of drained store =>", err)
+	if err != store.ErrDraining {
+		t.Error("Expected =>", store.ErrDraining)
+	}
+
+	_, err = dStore.GetByID(context.Background(), 1)
+	t.Log("GetByID of drained store =>", err)
+	if err != nil {
+		t.Error("Expected =>", nil)
+	}
+
+	close(release)
+	err = dStore.Drain(context.Background())
+	t.Log("Drain =>", err)
+	if err != nil {
+		t.Error("Expected =>", nil)
+	}
+
+	err = <-upserted
+	t.Log("in-flight UpsertBatch =>", err)
+	if err != nil {
+		t.Error("Expected =>", nil)
+	}
+}
+
+// blockingStore blocks UpsertBatch until release is closed
+type blockingStore struct {
+	mockStore
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (bs *blockingStore) UpsertBatch(context.Context, []*store.Driver) error {
+	close(bs.started)
+	<-bs.release
+	return nil
+}
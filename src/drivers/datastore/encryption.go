@@ -0,0 +1,396 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+// ErrNoCipher is returned when an encrypted license number
+// is read by a store without a cipher
+var ErrNoCipher = errors.New("license number is encrypted, but there is no cipher")
+
+// Cipher encrypts license numbers of drivers, it is implemented by keyring.Keyring;
+// Index is a blind index (e.g. HMAC) of a license number, which is unique
+// in the drivers table instead of the license number itself
+type Cipher interface {
+	Encrypt(plaintext, aad []byte) ([]byte, error)
+	Decrypt(ciphertext, aad []byte) ([]byte, error)
+	// Rewrap reencrypts ciphertext by the current key,
+	// it returns nil if it is encrypted by the current key already
+	Rewrap(ciphertext []byte) ([]byte, error)
+	Index(plaintext []byte) []byte
+}
+
+// DriversStoreOption sets an optional parameter of DriversStore
+type DriversStoreOption func(*driversStore)
+
+// WithCipher encrypts license numbers of written drivers and their audit events,
+// the store reads both encrypted and plaintext ones, the latter are encrypted
+// by EncryptDrivers and EncryptAuditEvents ("migrate encrypt" subcommand)
+// and indexed by IndexDrivers before the store writes with the cipher
+func WithCipher(c Cipher) DriversStoreOption {
+	return func(ds *driversStore) { ds.cipher = c }
+}
+
+// licenseNumberAAD binds a ciphertext to the driver of the tenant,
+// so ciphertexts can't be swapped between drivers or tenants;
+// AADs of the default tenant are the ones written before tenants
+func licenseNumberAAD(tenant string, id uint64) []byte {
+	if tenant == DefaultTenant {
+		return []byte("drivers.license_number:" + strconv.FormatUint(id, 10))
+	}
+	return []byte("drivers.license_number:" + tenant + ":" + strconv.FormatUint(id, 10))
+}
+
+// licenseNumberIndex is a blind index of the license number of the tenant,
+// indexes of other tenants differ, so equal license numbers
+// of different tenants can't be matched by the indexes
+func licenseNumberIndex(c Cipher, tenant, licenseNumber string) []byte {
+	if tenant == DefaultTenant {
+		return c.Index([]byte(licenseNumber))
+	}
+	return c.Index([]byte(tenant + ":" + licenseNumber))
+}
+
+// encryptLicenseNumber returns values of license_number, license_number_enc
+// and license_number_index columns of the driver of the tenant, the index
+// is written whenever the cipher is set
+func encryptLicenseNumber(c Cipher, tenant string, driver *Driver) (plaintext, enc, index interface{}, err error) {
+	if c == nil {
+		return driver.LicenseNumber, nil, nil, nil
+	}
+	ciphertext, err := c.Encrypt([]byte(driver.LicenseNumber), licenseNumberAAD(tenant, driver.ID))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return nil, ciphertext, licenseNumberIndex(c, tenant, driver.LicenseNumber), nil
+}
+
+// decryptLicenseNumber returns the license number of the driver of the tenant
+// from license_number or license_number_enc column
+func decryptLicenseNumber(c Cipher, tenant string, id uint64, plaintext sql.NullString, enc []byte) (string, error) {
+	if enc == nil {
+		return plaintext.String, nil
+	}
+	if c == nil {
+		return "", ErrNoCipher
+	}
+	b, err := c.Decrypt(enc, licenseNumberAAD(tenant, id))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// EncryptDrivers encrypts plaintext license numbers and reencrypts
+// the ones encrypted by previous keys of the cipher, drivers of all tenants
+// are processed in transactions of batchSize rows, so it may be run on a live database;
+// it returns a number of changed drivers, their versions are kept
+func EncryptDrivers(ctx context.Context, db *sql.DB, c Cipher, batchSize int) (int, error) {
+	if db == nil || c == nil {
+		return 0, errors.New("*sql.DB and Cipher are required")
+	}
+	if batchSize < 1 {
+		return 0, errors.New("batch size should be greater than 0")
+	}
+
+	var (
+		total int
+		after driverKey
+	)
+	for {
+		n, last, err := encryptBatch(ctx, db, c, after, batchSize)
+		total += n
+		if err != nil || last == nil {
+			return total, err
+		}
+		after = *last
+	}
+}
+
+// driverKey is a primary key of a driver
+type driverKey struct {
+	tenant string
+	id     uint64
+}
+
+// encryptBatch encrypts a batch of drivers with keys greater than after,
+// last is nil if there are no more drivers
+func encryptBatch(ctx context.Context, db *sql.DB, c Cipher, after driverKey, batchSize int) (n int, last *driverKey, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT tenant_id, id, license_number, license_number_enc
+		   FROM drivers
+		  WHERE (tenant_id, id) > ($1, $2)
+		  ORDER BY tenant_id, id
+		  LIMIT $3
+		    FOR UPDATE`,
+		after.tenant, after.id, batchSize,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	type row struct {
+		driverKey
+		plaintext sql.NullString
+		enc       []byte
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err = rows.Scan(&r.tenant, &r.id, &r.plaintext, &r.enc); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	for _, r := range batch {
+		if r.enc != nil {
+			var enc []byte
+			if enc, err = c.Rewrap(r.enc); err != nil {
+				return 0, nil, err
+			}
+			if enc == nil {
+				continue // encrypted by the current key
+			}
+			_, err = tx.ExecContext(ctx,
+				"UPDATE drivers SET license_number_enc = $3 WHERE tenant_id = $1 AND id = $2",
+				r.tenant, r.id, enc,
+			)
+		} else {
+			var enc, index interface{}
+			_, enc, index, err = encryptLicenseNumber(c, r.tenant, &Driver{ID: r.id, LicenseNumber: r.plaintext.String})
+			if err != nil {
+				return 0, nil, err
+			}
+			_, err = tx.ExecContext(ctx,
+				`UPDATE drivers
+				    SET license_number = NULL,
+				        license_number_enc = $3,
+				        license_number_index = $4
+				  WHERE tenant_id = $1 AND id = $2`,
+				r.tenant, r.id, enc, index,
+			)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		n++
+	}
+
+	if len(batch) == batchSize {
+		last = &batch[len(batch)-1].driverKey
+	}
+	return n, last, tx.Commit()
+}
+
+// IndexDrivers writes blind indexes of plaintext license numbers, so they are unique
+// between plaintext and encrypted drivers; drivers of all tenants are processed
+// in transactions of batchSize rows, it returns a number of indexed drivers
+func IndexDrivers(ctx context.Context, db *sql.DB, c Cipher, batchSize int) (int, error) {
+	if db == nil || c == nil {
+		return 0, errors.New("*sql.DB and Cipher are required")
+	}
+	if batchSize < 1 {
+		return 0, errors.New("batch size should be greater than 0")
+	}
+
+	var (
+		total int
+		after driverKey
+	)
+	for {
+		n, last, err := indexBatch(ctx, db, c, after, batchSize)
+		total += n
+		if err != nil || last == nil {
+			return total, err
+		}
+		after = *last
+	}
+}
+
+// indexBatch indexes a batch of plaintext drivers with keys greater than after,
+// last is nil if there are no more drivers
+func indexBatch(ctx context.Context, db *sql.DB, c Cipher, after driverKey, batchSize int) (n int, last *driverKey, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT tenant_id, id, license_number
+		   FROM drivers
+		  WHERE (tenant_id, id) > ($1, $2)
+		    AND license_number IS NOT NULL
+		    AND license_number_index IS NULL
+		  ORDER BY tenant_id, id
+		  LIMIT $3
+		    FOR UPDATE`,
+		after.tenant, after.id, batchSize,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	type row struct {
+		driverKey
+		licenseNumber string
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err = rows.Scan(&r.tenant, &r.id, &r.licenseNumber); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	for _, r := range batch {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE drivers SET license_number_index = $3 WHERE tenant_id = $1 AND id = $2",
+			r.tenant, r.id, licenseNumberIndex(c, r.tenant, r.licenseNumber),
+		)
+		if err != nil {
+			return 0, nil, err
+		}
+		n++
+	}
+
+	if len(batch) == batchSize {
+		last = &batch[len(batch)-1].driverKey
+	}
+	return n, last, tx.Commit()
+}
+
+// EncryptAuditEvents encrypts plaintext license numbers in values of audit events
+// and reencrypts the ones encrypted by previous keys of the cipher, events of all
+// tenants are processed in transactions of batchSize rows as drivers_audit_encryptor role,
+// which is allowed to update append-only events, so it should be run by the user
+// who has run migrations; it returns a number of changed events
+func EncryptAuditEvents(ctx context.Context, db *sql.DB, c Cipher, batchSize int) (int, error) {
+	if db == nil || c == nil {
+		return 0, errors.New("*sql.DB and Cipher are required")
+	}
+	if batchSize < 1 {
+		return 0, errors.New("batch size should be greater than 0")
+	}
+
+	var (
+		total int
+		after uint64
+	)
+	for {
+		n, last, err := encryptAuditBatch(ctx, db, c, after, batchSize)
+		total += n
+		if err != nil || last == 0 {
+			return total, err
+		}
+		after = last
+	}
+}
+
+// encryptAuditBatch encrypts a batch of audit events with ids greater than after,
+// last is 0 if there are no more events
+func encryptAuditBatch(ctx context.Context, db *sql.DB, c Cipher, after uint64, batchSize int) (n int, last uint64, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// the only role allowed to update events, see audit_events_append_only trigger
+	if _, err = tx.ExecContext(ctx, "SET LOCAL ROLE drivers_audit_encryptor"); err != nil {
+		return 0, 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, tenant_id, driver_id, before, after
+		   FROM audit_events
+		  WHERE id > $1
+		  ORDER BY id
+		  LIMIT $2
+		    FOR UPDATE`,
+		after, batchSize,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	type row struct {
+		id, driverID  uint64
+		tenant        string
+		before, after []byte
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err = rows.Scan(&r.id, &r.tenant, &r.driverID, &r.before, &r.after); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, r := range batch {
+		var beforeChanged, afterChanged bool
+		if r.before != nil {
+			if r.before, beforeChanged, err = reencryptAuditValues(c, r.tenant, r.driverID, r.before); err != nil {
+				return 0, 0, err
+			}
+		}
+		if r.after, afterChanged, err = reencryptAuditValues(c, r.tenant, r.driverID, r.after); err != nil {
+			return 0, 0, err
+		}
+		if !beforeChanged && !afterChanged {
+			continue // encrypted by the current key
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE audit_events SET before = $2::jsonb, after = $3::jsonb WHERE id = $1",
+			r.id, nullBytes(r.before), string(r.after),
+		)
+		if err != nil {
+			return 0, 0, err
+		}
+		n++
+	}
+
+	if len(batch) == batchSize {
+		last = batch[len(batch)-1].id
+	}
+	return n, last, tx.Commit()
+}
@@ -0,0 +1,364 @@
+package datastore_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/keyring"
+	"github.com/lib/pq"
+)
+
+// newTestKeyring returns a keyring of ids, a key
+// of an id is the same in every keyring
+func newTestKeyring(t *testing.T, ids ...string) *keyring.Keyring {
+	var entries []string
+	for _, id := range append(ids, keyring.IndexKeyID) {
+		key := sha256.Sum256([]byte(id))
+		entries = append(entries, id+":"+base64.StdEncoding.EncodeToString(key[:]))
+	}
+	kr, err := keyring.Parse(strings.Join(entries, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestDriversEncryption(t *testing.T) {
+	dbName, db, err := prepareTestDB()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := dropTestDB(dbName); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	_, err = db.Exec(`
+		INSERT INTO drivers (id, name, license_number)
+		     VALUES (1, 'First', '11-222-33'),
+		            (2, 'Second', '11-222-34')`,
+	)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+	k1 := newTestKeyring(t, "k1")
+	dStore, err := store.NewDriversStore(db, store.WithCipher(k1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// plaintext rows are read before they are encrypted
+	driver, err := dStore.GetByID(ctx, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("driver.LicenseNumber =>", driver.LicenseNumber)
+	if driver.LicenseNumber != "11-222-33" {
+		t.Error("Expected =>", "11-222-33")
+	}
+
+	// plaintext rows are indexed, so they are unique between encrypted ones
+	n, err := store.IndexDrivers(ctx, db, k1, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("n =>", n)
+	if n != 2 {
+		t.Error("Expected =>", 2)
+	}
+	n, err = store.IndexDrivers(ctx, db, k1, 1)
+	t.Log("n =>", n)
+	if err != nil || n != 0 {
+		t.Error("Expected =>", 0)
+	}
+	err = dStore.UpsertBatch(ctx, []*store.Driver{{ID: 3, Name: "Third", LicenseNumber: "11-222-33"}})
+	t.Log("err =>", err)
+	if e, ok := err.(*pq.Error); !ok || e.Constraint != "drivers_license_number_index_key" {
+		t.Error("Expected e.Constraint =>", "drivers_license_number_index_key")
+	}
+
+	// unchanged plaintext drivers are not rewritten by imports
+	err = dStore.UpsertBatch(ctx, []*store.Driver{{ID: 2, Name: "Second", LicenseNumber: "11-222-34"}})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// new drivers are encrypted
+	err = dStore.UpsertBatch(ctx, []*store.Driver{{ID: 3, Name: "Third", LicenseNumber: "11-222-35"}})
+	if err != nil {
+		t.Error(err)
+	}
+
+	n, err = store.EncryptDrivers(ctx, db, k1, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("n =>", n)
+	if n != 2 {
+		t.Error("Expected =>", 2)
+	}
+
+	// encryption keeps versions and isn't audited
+	var changed, events int
+	err = db.QueryRow(`SELECT count(*) FROM drivers WHERE version > 1`).Scan(&changed)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("changed =>", changed)
+	if changed != 0 {
+		t.Error("Expected =>", 0)
+	}
+	err = db.QueryRow(`SELECT count(*) FROM audit_events WHERE driver_id <> 3`).Scan(&events)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("events =>", events)
+	if events != 0 {
+		t.Error("Expected =>", 0)
+	}
+
+	var plaintexts int
+	err = db.QueryRow(`SELECT count(*) FROM drivers WHERE license_number IS NOT NULL`).Scan(&plaintexts)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("plaintexts =>", plaintexts)
+	if plaintexts != 0 {
+		t.Error("Expected =>", 0)
+	}
+
+	drivers, err := dStore.List(ctx, 0, 10)
+	if err != nil || len(drivers) != 3 {
+		t.Fatal("Expected 3 drivers =>", drivers, err)
+	}
+	for i, exp := range []string{"11-222-33", "11-222-34", "11-222-35"} {
+		t.Log("drivers[i].LicenseNumber =>", drivers[i].LicenseNumber)
+		if drivers[i].LicenseNumber != exp {
+			t.Error("Expected =>", exp)
+		}
+	}
+
+	// uniqueness is checked by the blind index
+	err = dStore.UpsertBatch(ctx, []*store.Driver{{ID: 4, Name: "Fourth", LicenseNumber: "11-222-33"}})
+	t.Log("err =>", err)
+	if e, ok := err.(*pq.Error); !ok || e.Constraint != "drivers_license_number_index_key" {
+		t.Error("Expected e.Constraint =>", "drivers_license_number_index_key")
+	}
+	err = dStore.Update(ctx, &store.Driver{ID: 2, Name: "Second", LicenseNumber: "11-222-33"}, 0)
+	t.Log("err =>", err)
+	if e, ok := err.(*pq.Error); !ok || e.Constraint != "drivers_license_number_index_key" {
+		t.Error("Expected e.Constraint =>", "drivers_license_number_index_key")
+	}
+
+	// unchanged drivers are not updated though ciphertexts differ
+	err = dStore.UpsertBatch(ctx, []*store.Driver{{ID: 1, Name: "First", LicenseNumber: "11-222-33"}})
+	if err != nil {
+		t.Error(err)
+	}
+	driver, err = dStore.GetByID(ctx, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("driver.Version =>", driver.Version)
+	if driver.Version != 1 {
+		t.Error("Expected =>", 1)
+	}
+
+	// keys are rotated
+	k2 := newTestKeyring(t, "k2", "k1")
+	n, err = store.EncryptDrivers(ctx, db, k2, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("n =>", n)
+	if n != 3 {
+		t.Error("Expected =>", 3)
+	}
+	n, err = store.EncryptDrivers(ctx, db, k2, 2)
+	t.Log("n =>", n)
+	if err != nil || n != 0 {
+		t.Error("Expected =>", 0)
+	}
+
+	rotated, err := store.NewDriversStore(db, store.WithCipher(newTestKeyring(t, "k2")))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	driver, err = rotated.GetByID(ctx, 3)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("driver.LicenseNumber =>", driver.LicenseNumber)
+	if driver.LicenseNumber != "11-222-35" {
+		t.Error("Expected =>", "11-222-35")
+	}
+
+	// encrypted license numbers are not read without a cipher
+	plain, err := store.NewDriversStore(db)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	_, err = plain.GetByID(ctx, 1)
+	t.Log("err =>", err)
+	if err != store.ErrNoCipher {
+		t.Error("Expected =>", store.ErrNoCipher)
+	}
+}
+
+func TestAuditEventsEncryption(t *testing.T) {
+	dbName, db, err := prepareTestDB()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := dropTestDB(dbName); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ctx := context.Background()
+	plain, err := store.NewDriversStore(db)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	k1 := newTestKeyring(t, "k1")
+	dStore, err := store.NewDriversStore(db, store.WithCipher(k1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// the first event is written before encryption is enabled
+	err = plain.UpsertBatch(ctx, []*store.Driver{{ID: 1, Name: "First", LicenseNumber: "11-222-33"}})
+	if err != nil {
+		t.Error(err)
+	}
+	err = dStore.Update(ctx, &store.Driver{ID: 1, Name: "First", LicenseNumber: "11-222-35"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	plaintexts := func() (n int) {
+		err := db.QueryRow(`
+			SELECT count(*)
+			  FROM audit_events
+			 WHERE before->>'license_number' IS NOT NULL
+			    OR after->>'license_number' IS NOT NULL`,
+		).Scan(&n)
+		if err != nil {
+			t.Error(err)
+		}
+		return n
+	}
+	t.Log("plaintexts =>", plaintexts())
+	if plaintexts() != 1 {
+		t.Error("Expected =>", 1)
+	}
+
+	n, err := store.EncryptAuditEvents(ctx, db, k1, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("n =>", n)
+	if n != 1 {
+		t.Error("Expected =>", 1)
+	}
+	t.Log("plaintexts =>", plaintexts())
+	if plaintexts() != 0 {
+		t.Error("Expected =>", 0)
+	}
+
+	// keys are rotated
+	k2 := newTestKeyring(t, "k2", "k1")
+	n, err = store.EncryptAuditEvents(ctx, db, k2, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("n =>", n)
+	if n != 2 {
+		t.Error("Expected =>", 2)
+	}
+	n, err = store.EncryptAuditEvents(ctx, db, k2, 1)
+	t.Log("n =>", n)
+	if err != nil || n != 0 {
+		t.Error("Expected =>", 0)
+	}
+
+	aStore, err := store.NewAuditStore(db, store.WithAuditCipher(newTestKeyring(t, "k2")))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	events, err := aStore.ListAuditEvents(ctx, store.AuditFilter{Limit: 10})
+	if err != nil || len(events) != 2 {
+		t.Fatal("Expected 2 events =>", events, err)
+	}
+	for i, exp := range []string{
+		"1 import <nil> &{First 11-222-33}",
+		"1 update &{First 11-222-33} &{First 11-222-35}",
+	} {
+		e := fmt.Sprint(events[i].DriverID, " ", events[i].Operation, " ", events[i].Before, " ", events[i].After)
+		t.Log("event =>", e)
+		if e != exp {
+			t.Error("Expected =>", exp)
+		}
+	}
+
+	// encrypted license numbers are not read without a cipher
+	plainAudit, err := store.NewAuditStore(db)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	_, err = plainAudit.ListAuditEvents(ctx, store.AuditFilter{Limit: 10})
+	t.Log("err =>", err)
+	if err != store.ErrNoCipher {
+		t.Error("Expected =>", store.ErrNoCipher)
+	}
+
+	// events are still append-only outside of encryption
+	_, err = db.Exec(`UPDATE audit_events SET actor = 'anonymous'`)
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected audit events to be append-only")
+	}
+
+	// settings of sessions don't allow to update them
+	tx, err := db.Begin()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`SELECT set_config('drivers.encrypt_audit_events', 'on', true)`); err != nil {
+		t.Error(err)
+	}
+	_, err = tx.Exec(`UPDATE audit_events SET actor = 'anonymous'`)
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected audit events to be append-only")
+	}
+}
@@ -0,0 +1,67 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// NewInstrumentingStore decorates DriversStore to collect
+// latency of queries labelled by "method" and "success"
+// and sizes of imported batches
+func NewInstrumentingStore(next DriversStore, latency, batchSize metrics.Histogram) DriversStore {
+	return &instrumentingStore{
+		next:      next,
+		latency:   latency,
+		batchSize: batchSize,
+	}
+}
+
+// instrumentingStore is a DriversStore decorator
+type instrumentingStore struct {
+	next      DriversStore
+	latency   metrics.Histogram
+	batchSize metrics.Histogram
+}
+
+func (is *instrumentingStore) UpsertBatch(ctx context.Context, drivers []*Driver) (err error) {
+	defer func(begin time.Time) {
+		is.observe("UpsertBatch", begin, err)
+		is.batchSize.Observe(float64(len(drivers)))
+	}(time.Now())
+	return is.next.UpsertBatch(ctx, drivers)
+}
+
+func (is *instrumentingStore) GetByID(ctx context.Context, id uint64) (driver *Driver, err error) {
+	defer func(begin time.Time) {
+		is.observe("GetByID", begin, err)
+	}(time.Now())
+	return is.next.GetByID(ctx, id)
+}
+
+func (is *instrumentingStore) List(ctx context.Context, afterID uint64, limit int) (drivers []*Driver, err error) {
+	defer func(begin time.Time) {
+		is.observe("List", begin, err)
+	}(time.Now())
+	return is.next.List(ctx, afterID, limit)
+}
+
+func (is *instrumentingStore) Update(ctx context.Context, driver *Driver, ifVersion uint64) (err error) {
+	defer func(begin time.Time) {
+		is.observe("Update", begin, err)
+	}(time.Now())
+	return is.next.Update(ctx, driver, ifVersion)
+}
+
+// observe records latency of a query,
+// a missing row is a regular outcome, not a failure of the query
+func (is *instrumentingStore) observe(method string, begin time.Time, err error) {
+	success := err == nil || err == sql.ErrNoRows || err == ErrVersionMismatch
+	is.latency.With(
+		"method", method,
+		"success", strconv.FormatBool(success),
+	).Observe(time.Since(begin).Seconds())
+}
@@ -0,0 +1,101 @@
+package datastore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/metrics"
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+func TestInstrumentingStore(t *testing.T) {
+	var (
+		latency   = &histogram{observations: make(map[string]int)}
+		batchSize = &histogram{observations: make(map[string]int)}
+		dStore    = store.NewInstrumentingStore(&mockStore{
+			getByIDErr: sql.ErrNoRows,
+			listErr:    errors.New("internal"),
+		}, latency, batchSize)
+	)
+
+	dStore.UpsertBatch(context.Background(), make([]*store.Driver, 3))
+	dStore.GetByID(context.Background(), 1)
+	dStore.List(context.Background(), 0, 10)
+	dStore.Update(context.Background(), &store.Driver{}, 0)
+
+	t.Log("latency =>", latency.observations)
+	for _, key := range []string{
+		"method=UpsertBatch,success=true",
+		"method=GetByID,success=true",
+		"method=List,success=false",
+		"method=Update,success=true",
+	} {
+		if latency.observations[key] != 1 {
+			t.Error("Expected one observation of =>", key)
+		}
+	}
+
+	t.Log("batchSize =>", batchSize.values)
+	if fmt.Sprint(batchSize.values) != "[3]" {
+		t.Error("Expected =>", "[3]")
+	}
+}
+
+// histogram is a metrics.Histogram which records
+// a number of observations per label values
+type histogram struct {
+	sync.Mutex
+	lvs          []string
+	observations map[string]int
+	values       []float64
+	parent       *histogram
+}
+
+func (h *histogram) With(labelValues ...string) metrics.Histogram {
+	return &histogram{lvs: append(h.lvs, labelValues...), parent: h}
+}
+
+func (h *histogram) Observe(value float64) {
+	root := h
+	for root.parent != nil {
+		root = root.parent
+	}
+
+	var key []string
+	for i := 0; i+1 < len(h.lvs); i += 2 {
+		key = append(key, h.lvs[i]+"="+h.lvs[i+1])
+	}
+
+	root.Lock()
+	root.observations[strings.Join(key, ",")]++
+	root.values = append(root.values, value)
+	root.Unlock()
+}
+
+type mockStore struct {
+	store.DriversStore
+
+	getByIDErr error
+	listErr    error
+}
+
+func (ms *mockStore) UpsertBatch(context.Context, []*store.Driver) error {
+	return nil
+}
+
+func (ms *mockStore) GetByID(context.Context, uint64) (*store.Driver, error) {
+	return nil, ms.getByIDErr
+}
+
+func (ms *mockStore) List(context.Context, uint64, int) ([]*store.Driver, error) {
+	return nil, ms.listErr
+}
+
+func (ms *mockStore) Update(context.Context, *store.Driver, uint64) error {
+	return nil
+}
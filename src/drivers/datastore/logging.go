@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/konjoot/drivers-go-kit/src/drivers/logging"
+)
+
+// NewLoggingStore decorates DriversStore to log failed queries
+// with the logger of a request's context, so log lines carry request_id
+func NewLoggingStore(next DriversStore) DriversStore {
+	return &loggingStore{next}
+}
+
+// loggingStore is a DriversStore decorator
+type loggingStore struct {
+	next DriversStore
+}
+
+func (ls *loggingStore) UpsertBatch(ctx context.Context, drivers []*Driver) (err error) {
+	defer func(begin time.Time) {
+		ls.log(ctx, "UpsertBatch", begin, err, "batch_size", len(drivers))
+	}(time.Now())
+	return ls.next.UpsertBatch(ctx, drivers)
+}
+
+func (ls *loggingStore) GetByID(ctx context.Context, id uint64) (driver *Driver, err error) {
+	defer func(begin time.Time) {
+		ls.log(ctx, "GetByID", begin, err, "id", id)
+	}(time.Now())
+	return ls.next.GetByID(ctx, id)
+}
+
+func (ls *loggingStore) List(ctx context.Context, afterID uint64, limit int) (drivers []*Driver, err error) {
+	defer func(begin time.Time) {
+		ls.log(ctx, "List", begin, err, "after_id", afterID, "limit", limit)
+	}(time.Now())
+	return ls.next.List(ctx, afterID, limit)
+}
+
+func (ls *loggingStore) Update(ctx context.Context, driver *Driver, ifVersion uint64) (err error) {
+	defer func(begin time.Time) {
+		ls.log(ctx, "Update", begin, err, "id", driver.ID, "if_version", ifVersion)
+	}(time.Now())
+	return ls.next.Update(ctx, driver, ifVersion)
+}
+
+// log logs the query if it is failed,
+// a missing row is a regular outcome, not a failure of the query
+func (ls *loggingStore) log(ctx context.Context, method string, begin time.Time, err error, keyvals ...interface{}) {
+	if err == nil || err == sql.ErrNoRows || err == ErrVersionMismatch {
+		return
+	}
+	level.Error(logging.FromContext(ctx)).Log(append([]interface{}{
+		"component", "store",
+		"method", method,
+		"took", time.Since(begin),
+		"err", err,
+	}, keyvals...)...)
+}
@@ -0,0 +1,51 @@
+package datastore_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/logging"
+)
+
+func TestLoggingStore(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logging.NewContext(context.Background(),
+		log.With(log.NewLogfmtLogger(&buf), "request_id", "abc"))
+
+	dStore := store.NewLoggingStore(&mockStore{
+		getByIDErr: sql.ErrNoRows,
+		listErr:    errors.New("internal"),
+	})
+
+	dStore.UpsertBatch(ctx, make([]*store.Driver, 3))
+	dStore.GetByID(ctx, 1)
+	dStore.List(ctx, 0, 10)
+	dStore.Update(ctx, &store.Driver{ID: 1}, 0)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	t.Log("lines =>", lines)
+	if len(lines) != 1 {
+		t.Error("Expected =>", 1)
+		t.FailNow()
+	}
+
+	for _, kv := range []string{
+		"request_id=abc",
+		"level=error",
+		"component=store",
+		"method=List",
+		"err=internal",
+		"after_id=0",
+		"limit=10",
+	} {
+		if !strings.Contains(lines[0], kv) {
+			t.Error("Expected =>", kv)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package datastore
+
+import (
+	"context"
+	"regexp"
+)
+
+// DefaultTenant is a tenant of drivers of a context without a tenant,
+// drivers created before tenants were introduced belong to it
+const DefaultTenant = "default"
+
+// tenantRe is a format of tenant ids, they are a part of AADs
+// and blind indexes of encrypted license numbers
+var tenantRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenant reports whether the tenant id is well-formed:
+// up to 63 lowercase letters, digits, '-' and '_'
+func ValidTenant(tenant string) bool {
+	return tenantRe.MatchString(tenant)
+}
+
+// WithTenant returns a copy of ctx which carries the tenant,
+// DriversStore and AuditStore see only rows of the tenant of ctx
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// TenantFromContext returns the tenant stored in ctx or DefaultTenant
+func TenantFromContext(ctx context.Context) string {
+	if tenant, _ := ctx.Value(tenantKey).(string); tenant != "" {
+		return tenant
+	}
+	return DefaultTenant
+}
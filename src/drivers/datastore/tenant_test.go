@@ -0,0 +1,187 @@
+package datastore_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/lib/pq"
+)
+
+func TestTenantFromContext(t *testing.T) {
+	tenant := store.TenantFromContext(context.Background())
+	t.Log("tenant =>", tenant)
+	if tenant != store.DefaultTenant {
+		t.Error("Expected =>", store.DefaultTenant)
+	}
+
+	tenant = store.TenantFromContext(store.WithTenant(context.Background(), "acme"))
+	t.Log("tenant =>", tenant)
+	if tenant != "acme" {
+		t.Error("Expected =>", "acme")
+	}
+
+	for _, tc := range []struct {
+		tenant string
+		valid  bool
+	}{
+		{tenant: "acme", valid: true},
+		{tenant: "fleet-42_eu", valid: true},
+		{tenant: "0", valid: true},
+		{tenant: ""},
+		{tenant: "-acme"},
+		{tenant: "Acme"},
+		{tenant: "acme:eu"},
+		{tenant: "acme eu"},
+		{tenant: "a123456789012345678901234567890123456789012345678901234567890123"},
+	} {
+		valid := store.ValidTenant(tc.tenant)
+		t.Log(tc.tenant, "valid =>", valid)
+		if valid != tc.valid {
+			t.Error("Expected =>", tc.valid)
+		}
+	}
+}
+
+func TestDriversTenants(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		opts          []store.DriversStoreOption
+		expConstraint string
+	}{
+		{
+			name:          "Plaintext",
+			expConstraint: "drivers_license_number_key",
+		},
+		{
+			name:          "Encrypted",
+			opts:          []store.DriversStoreOption{store.WithCipher(newTestKeyring(t, "k1"))},
+			expConstraint: "drivers_license_number_index_key",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dbName, db, err := prepareTestDB()
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			defer func() {
+				if err := db.Close(); err != nil {
+					t.Error(err)
+				}
+				if err := dropTestDB(dbName); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			dStore, err := store.NewDriversStore(db, tc.opts...)
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+			aStore, err := store.NewAuditStore(db)
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			acme := store.WithTenant(context.Background(), "acme")
+			globex := store.WithTenant(context.Background(), "globex")
+
+			// ids and license numbers are unique within a tenant only
+			err = dStore.UpsertBatch(acme, []*store.Driver{{ID: 1, Name: "First", LicenseNumber: "11-222-33"}})
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+			err = dStore.UpsertBatch(globex, []*store.Driver{
+				{ID: 1, Name: "Another", LicenseNumber: "11-222-33"},
+				{ID: 2, Name: "Second", LicenseNumber: "11-222-34"},
+			})
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			err = dStore.UpsertBatch(acme, []*store.Driver{{ID: 3, Name: "Third", LicenseNumber: "11-222-33"}})
+			t.Log("err =>", err)
+			if e, ok := err.(*pq.Error); !ok || e.Code != "23505" || e.Constraint != tc.expConstraint {
+				t.Error("Expected e.Constraint =>", tc.expConstraint)
+			}
+
+			driver, err := dStore.GetByID(acme, 1)
+			if err != nil {
+				t.Error(err)
+			}
+			t.Log("acme driver =>", driver.Name, driver.LicenseNumber, driver.Version)
+			if driver.Name != "First" || driver.LicenseNumber != "11-222-33" || driver.Version != 1 {
+				t.Error("Expected =>", "First 11-222-33 1")
+			}
+
+			_, err = dStore.GetByID(acme, 2)
+			t.Log("err =>", err)
+			if err != sql.ErrNoRows {
+				t.Error("Expected =>", sql.ErrNoRows)
+			}
+
+			drivers, err := dStore.List(acme, 0, 10)
+			if err != nil {
+				t.Error(err)
+			}
+			t.Log("len(acme drivers) =>", len(drivers))
+			if len(drivers) != 1 || drivers[0].Name != "First" {
+				t.Error("Expected =>", "First only")
+			}
+
+			drivers, err = dStore.List(context.Background(), 0, 10)
+			if err != nil {
+				t.Error(err)
+			}
+			t.Log("len(default drivers) =>", len(drivers))
+			if len(drivers) != 0 {
+				t.Error("Expected =>", 0)
+			}
+
+			// a driver of another tenant can't be updated
+			err = dStore.Update(acme, &store.Driver{ID: 2, Name: "Stolen", LicenseNumber: "11-222-34"}, 0)
+			t.Log("err =>", err)
+			if err != sql.ErrNoRows {
+				t.Error("Expected =>", sql.ErrNoRows)
+			}
+
+			err = dStore.Update(globex, &store.Driver{ID: 1, Name: "Changed", LicenseNumber: "11-222-35"}, 1)
+			if err != nil {
+				t.Error(err)
+			}
+
+			driver, err = dStore.GetByID(acme, 1)
+			if err != nil {
+				t.Error(err)
+			}
+			t.Log("acme driver =>", driver.Name, driver.LicenseNumber, driver.Version)
+			if driver.Name != "First" || driver.LicenseNumber != "11-222-33" || driver.Version != 1 {
+				t.Error("Expected =>", "First 11-222-33 1")
+			}
+
+			// audit events are isolated as well
+			events, err := aStore.ListAuditEvents(acme, store.AuditFilter{Limit: 10})
+			if err != nil {
+				t.Error(err)
+			}
+			t.Log("len(acme events) =>", len(events))
+			if len(events) != 1 || events[0].After.Name != "First" {
+				t.Error("Expected =>", "the import of First only")
+			}
+			events, err = aStore.ListAuditEvents(globex, store.AuditFilter{DriverID: 1, Limit: 10})
+			if err != nil {
+				t.Error(err)
+			}
+			t.Log("len(globex events) =>", len(events))
+			if len(events) != 2 {
+				t.Error("Expected =>", 2)
+			}
+		})
+	}
+}
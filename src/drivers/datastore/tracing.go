@@ -0,0 +1,74 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracingStore decorates DriversStore to record a span per call,
+// spans carry SQL operation and, for batches, the batch size
+func NewTracingStore(next DriversStore, tracer trace.Tracer) DriversStore {
+	return &tracingStore{
+		next:   next,
+		tracer: tracer,
+	}
+}
+
+// tracingStore is a DriversStore decorator
+type tracingStore struct {
+	next   DriversStore
+	tracer trace.Tracer
+}
+
+func (ts *tracingStore) UpsertBatch(ctx context.Context, drivers []*Driver) (err error) {
+	ctx, span := ts.start(ctx, "UpsertBatch", "INSERT",
+		attribute.Int("db.operation.batch.size", len(drivers)),
+	)
+	defer func() { end(span, err) }()
+	return ts.next.UpsertBatch(ctx, drivers)
+}
+
+func (ts *tracingStore) GetByID(ctx context.Context, id uint64) (driver *Driver, err error) {
+	ctx, span := ts.start(ctx, "GetByID", "SELECT")
+	defer func() { end(span, err) }()
+	return ts.next.GetByID(ctx, id)
+}
+
+func (ts *tracingStore) List(ctx context.Context, afterID uint64, limit int) (drivers []*Driver, err error) {
+	ctx, span := ts.start(ctx, "List", "SELECT",
+		attribute.Int("db.query.limit", limit),
+	)
+	defer func() { end(span, err) }()
+	return ts.next.List(ctx, afterID, limit)
+}
+
+func (ts *tracingStore) Update(ctx context.Context, driver *Driver, ifVersion uint64) (err error) {
+	ctx, span := ts.start(ctx, "Update", "UPDATE")
+	defer func() { end(span, err) }()
+	return ts.next.Update(ctx, driver, ifVersion)
+}
+
+func (ts *tracingStore) start(ctx context.Context, method, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return ts.tracer.Start(ctx, "DriversStore."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", "drivers"),
+		),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// end finishes the span, a missing row is a regular outcome, not a failure
+func end(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows && err != ErrVersionMismatch {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
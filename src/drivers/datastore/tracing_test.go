@@ -0,0 +1,61 @@
+package datastore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingStore(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	dStore := store.NewTracingStore(&mockStore{
+		listErr: errors.New("internal"),
+	}, tp.Tracer("test"))
+
+	dStore.UpsertBatch(context.Background(), make([]*store.Driver, 3))
+	dStore.List(context.Background(), 0, 10)
+
+	spans := exporter.GetSpans()
+	t.Log("len(spans) =>", len(spans))
+	if len(spans) != 2 {
+		t.Error("Expected =>", 2)
+		t.FailNow()
+	}
+
+	t.Log("spans[0].Name =>", spans[0].Name)
+	if spans[0].Name != "DriversStore.UpsertBatch" {
+		t.Error("Expected =>", "DriversStore.UpsertBatch")
+	}
+	attrs := attribute.NewSet(spans[0].Attributes...)
+	operation, _ := attrs.Value("db.operation.name")
+	t.Log("db.operation.name =>", operation.AsString())
+	if operation.AsString() != "INSERT" {
+		t.Error("Expected =>", "INSERT")
+	}
+	batchSize, _ := attrs.Value("db.operation.batch.size")
+	t.Log("db.operation.batch.size =>", batchSize.AsInt64())
+	if batchSize.AsInt64() != 3 {
+		t.Error("Expected =>", 3)
+	}
+	t.Log("spans[0].Status =>", spans[0].Status)
+	if spans[0].Status.Code != codes.Unset {
+		t.Error("Expected =>", codes.Unset)
+	}
+
+	t.Log("spans[1].Name =>", spans[1].Name)
+	if spans[1].Name != "DriversStore.List" {
+		t.Error("Expected =>", "DriversStore.List")
+	}
+	t.Log("spans[1].Status =>", spans[1].Status)
+	if fmt.Sprint(spans[1].Status) != fmt.Sprint(sdktrace.Status{Code: codes.Error, Description: "internal"}) {
+		t.Error("Expected =>", sdktrace.Status{Code: codes.Error, Description: "internal"})
+	}
+}
@@ -1,16 +1,30 @@
 package drivers
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
+	"github.com/konjoot/drivers-go-kit/src/drivers/auth"
+	"github.com/konjoot/drivers-go-kit/src/drivers/codec"
+	"github.com/konjoot/drivers-go-kit/src/drivers/compress"
 	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/ratelimit"
+	"github.com/konjoot/drivers-go-kit/src/drivers/redact"
 	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Router related errors
@@ -19,59 +33,477 @@ var (
 	ErrMethodNotAllowed = errors.New("method is not allowed")
 )
 
+// ErrForbiddenTempl is a template of an error of a missing scope
+var ErrForbiddenTempl = "forbidden; scope %s is required"
+
+// ErrForeignTenant is an error of a tenant in TenantHeader which
+// differs from the tenant of credentials without drivers:tenants scope
+var ErrForeignTenant = errors.New("forbidden; credentials are bound to another tenant")
+
+// TenantHeader is a header with a tenant of drivers of a request,
+// only clients with drivers:tenants scope choose a tenant by it
+const TenantHeader = "X-Tenant-ID"
+
+// DefaultMaxBodyBytes is a default size limit of request bodies
+const DefaultMaxBodyBytes = 1 << 20
+
+// DefaultMaxDecompressedBytes is a default size limit
+// of decompressed bodies of imports
+const DefaultMaxDecompressedBytes = 16 << 20
+
+// DefaultCompressMinBytes is a default minimal size of compressed responses,
+// smaller ones aren't worth it
+const DefaultCompressMinBytes = 1024
+
+// v1Deprecation is the date when API v1 was deprecated in favour of API v2
+var v1Deprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// Option is a functional option of the Drivers app
+type Option func(*options)
+
+type options struct {
+	v1Sunset             time.Time
+	maxBodyBytes         int64
+	maxDecompressedBytes int64
+	codecs               *codec.Registry
+	encodings            compress.Encodings
+	compressMinBytes     int
+	metrics              EndpointMetrics
+	tracer               trace.Tracer
+	settings             *service.AtomicSettings
+	authn                auth.Authenticator
+	apiKeys              store.APIKeysStore
+	audit                store.AuditStore
+	limiter              ratelimit.Limiter
+	budgets              *ratelimit.AtomicBudgets
+	redactor             redact.Redactor
+	redactErrors         bool
+	cors                 CORS
+	trustedProxies       int
+}
+
+// CORS is a policy of cross-origin requests of browsers,
+// CORS is disabled if there are no allowed origins
+type CORS struct {
+	// AllowedOrigins are origins ("https://fleet.example.com")
+	// which may call the API, "*" allows any origin
+	AllowedOrigins []string
+	// AllowedMethods are methods allowed by preflight requests
+	AllowedMethods []string
+	// AllowedHeaders are request headers allowed by preflight
+	// requests, "*" allows any header
+	AllowedHeaders []string
+	// ExposedHeaders are response headers readable by scripts
+	// in addition to CORS-safelisted ones, DefaultCORSExposedHeaders if nil
+	ExposedHeaders []string
+	// AllowCredentials allows cookies, TLS client certificates
+	// and Authorization header of cross-origin requests
+	// of listed origins, never of ones allowed by "*"
+	AllowCredentials bool
+	// MaxAge is a time browsers cache preflight responses for,
+	// browsers pick it themselves if it is 0
+	MaxAge time.Duration
+}
+
+// DefaultCORSExposedHeaders are response headers of the API readable by scripts
+var DefaultCORSExposedHeaders = []string{
+	"ETag", "Link", "Deprecation", "Sunset", "WWW-Authenticate", "X-Request-ID",
+	"Ratelimit-Limit", "Ratelimit-Remaining", "Ratelimit-Reset", "Retry-After",
+}
+
+// EndpointMetrics is a set of metrics collected for every endpoint,
+// they are labelled by "endpoint" and "status"
+type EndpointMetrics struct {
+	Requests metrics.Counter
+	Errors   metrics.Counter
+	Latency  metrics.Histogram
+}
+
+// WithV1Sunset sets the date when API v1 is going to be switched off,
+// it is announced to clients in Sunset header of v1 responses
+func WithV1Sunset(date time.Time) Option {
+	return func(o *options) {
+		o.v1Sunset = date
+	}
+}
+
+// WithMaxBodyBytes sets a size limit of request bodies, larger ones
+// are rejected with 413, 0 disables the limit, DefaultMaxBodyBytes by default
+func WithMaxBodyBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBodyBytes = n
+	}
+}
+
+// WithMaxDecompressedBytes sets a size limit of decompressed bodies of imports
+// (Content-Encoding gzip or br), larger ones are rejected with 413, the limit
+// of WithMaxBodyBytes applies to compressed bodies, 0 rejects compressed
+// bodies with 415, DefaultMaxDecompressedBytes by default
+func WithMaxDecompressedBytes(n int64) Option {
+	return func(o *options) {
+		o.maxDecompressedBytes = n
+	}
+}
+
+// WithCompression sets encodings of responses in order of preference,
+// they are negotiated by Accept-Encoding header, responses smaller than
+// minBytes are not compressed, no encodings disable compression,
+// compress.Default and DefaultCompressMinBytes are used by default
+func WithCompression(encodings compress.Encodings, minBytes int) Option {
+	return func(o *options) {
+		o.encodings = encodings
+		o.compressMinBytes = minBytes
+	}
+}
+
+// WithCodecs sets a registry of codecs available for content negotiation,
+// codec.Default is used by default
+func WithCodecs(codecs *codec.Registry) Option {
+	return func(o *options) {
+		o.codecs = codecs
+	}
+}
+
+// WithMetrics sets metrics of endpoints, they are discarded by default
+func WithMetrics(m EndpointMetrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithTracerProvider sets a provider of tracers for spans of endpoints,
+// the global one (no-op by default) is used by default
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithSettings sets a snapshot of service rules (limits and validation),
+// it can be swapped at runtime, service.DefaultSettings are used by default
+func WithSettings(settings *service.AtomicSettings) Option {
+	return func(o *options) {
+		o.settings = settings
+	}
+}
+
+// WithAuthenticator enables authentication, every endpoint requires
+// a scope: auth.ScopeRead to read drivers, auth.ScopeImport
+// to import and update them, auth.ScopeAdmin to manage API keys,
+// endpoints are open by default
+func WithAuthenticator(a auth.Authenticator) Option {
+	return func(o *options) {
+		o.authn = a
+	}
+}
+
+// WithAPIKeys registers endpoints of API keys management under
+// /api/v2/keys, they are registered only if authentication is enabled
+func WithAPIKeys(keys store.APIKeysStore) Option {
+	return func(o *options) {
+		o.apiKeys = keys
+	}
+}
+
+// WithAudit registers an endpoint of audit events of drivers
+// under /api/v2/audit and /api/audit, it requires auth.ScopeAdmin
+func WithAudit(audit store.AuditStore) Option {
+	return func(o *options) {
+		o.audit = audit
+	}
+}
+
+// WithRateLimit limits rates of requests of every client, a client is
+// identified by the subject of its credentials or by its IP, imports
+// and updates have a budget of their own; every request of an IP is limited
+// by the ip budget before authentication, rates are not limited by default
+func WithRateLimit(l ratelimit.Limiter, budgets *ratelimit.AtomicBudgets) Option {
+	return func(o *options) {
+		o.limiter = l
+		o.budgets = budgets
+	}
+}
+
+// WithRedactor sets a redactor of personal data (license numbers
+// and names) in logs, redact.Default by default, redact.Nop disables it
+func WithRedactor(r redact.Redactor) Option {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
+
+// WithErrorRedaction masks personal data in error responses too,
+// e.g. a license number in a conflict of an import,
+// errors are sent as they are by default
+func WithErrorRedaction(enabled bool) Option {
+	return func(o *options) {
+		o.redactErrors = enabled
+	}
+}
+
+// WithCORS answers preflight requests and allows cross-origin requests
+// of browsers by the policy, cross-origin requests are not allowed by default
+func WithCORS(policy CORS) Option {
+	return func(o *options) {
+		o.cors = policy
+	}
+}
+
+// WithTrustedProxies sets a number of reverse proxies in front of the app
+// (1 behind the Heroku router), the IP of a client is taken from
+// X-Forwarded-For header appended by them, by default the header
+// is not trusted, as clients may forge it, and the remote IP is used
+func WithTrustedProxies(hops int) Option {
+	return func(o *options) {
+		o.trustedProxies = hops
+	}
+}
+
+// tracerName is an instrumentation name of the Drivers app spans
+const tracerName = "github.com/konjoot/drivers-go-kit/src/drivers"
+
 // New is a main constructor of the Drivers app
-func New(logger log.Logger, db store.DriversStore) http.Handler {
-	var (
-		svc     = service.NewDriversService(db)
-		options = []httptransport.ServerOption{
-			httptransport.ServerErrorEncoder(encodeError),
-		}
-	)
+func New(logger log.Logger, db store.DriversStore, opts ...Option) http.Handler {
+	o := options{
+		maxBodyBytes:         DefaultMaxBodyBytes,
+		maxDecompressedBytes: DefaultMaxDecompressedBytes,
+		codecs:               codec.Default,
+		encodings:            compress.Default,
+		compressMinBytes:     DefaultCompressMinBytes,
+		metrics: EndpointMetrics{
+			Requests: discard.NewCounter(),
+			Errors:   discard.NewCounter(),
+			Latency:  discard.NewHistogram(),
+		},
+		tracer:   otel.Tracer(tracerName),
+		redactor: redact.Default,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.redactor == nil {
+		o.redactor = redact.Nop
+	}
+
+	var svcOptions []service.Option
+	if o.settings != nil {
+		svcOptions = append(svcOptions, service.WithSettings(o.settings))
+	}
+	svc := service.NewDriversService(db, svcOptions...)
 
 	router := mux.NewRouter().PathPrefix("/api/").Subrouter()
-	router.Methods("POST").Path("/import").Handler(httptransport.NewServer(
-		logRecoverMiddleware(logger)(service.MakeDriversImportEndpoint(svc)),
-		service.DecodeDriversImportRequest,
-		encodeResponse,
-		options...,
-	))
-	router.Methods("GET").Path("/driver/{id}").Handler(httptransport.NewServer(
-		logRecoverMiddleware(logger)(service.MakeDriversGetByIDEndpoint(svc)),
-		service.DecodeDriversGetByIDRequest,
-		encodeResponse,
-		options...,
-	))
-	router.NotFoundHandler = notFoundHandler{}
-	router.MethodNotAllowedHandler = methodNotAllowedHandler{}
+
+	makeV2Router(router.PathPrefix("/v2/").Subrouter(), svc, o)
+
+	// v1 is served under /api/v1/ and, for existing callers, right under /api/
+	makeV1Router(router.PathPrefix("/v1/").Subrouter(), svc, o)
+	makeV1Router(router, svc, o)
 
 	handler := http.Handler(router)
-	handler = &requestIDMiddleware{router}
+	if len(o.cors.AllowedOrigins) > 0 {
+		handler = newCORSMiddleware(handler, o.cors)
+	}
+	if o.maxBodyBytes > 0 {
+		handler = &bodyLimitMiddleware{handler, o.maxBodyBytes}
+	}
+	handler = &accessLogMiddleware{handler, router, o.trustedProxies}
+	handler = &traceContextMiddleware{handler, propagation.TraceContext{}}
+	handler = &clientSubjectMiddleware{handler}
+	if o.redactErrors {
+		handler = &errorRedactionMiddleware{handler, o.redactor}
+	}
+	handler = &requestIDMiddleware{handler, redact.NewLogger(logger, o.redactor)}
 
 	return handler
 }
 
-func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	return json.NewEncoder(w).Encode(response)
+// makeV1Router registers handlers of API v1 in the router,
+// v1 is deprecated in favour of v2
+func makeV1Router(router *mux.Router, svc service.DriversService, o options) {
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerErrorHandler(logErrorHandler{}),
+		httptransport.ServerBefore(auth.HTTPToContext(), httptransport.PopulateRequestContext, populateClientIP(o.trustedProxies), populateTenant, populateRateLimit),
+		httptransport.ServerAfter(writeRateLimit),
+	}
+	middleware := func(name, scope string) endpoint.Middleware {
+		return endpoint.Chain(
+			tracingMiddleware("v1."+name, o.tracer),
+			instrumentingMiddleware("v1."+name, o.metrics),
+			ipRateLimitMiddleware(o.limiter, o.budgets),
+			authMiddleware(o.authn, scope),
+			tenantMiddleware(),
+			actorMiddleware(),
+			rateLimitMiddleware(o.limiter, o.budgets, scope),
+			logRecoverMiddleware(),
+		)
+	}
+	handler := func(next http.Handler) http.Handler {
+		return &deprecationMiddleware{
+			srv: &negotiationMiddleware{
+				srv:              next,
+				codecs:           o.codecs,
+				encodings:        o.encodings,
+				compressMinBytes: o.compressMinBytes,
+				encodeError:      encodeError,
+			},
+			deprecation:   v1Deprecation,
+			sunset:        o.v1Sunset,
+			documentation: "/",
+			successor:     "/api/v2/",
+		}
+	}
+
+	router.Methods("POST").Path("/import").Handler(handler(&decompressionMiddleware{
+		srv: httptransport.NewServer(
+			middleware("import", auth.ScopeImport)(service.MakeDriversImportEndpoint(svc)),
+			service.DecodeDriversImportRequest,
+			encodeResponse,
+			options...,
+		),
+		limit: o.maxDecompressedBytes,
+	}))
+	router.Methods("GET").Path("/driver/{id}").Handler(handler(httptransport.NewServer(
+		middleware("get_by_id", auth.ScopeRead)(service.MakeDriversGetByIDEndpoint(svc)),
+		service.DecodeDriversGetByIDRequest,
+		encodeResponse,
+		append(options, httptransport.ServerBefore(populateIfNoneMatch))...,
+	)))
+	if o.audit != nil {
+		router.Methods("GET").Path("/audit").Handler(handler(httptransport.NewServer(
+			middleware("audit", auth.ScopeAdmin)(service.MakeAuditListEndpoint(service.NewAuditService(o.audit))),
+			service.DecodeAuditListRequest,
+			encodeResponse,
+			options...,
+		)))
+	}
+	router.NotFoundHandler = errorHandler{ErrHandlerNotFound, encodeError}
+	router.MethodNotAllowedHandler = errorHandler{ErrMethodNotAllowed, encodeError}
+}
+
+// encodeResponse encodes the response with the codec negotiated by Accept header
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if driver, ok := response.(*store.Driver); ok && writeValidators(ctx, w, driver) {
+		return nil
+	}
+	// audit events have been added after v2, so they have its representation
+	if resp, ok := response.(service.AuditListResponse); ok {
+		response = newAuditPageV2(ctx, resp)
+	}
+
+	c := codec.Accepted(ctx)
+	w.Header().Set("Content-Type", c.ContentType())
+	return writeBody(ctx, w, http.StatusOK, c, response)
 }
 
-func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+func encodeError(ctx context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(codeFrom(err))
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error": err.Error(),
+	c := codec.Accepted(ctx)
+	w.Header().Set("Content-Type", c.ContentType())
+	writeErrorHeaders(w, err)
+	writeBody(ctx, w, codeFrom(err), c, errorResponse{
+		Error:     errorRedactorFrom(ctx).Redact(err.Error()),
+		RequestID: requestIDFrom(ctx),
 	})
 }
 
+// writeBody writes the status and the response encoded by the codec,
+// the body is compressed by the encoding negotiated by Accept-Encoding
+// header unless it is too small, so compressed bodies are buffered
+func writeBody(ctx context.Context, w http.ResponseWriter, status int, c codec.Codec, response interface{}) error {
+	comp, ok := ctx.Value(compressionName).(compression)
+	if !ok {
+		w.WriteHeader(status)
+		return c.Encode(w, response)
+	}
+
+	var body bytes.Buffer
+	if err := c.Encode(&body, response); err != nil {
+		return err
+	}
+	if body.Len() < comp.minBytes {
+		w.WriteHeader(status)
+		_, err := body.WriteTo(w)
+		return err
+	}
+
+	w.Header().Set("Content-Encoding", comp.encoding.Name())
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	zw := comp.encoding.NewWriter(w)
+	if _, err := body.WriteTo(zw); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// populateIfNoneMatch stores If-None-Match header into the context
+// for conditional GET requests
+func populateIfNoneMatch(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, ifNoneMatchName, r.Header.Get("If-None-Match"))
+}
+
+// writeValidators sets ETag and Last-Modified headers of the driver,
+// if the driver matches If-None-Match of a request it responds
+// with 304 and reports true, so the body should not be written
+func writeValidators(ctx context.Context, w http.ResponseWriter, driver *store.Driver) bool {
+	if driver.Version == 0 {
+		return false
+	}
+
+	etag := service.ETag(driver.Version, representation(ctx))
+	w.Header().Set("ETag", etag)
+	if !driver.UpdatedAt.IsZero() {
+		w.Header().Set("Last-Modified", driver.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+
+	ifNoneMatch, _ := ctx.Value(ifNoneMatchName).(string)
+	if ifNoneMatch != "" && service.ETagMatches(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// representation names the codec and the content coding negotiated
+// for the response (e.g. "json", "xml-br"), they are varied by Accept
+// and Accept-Encoding headers, the coding is named even if the body
+// is too small to be compressed, as it depends on the version only
+func representation(ctx context.Context) string {
+	mediaType := codec.Accepted(ctx).MediaTypes()[0]
+	name := strings.TrimPrefix(mediaType[strings.IndexByte(mediaType, '/')+1:], "x-")
+	if comp, ok := ctx.Value(compressionName).(compression); ok {
+		name += "-" + comp.encoding.Name()
+	}
+	return name
+}
+
+// errorResponse is an error representation of v1
+type errorResponse struct {
+	XMLName   xml.Name `json:"-" xml:"error"`
+	Error     string   `json:"error" xml:"message"`
+	RequestID string   `json:"request_id,omitempty" xml:"request_id,omitempty"`
+}
+
+// MarshalProto implements codec.ProtoMarshaler, errorResponse is an Error message
+func (er errorResponse) MarshalProto() ([]byte, error) {
+	b := codec.AppendProtoString(nil, 1, er.Error)
+	return codec.AppendProtoString(b, 2, er.RequestID), nil
+}
+
 func codeFrom(err error) int {
 	switch err {
 	case ErrHandlerNotFound:
 		return http.StatusNotFound
 	case ErrMethodNotAllowed:
 		return http.StatusMethodNotAllowed
+	case codec.ErrNotAcceptable:
+		return http.StatusNotAcceptable
+	case codec.ErrUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
 	}
 
 	if serr, ok := err.(statuser); ok {
@@ -85,14 +517,27 @@ type statuser interface {
 	Status() int
 }
 
-type notFoundHandler struct{}
-
-func (notFoundHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
-	encodeError(context.Background(), ErrHandlerNotFound, w)
+// writeErrorHeaders sets headers of errors implementing
+// httptransport.Headerer, e.g. WWW-Authenticate of 401
+func writeErrorHeaders(w http.ResponseWriter, err error) {
+	var headerer httptransport.Headerer
+	if !errors.As(err, &headerer) {
+		return
+	}
+	for k, values := range headerer.Headers() {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
 }
 
-type methodNotAllowedHandler struct{}
+// errorHandler responds to every request with err
+// encoded by the version specific error encoder
+type errorHandler struct {
+	err    error
+	encode httptransport.ErrorEncoder
+}
 
-func (methodNotAllowedHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
-	encodeError(context.Background(), ErrMethodNotAllowed, w)
+func (eh errorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	eh.encode(r.Context(), eh.err, w)
 }
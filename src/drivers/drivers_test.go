@@ -3,15 +3,43 @@ package drivers_test
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/konjoot/drivers-go-kit/src/drivers"
+	"github.com/konjoot/drivers-go-kit/src/drivers/auth"
+	"github.com/konjoot/drivers-go-kit/src/drivers/codec"
+	"github.com/konjoot/drivers-go-kit/src/drivers/compress"
 	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/ratelimit"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestDrivers(t *testing.T) {
@@ -28,6 +56,19 @@ func TestDrivers(t *testing.T) {
 
 	srv.ServeHTTP(response, request)
 
+	deprecation := response.Header().Get("Deprecation")
+	t.Log("response Deprecation =>", deprecation)
+	if deprecation != "@1792368000" {
+		t.Error("Expected =>", "@1792368000")
+	}
+
+	links := response.Header().Values("Link")
+	t.Log("response Link =>", links)
+	expLinks := []string{`</>; rel="deprecation"; type="text/html"`, `</api/v2/>; rel="successor-version"`}
+	if !reflect.DeepEqual(links, expLinks) {
+		t.Error("Expected =>", expLinks)
+	}
+
 	contentType := response.Header().Get("Content-Type")
 	t.Log("response Content-Type =>", contentType)
 	if contentType != "application/json; charset=utf-8" {
@@ -74,6 +115,7 @@ func TestDrivers(t *testing.T) {
 	}
 
 	request = httptest.NewRequest("GET", "/api/driver/1345", nil)
+	request.Header.Set("X-Request-ID", "1a2b3c")
 	response = httptest.NewRecorder()
 
 	srv.ServeHTTP(response, request)
@@ -94,31 +136,2632 @@ func TestDrivers(t *testing.T) {
 		t.Error(err)
 	}
 	t.Log("response body =>", string(bts))
-	if string(bts) != `{"error":"status=404, error=driver with id=1345 is not found"}`+"\n" {
-		t.Error("Expected =>", `{"error":"status=404, error=driver with id=1345 is not found"}`+"\n")
+	if string(bts) != `{"error":"status=404, error=driver with id=1345 is not found","request_id":"1a2b3c"}`+"\n" {
+		t.Error("Expected =>", `{"error":"status=404, error=driver with id=1345 is not found","request_id":"1a2b3c"}`+"\n")
+	}
+}
+
+func TestDriversV1Sunset(t *testing.T) {
+	inMemStore := &inMemStorage{
+		db: map[uint64]*store.Driver{
+			1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		},
+	}
+	srv := drivers.New(nopLogger{}, inMemStore,
+		drivers.WithV1Sunset(time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)),
+	)
+
+	for _, path := range []string{"/api/driver/1", "/api/v1/driver/1"} {
+		request := httptest.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+
+		srv.ServeHTTP(response, request)
+
+		t.Log("response status =>", response.Code)
+		if response.Code != http.StatusOK {
+			t.Error("Expected =>", http.StatusOK)
+		}
+
+		sunset := response.Header().Get("Sunset")
+		t.Log("response Sunset =>", sunset)
+		if sunset != "Tue, 01 Jan 2030 00:00:00 GMT" {
+			t.Error("Expected =>", "Tue, 01 Jan 2030 00:00:00 GMT")
+		}
+	}
+
+	request := httptest.NewRequest("GET", "/api/v2/drivers/1", nil)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	t.Log("response Deprecation =>", response.Header().Get("Deprecation"))
+	if response.Header().Get("Deprecation") != "" {
+		t.Error("Expected =>", "")
+	}
+	t.Log("response Sunset =>", response.Header().Get("Sunset"))
+	if response.Header().Get("Sunset") != "" {
+		t.Error("Expected =>", "")
+	}
+}
+
+func TestDriversV2(t *testing.T) {
+	inMemStore := &inMemStorage{
+		db: make(map[uint64]*store.Driver),
+	}
+	srv := drivers.New(nopLogger{}, inMemStore)
+
+	request := httptest.NewRequest("POST",
+		"/api/v2/import",
+		bytes.NewBuffer([]byte(`[
+			{"id":1,"name":"John","license_number":"11-222-33"},
+			{"id":2,"name":"Jane","license_number":"11-222-34"},
+			{"id":3,"name":"Jack","license_number":"11-222-35"}
+		]`)),
+	)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	t.Log("response status =>", response.Code)
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+
+	for _, tc := range []struct {
+		name           string
+		method         string
+		path           string
+		expStatus      int
+		expContentType string
+		expBody        string
+	}{
+		{
+			name:           "GetByID",
+			method:         "GET",
+			path:           "/api/v2/drivers/1",
+			expStatus:      http.StatusOK,
+			expContentType: "application/json; charset=utf-8",
+			expBody:        `{"id":1,"name":"John","license_number":"11-222-33","links":{"self":"/api/v2/drivers/1"}}`,
+		},
+		{
+			name:           "ListFirstPage",
+			method:         "GET",
+			path:           "/api/v2/drivers?limit=2",
+			expStatus:      http.StatusOK,
+			expContentType: "application/json; charset=utf-8",
+			expBody: `{"data":[` +
+				`{"id":1,"name":"John","license_number":"11-222-33","links":{"self":"/api/v2/drivers/1"}},` +
+				`{"id":2,"name":"Jane","license_number":"11-222-34","links":{"self":"/api/v2/drivers/2"}}` +
+				`],"links":{"next":"/api/v2/drivers?after=2\u0026limit=2"}}`,
+		},
+		{
+			name:           "ListLastPage",
+			method:         "GET",
+			path:           "/api/v2/drivers?after=2&limit=2",
+			expStatus:      http.StatusOK,
+			expContentType: "application/json; charset=utf-8",
+			expBody: `{"data":[` +
+				`{"id":3,"name":"Jack","license_number":"11-222-35","links":{"self":"/api/v2/drivers/3"}}` +
+				`],"links":{}}`,
+		},
+		{
+			name:           "ListInvalidLimit",
+			method:         "GET",
+			path:           "/api/v2/drivers?limit=0",
+			expStatus:      http.StatusBadRequest,
+			expContentType: "application/problem+json; charset=utf-8",
+			expBody:        `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid value; limit should be from 1 to 1000, but not 0","request_id":"1a2b3c"}`,
+		},
+		{
+			name:           "NotFound",
+			method:         "GET",
+			path:           "/api/v2/drivers/1345",
+			expStatus:      http.StatusNotFound,
+			expContentType: "application/problem+json; charset=utf-8",
+			expBody:        `{"type":"about:blank","title":"Not Found","status":404,"detail":"driver with id=1345 is not found","request_id":"1a2b3c"}`,
+		},
+		{
+			name:           "HandlerNotFound",
+			method:         "GET",
+			path:           "/api/v2/driver/1",
+			expStatus:      http.StatusNotFound,
+			expContentType: "application/problem+json; charset=utf-8",
+			expBody:        `{"type":"about:blank","title":"Not Found","status":404,"detail":"handler for the route is not found","request_id":"1a2b3c"}`,
+		},
+		{
+			name:           "MethodNotAllowed",
+			method:         "DELETE",
+			path:           "/api/v2/drivers/1",
+			expStatus:      http.StatusMethodNotAllowed,
+			expContentType: "application/problem+json; charset=utf-8",
+			expBody:        `{"type":"about:blank","title":"Method Not Allowed","status":405,"detail":"method is not allowed","request_id":"1a2b3c"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, nil)
+			request.Header.Set("X-Request-ID", "1a2b3c")
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+
+			contentType := response.Header().Get("Content-Type")
+			t.Log("response Content-Type =>", contentType)
+			if contentType != tc.expContentType {
+				t.Error("Expected =>", tc.expContentType)
+			}
+
+			bts, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			t.Log("response body =>", string(bts))
+			if string(bts) != tc.expBody+"\n" {
+				t.Error("Expected =>", tc.expBody)
+			}
+		})
+	}
+}
+
+func TestDriversDecoding(t *testing.T) {
+	storage := &inMemStorage{db: make(map[uint64]*store.Driver)}
+	srv := drivers.New(nopLogger{}, storage, drivers.WithMaxBodyBytes(128))
+	strict := drivers.New(nopLogger{}, storage, drivers.WithCodecs(codec.Strict))
+
+	for _, tc := range []struct {
+		name      string
+		srv       http.Handler
+		method    string
+		path      string
+		body      string
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:      "InvalidType",
+			srv:       srv,
+			method:    "POST",
+			path:      "/api/v2/import",
+			body:      `[{"id":1,"name":"John","license_number":"11-222-33"},{"id":"2"}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid body; $[1].id: should be integer, but not string","request_id":"1a2b3c","path":"$[1].id"}`,
+		},
+		{
+			name:      "InvalidTypeV1",
+			srv:       srv,
+			method:    "POST",
+			path:      "/api/import",
+			body:      `[{"id":1,"name":5}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"error":"status=400, error=invalid body; $[0].name: should be string, but not number","request_id":"1a2b3c"}`,
+		},
+		{
+			name:      "TrailingData",
+			srv:       srv,
+			method:    "PUT",
+			path:      "/api/v2/drivers/1",
+			body:      `{"id":1,"name":"John","license_number":"11-222-33"}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid body; $: unexpected data after the value","request_id":"1a2b3c","path":"$"}`,
+		},
+		{
+			name:      "TooLarge",
+			srv:       srv,
+			method:    "POST",
+			path:      "/api/v2/import",
+			body:      `[{"id":1,"name":"` + strings.Repeat("John", 32) + `","license_number":"11-222-33"}]`,
+			expStatus: http.StatusRequestEntityTooLarge,
+			expBody:   `{"type":"about:blank","title":"Request Entity Too Large","status":413,"detail":"body is too large; it should be up to 128 bytes","request_id":"1a2b3c"}`,
+		},
+		{
+			name:      "InvalidID",
+			srv:       srv,
+			method:    "GET",
+			path:      "/api/v2/drivers/john",
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid format; id field should match uint64, but was john","request_id":"1a2b3c"}`,
+		},
+		{
+			name:      "UnknownField",
+			srv:       srv,
+			method:    "POST",
+			path:      "/api/v2/import",
+			body:      `[{"id":1,"name":"John","license_number":"11-222-33","age":30}]`,
+			expStatus: http.StatusOK,
+			expBody:   `{}`,
+		},
+		{
+			name:      "StrictUnknownField",
+			srv:       strict,
+			method:    "POST",
+			path:      "/api/v2/import",
+			body:      `[{"id":1,"name":"John","license_number":"11-222-33","age":30}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid body; $[0].age: unknown field","request_id":"1a2b3c","path":"$[0].age"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			request.Header.Set("X-Request-ID", "1a2b3c")
+			response := httptest.NewRecorder()
+
+			tc.srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			t.Log("response body =>", response.Body.String())
+			if response.Body.String() != tc.expBody+"\n" {
+				t.Error("Expected =>", tc.expBody)
+			}
+		})
+	}
+}
+
+func TestDriversContentNegotiation(t *testing.T) {
+	inMemStore := &inMemStorage{
+		db: make(map[uint64]*store.Driver),
+	}
+	srv := drivers.New(nopLogger{}, inMemStore)
+
+	var body bytes.Buffer
+	err := codec.MsgPack.Encode(&body, []*store.Driver{
+		{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+	})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	request := httptest.NewRequest("POST", "/api/import", &body)
+	request.Header.Set("Content-Type", "application/msgpack")
+	request.Header.Set("Accept", "application/xml")
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	t.Log("response status =>", response.Code)
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+
+	for _, tc := range []struct {
+		name           string
+		method         string
+		path           string
+		contentType    string
+		accept         string
+		body           string
+		expStatus      int
+		expContentType string
+		expBody        string
+	}{
+		{
+			name:           "XML",
+			method:         "GET",
+			path:           "/api/driver/1",
+			accept:         "application/xml",
+			expStatus:      http.StatusOK,
+			expContentType: "application/xml; charset=utf-8",
+			expBody:        `<driver><id>1</id><name>John</name><license_number>11-222-33</license_number></driver>`,
+		},
+		{
+			name:           "XMLError",
+			method:         "GET",
+			path:           "/api/driver/2",
+			accept:         "text/xml",
+			expStatus:      http.StatusNotFound,
+			expContentType: "application/xml; charset=utf-8",
+			expBody:        `<error><message>status=404, error=driver with id=2 is not found</message><request_id>1a2b3c</request_id></error>`,
+		},
+		{
+			name:           "V2Protobuf",
+			method:         "GET",
+			path:           "/api/v2/drivers/1",
+			accept:         "application/protobuf",
+			expStatus:      http.StatusOK,
+			expContentType: "application/protobuf",
+			expBody:        "\x08\x01\x12\x04John\x1a\x0911-222-33\x22\x13\x0a\x11/api/v2/drivers/1",
+		},
+		{
+			name:           "NotAcceptable",
+			method:         "GET",
+			path:           "/api/driver/1",
+			accept:         "image/png",
+			expStatus:      http.StatusNotAcceptable,
+			expContentType: "application/json; charset=utf-8",
+			expBody:        `{"error":"none of the accepted media types is supported","request_id":"1a2b3c"}` + "\n",
+		},
+		{
+			name:           "V2NotAcceptable",
+			method:         "GET",
+			path:           "/api/v2/drivers/1",
+			accept:         "image/png",
+			expStatus:      http.StatusNotAcceptable,
+			expContentType: "application/problem+json; charset=utf-8",
+			expBody:        `{"type":"about:blank","title":"Not Acceptable","status":406,"detail":"none of the accepted media types is supported","request_id":"1a2b3c"}` + "\n",
+		},
+		{
+			name:           "UnsupportedMediaType",
+			method:         "POST",
+			path:           "/api/import",
+			contentType:    "text/plain",
+			body:           "1,John,11-222-33",
+			expStatus:      http.StatusUnsupportedMediaType,
+			expContentType: "application/json; charset=utf-8",
+			expBody:        `{"error":"status=415, error=media type of the request body is not supported","request_id":"1a2b3c"}` + "\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			request.Header.Set("Content-Type", tc.contentType)
+			request.Header.Set("X-Request-ID", "1a2b3c")
+			request.Header.Set("Accept", tc.accept)
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+
+			contentType := response.Header().Get("Content-Type")
+			t.Log("response Content-Type =>", contentType)
+			if contentType != tc.expContentType {
+				t.Error("Expected =>", tc.expContentType)
+			}
+
+			t.Log("response Vary =>", response.Header().Get("Vary"))
+			if response.Header().Get("Vary") != "Accept" {
+				t.Error("Expected =>", "Accept")
+			}
+
+			bts, err := ioutil.ReadAll(response.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			t.Logf("response body => %q", bts)
+			if string(bts) != tc.expBody {
+				t.Errorf("Expected => %q", tc.expBody)
+			}
+		})
+	}
+}
+
+func TestDriversConditionalRequests(t *testing.T) {
+	inMemStore := &inMemStorage{
+		db: make(map[uint64]*store.Driver),
+	}
+	srv := drivers.New(nopLogger{}, inMemStore)
+
+	request := httptest.NewRequest("POST",
+		"/api/v2/import",
+		bytes.NewBuffer([]byte(`[{"id":1,"name":"John","license_number":"11-222-33"}]`)),
+	)
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	t.Log("response status =>", response.Code)
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		path        string
+		headers     map[string]string
+		body        string
+		expStatus   int
+		expETag     string
+		expBodySize bool
+	}{
+		{
+			name:        "GetV1",
+			method:      "GET",
+			path:        "/api/driver/1",
+			expStatus:   http.StatusOK,
+			expETag:     `"1-json"`,
+			expBodySize: true,
+		},
+		{
+			name:      "GetV1NotModified",
+			method:    "GET",
+			path:      "/api/driver/1",
+			headers:   map[string]string{"If-None-Match": `"1-json"`},
+			expStatus: http.StatusNotModified,
+			expETag:   `"1-json"`,
+		},
+		{
+			name:        "GetV2Modified",
+			method:      "GET",
+			path:        "/api/v2/drivers/1",
+			headers:     map[string]string{"If-None-Match": `"7", "8"`},
+			expStatus:   http.StatusOK,
+			expETag:     `"1-json"`,
+			expBodySize: true,
+		},
+		{
+			name:        "UpdateIfMatch",
+			method:      "PUT",
+			path:        "/api/v2/drivers/1",
+			headers:     map[string]string{"If-Match": `"1"`},
+			body:        `{"name":"John Doe","license_number":"11-222-33"}`,
+			expStatus:   http.StatusOK,
+			expETag:     `"2-json"`,
+			expBodySize: true,
+		},
+		{
+			name:        "GetV2OtherCodec",
+			method:      "GET",
+			path:        "/api/v2/drivers/1",
+			headers:     map[string]string{"Accept": "application/xml", "If-None-Match": `"2-json"`},
+			expStatus:   http.StatusOK,
+			expETag:     `"2-xml"`,
+			expBodySize: true,
+		},
+		{
+			name:        "GetV2OtherCoding",
+			method:      "GET",
+			path:        "/api/v2/drivers/1",
+			headers:     map[string]string{"Accept-Encoding": "gzip", "If-None-Match": `"2-json"`},
+			expStatus:   http.StatusOK,
+			expETag:     `"2-json-gzip"`,
+			expBodySize: true,
+		},
+		{
+			name:      "GetV2NotModifiedOfCoding",
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			headers:   map[string]string{"Accept-Encoding": "br", "If-None-Match": `"2-json", "2-json-br"`},
+			expStatus: http.StatusNotModified,
+			expETag:   `"2-json-br"`,
+		},
+		{
+			name:        "UpdateIfMatchStale",
+			method:      "PUT",
+			path:        "/api/v2/drivers/1",
+			headers:     map[string]string{"If-Match": `"1"`},
+			body:        `{"name":"Johnny","license_number":"11-222-33"}`,
+			expStatus:   http.StatusPreconditionFailed,
+			expBodySize: true,
+		},
+		{
+			name:        "UpdateIfMatchWeak",
+			method:      "PUT",
+			path:        "/api/v2/drivers/1",
+			headers:     map[string]string{"If-Match": `W/"2-json"`},
+			body:        `{"name":"Johnny","license_number":"11-222-33"}`,
+			expStatus:   http.StatusPreconditionFailed,
+			expBodySize: true,
+		},
+		{
+			name:        "UpdateIfMatchOfOtherRepresentation",
+			method:      "PUT",
+			path:        "/api/v2/drivers/1",
+			headers:     map[string]string{"If-Match": `"2-xml-gzip"`},
+			body:        `{"name":"John Doe","license_number":"11-222-33"}`,
+			expStatus:   http.StatusOK,
+			expETag:     `"3-json"`,
+			expBodySize: true,
+		},
+		{
+			name:        "UpdateIDMismatch",
+			method:      "PUT",
+			path:        "/api/v2/drivers/1",
+			body:        `{"id":2,"name":"Johnny","license_number":"11-222-33"}`,
+			expStatus:   http.StatusBadRequest,
+			expBodySize: true,
+		},
+		{
+			name:        "UpdateNotFound",
+			method:      "PUT",
+			path:        "/api/v2/drivers/2",
+			body:        `{"name":"Johnny","license_number":"11-222-33"}`,
+			expStatus:   http.StatusNotFound,
+			expBodySize: true,
+		},
+		{
+			name:      "GetV2NotModifiedWeak",
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			headers:   map[string]string{"If-None-Match": `W/"3-json"`},
+			expStatus: http.StatusNotModified,
+			expETag:   `"3-json"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+			for k, v := range tc.headers {
+				request.Header.Set(k, v)
+			}
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+
+			etag := response.Header().Get("ETag")
+			t.Log("response ETag =>", etag)
+			if etag != tc.expETag {
+				t.Error("Expected =>", tc.expETag)
+			}
+
+			t.Log("response body =>", response.Body.String())
+			if (response.Body.Len() > 0) != tc.expBodySize {
+				t.Error("Expected body =>", tc.expBodySize)
+			}
+		})
+	}
+}
+
+func TestDriversMetrics(t *testing.T) {
+	var (
+		requests = &counter{values: make(map[string]float64)}
+		errs     = &counter{values: make(map[string]float64)}
+		latency  = histogram{&counter{values: make(map[string]float64)}}
+	)
+	inMemStore := &inMemStorage{
+		db: make(map[uint64]*store.Driver),
+	}
+	srv := drivers.New(nopLogger{}, inMemStore, drivers.WithMetrics(drivers.EndpointMetrics{
+		Requests: requests,
+		Errors:   errs,
+		Latency:  latency,
+	}))
+
+	for _, path := range []string{"/api/driver/1", "/api/v2/drivers/1", "/api/v2/drivers?limit=0"} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST",
+		"/api/import",
+		bytes.NewBuffer([]byte(`[{"id":1,"name":"John","license_number":"11-222-33"}]`)),
+	))
+
+	t.Log("requests =>", requests.values)
+	if fmt.Sprint(requests.values) != "map["+
+		"endpoint=v1.get_by_id,status=404:1 "+
+		"endpoint=v1.import,status=200:1 "+
+		"endpoint=v2.get_by_id,status=404:1 "+
+		"endpoint=v2.list,status=400:1]" {
+		t.Error("Expected a request per endpoint")
+	}
+
+	t.Log("errors =>", errs.values)
+	if fmt.Sprint(errs.values) != "map["+
+		"endpoint=v1.get_by_id,status=404:1 "+
+		"endpoint=v2.get_by_id,status=404:1 "+
+		"endpoint=v2.list,status=400:1]" {
+		t.Error("Expected an error per failed endpoint")
+	}
+
+	t.Log("latency =>", latency.c.values)
+	if fmt.Sprint(latency.c.values) != fmt.Sprint(requests.values) {
+		t.Error("Expected an observation per request")
+	}
+}
+
+func TestDriversTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	inMemStore := &inMemStorage{
+		db: map[uint64]*store.Driver{
+			1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		},
+	}
+	srv := drivers.New(nopLogger{},
+		store.NewTracingStore(inMemStore, tp.Tracer("store")),
+		drivers.WithTracerProvider(tp),
+	)
+
+	request := httptest.NewRequest("GET", "/api/v2/drivers/2", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	response := httptest.NewRecorder()
+
+	srv.ServeHTTP(response, request)
+
+	spans := exporter.GetSpans()
+	t.Log("len(spans) =>", len(spans))
+	if len(spans) != 2 {
+		t.Error("Expected =>", 2)
+		t.FailNow()
+	}
+
+	// spans are exported in order of their ending
+	storeSpan, endpointSpan := spans[0], spans[1]
+
+	t.Log("endpointSpan.Name =>", endpointSpan.Name)
+	if endpointSpan.Name != "v2.get_by_id" {
+		t.Error("Expected =>", "v2.get_by_id")
+	}
+	t.Log("endpointSpan.TraceID =>", endpointSpan.SpanContext.TraceID())
+	if endpointSpan.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Error("Expected =>", "4bf92f3577b34da6a3ce929d0e0e4736")
+	}
+	t.Log("endpointSpan.Parent =>", endpointSpan.Parent.SpanID())
+	if endpointSpan.Parent.SpanID().String() != "00f067aa0ba902b7" || !endpointSpan.Parent.IsRemote() {
+		t.Error("Expected remote parent =>", "00f067aa0ba902b7")
+	}
+	t.Log("endpointSpan.Status =>", endpointSpan.Status)
+	if endpointSpan.Status.Code != codes.Error {
+		t.Error("Expected =>", codes.Error)
+	}
+	attrs := attribute.NewSet(endpointSpan.Attributes...)
+	status, _ := attrs.Value("http.response.status_code")
+	t.Log("http.response.status_code =>", status.AsInt64())
+	if status.AsInt64() != http.StatusNotFound {
+		t.Error("Expected =>", http.StatusNotFound)
+	}
+
+	t.Log("storeSpan.Name =>", storeSpan.Name)
+	if storeSpan.Name != "DriversStore.GetByID" {
+		t.Error("Expected =>", "DriversStore.GetByID")
+	}
+	t.Log("storeSpan.Parent =>", storeSpan.Parent.SpanID())
+	if storeSpan.Parent.SpanID() != endpointSpan.SpanContext.SpanID() {
+		t.Error("Expected =>", endpointSpan.SpanContext.SpanID())
+	}
+	t.Log("storeSpan.Status =>", storeSpan.Status)
+	if storeSpan.Status.Code != codes.Unset {
+		t.Error("Expected =>", codes.Unset)
+	}
+}
+
+func TestDriversRequestID(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		requestID string
+		expEcho   bool
+	}{
+		{
+			name:    "Missing",
+			expEcho: false,
+		},
+		{
+			name:      "Heroku",
+			requestID: "f4d3a4c6-8d0e-4b5f-9f0a-2f4c3d1e0b7a",
+			expEcho:   true,
+		},
+		{
+			name:      "Invalid",
+			requestID: "id\n level=error msg=forged",
+			expEcho:   false,
+		},
+		{
+			name:      "TooLong",
+			requestID: strings.Repeat("a", 129),
+			expEcho:   false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			srv := drivers.New(log.NewLogfmtLogger(&logs), &inMemStorage{
+				db: make(map[uint64]*store.Driver),
+			})
+
+			request := httptest.NewRequest("GET", "/api/v2/drivers/1", nil)
+			if tc.requestID != "" {
+				request.Header.Set("X-Request-ID", tc.requestID)
+			}
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			requestID := response.Header().Get("X-Request-ID")
+			t.Log("response X-Request-ID =>", requestID)
+			if tc.expEcho && requestID != tc.requestID {
+				t.Error("Expected =>", tc.requestID)
+			}
+			if !tc.expEcho {
+				if _, err := uuid.Parse(requestID); err != nil {
+					t.Error("Expected generated UUID =>", err)
+				}
+			}
+
+			t.Log("response body =>", response.Body.String())
+			if !strings.Contains(response.Body.String(), `"request_id":"`+requestID+`"`) {
+				t.Error("Expected request_id in the problem =>", requestID)
+			}
+
+			t.Log("logs =>", logs.String())
+			if !strings.Contains(logs.String(), "request_id="+requestID) {
+				t.Error("Expected request_id in logs =>", requestID)
+			}
+		})
+	}
+}
+
+func TestDriversAccessLog(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		method     string
+		path       string
+		tls        *tls.ConnectionState
+		getByIDErr error
+		expLog     []string
+	}{
+		{
+			name:   "OK",
+			method: "GET",
+			path:   "/api/v2/drivers/1",
+			expLog: []string{
+				"level=info",
+				"method=GET",
+				"route=/api/v2/drivers/{id}",
+				"path=/api/v2/drivers/1",
+				"status=200",
+				"bytes=89",
+				"remote_ip=192.0.2.1",
+				"client_ip=192.0.2.1",
+				"request_id=1a2b3c",
+			},
+		},
+		{
+			name:   "DecodeError",
+			method: "GET",
+			path:   "/api/v2/drivers?limit=0",
+			expLog: []string{
+				"level=warn",
+				`err="status=400, error=invalid value; limit should be from 1 to 1000, but not 0"`,
+				"level=info",
+				"route=/api/v2/drivers",
+				"status=400",
+			},
+		},
+		{
+			name:   "HandlerNotFound",
+			method: "GET",
+			path:   "/api/v2/driver/1",
+			expLog: []string{
+				"level=info",
+				"route=/api/v2/ ",
+				"path=/api/v2/driver/1",
+				"status=404",
+			},
+		},
+		{
+			name:   "ClientCertificate",
+			method: "GET",
+			path:   "/api/v2/drivers/1",
+			tls: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+				{Subject: pkix.Name{CommonName: "importer", Organization: []string{"Drivers"}}},
+			}}},
+			expLog: []string{
+				"level=info",
+				"status=200",
+				`client="CN=importer,O=Drivers"`,
+			},
+		},
+		{
+			name:       "ServerError",
+			method:     "GET",
+			path:       "/api/v2/drivers/1",
+			getByIDErr: errors.New("internal"),
+			expLog: []string{
+				"level=error",
+				`err="status=500, error=internal"`,
+				"status=500",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			srv := drivers.New(log.NewLogfmtLogger(&logs), &inMemStorage{
+				db: map[uint64]*store.Driver{
+					1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+				},
+				getByIDErr: tc.getByIDErr,
+			})
+
+			request := httptest.NewRequest(tc.method, tc.path, nil)
+			request.Header.Set("X-Request-ID", "1a2b3c")
+			request.TLS = tc.tls
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("logs =>", logs.String())
+			for _, kv := range tc.expLog {
+				if !strings.Contains(logs.String(), kv) {
+					t.Error("Expected =>", kv)
+				}
+			}
+		})
+	}
+}
+
+func TestDriversAuth(t *testing.T) {
+	keys := newInMemKeys(map[string][]string{
+		"drv_reader":   {auth.ScopeRead},
+		"drv_importer": {auth.ScopeRead, auth.ScopeImport},
+		"drv_admin":    {auth.ScopeAdmin},
+	})
+	srv := drivers.New(nopLogger{}, &inMemStorage{
+		db: map[uint64]*store.Driver{
+			1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		},
+	}, drivers.WithAuthenticator(auth.Schemes{auth.SchemeAPIKey: auth.NewAPIKeys(keys)}))
+
+	importBody := `[{"id":2,"name":"Jane","license_number":"11-222-34"}]`
+
+	for _, tc := range []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		header       string
+		value        string
+		expStatus    int
+		expChallenge string
+		expBody      string
+	}{
+		{
+			name:         "NoCredentials",
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			expStatus:    http.StatusUnauthorized,
+			expChallenge: `ApiKey realm="drivers"`,
+			expBody:      `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"unauthenticated; credentials are missing","request_id":"1a2b3c"}`,
+		},
+		{
+			name:         "UnknownKey",
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			header:       "X-API-Key",
+			value:        "drv_unknown",
+			expStatus:    http.StatusUnauthorized,
+			expChallenge: `ApiKey realm="drivers"`,
+			expBody:      `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"unauthenticated; credentials are invalid; API key is unknown or revoked","request_id":"1a2b3c"}`,
+		},
+		{
+			name:         "UnsupportedScheme",
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			header:       "Authorization",
+			value:        "Basic ZHJpdmVyczpzM2NyM3Q=",
+			expStatus:    http.StatusUnauthorized,
+			expChallenge: `ApiKey realm="drivers"`,
+			expBody:      `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"unauthenticated; credentials are invalid; unsupported scheme \"Basic\"","request_id":"1a2b3c"}`,
+		},
+		{
+			name:      "Read",
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			header:    "Authorization",
+			value:     "apikey drv_reader",
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"name":"John","license_number":"11-222-33","links":{"self":"/api/v2/drivers/1"}}`,
+		},
+		{
+			name:      "ImportWithoutScope",
+			method:    "POST",
+			path:      "/api/v2/import",
+			body:      importBody,
+			header:    "X-API-Key",
+			value:     "drv_reader",
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; scope drivers:import is required","request_id":"1a2b3c"}`,
+		},
+		{
+			name:      "Import",
+			method:    "POST",
+			path:      "/api/v2/import",
+			body:      importBody,
+			header:    "X-API-Key",
+			value:     "drv_importer",
+			expStatus: http.StatusOK,
+			expBody:   `{}`,
+		},
+		{
+			name:      "AdminAllowsEverything",
+			method:    "POST",
+			path:      "/api/v2/import",
+			body:      importBody,
+			header:    "X-API-Key",
+			value:     "drv_admin",
+			expStatus: http.StatusOK,
+			expBody:   `{}`,
+		},
+		{
+			name:         "V1NoCredentials",
+			method:       "POST",
+			path:         "/api/import",
+			body:         importBody,
+			expStatus:    http.StatusUnauthorized,
+			expChallenge: `ApiKey realm="drivers"`,
+			expBody:      `{"error":"status=401, error=unauthenticated; credentials are missing","request_id":"1a2b3c"}`,
+		},
+		{
+			name:      "V1ImportWithoutScope",
+			method:    "POST",
+			path:      "/api/import",
+			body:      importBody,
+			header:    "X-API-Key",
+			value:     "drv_reader",
+			expStatus: http.StatusForbidden,
+			expBody:   `{"error":"status=403, error=forbidden; scope drivers:import is required","request_id":"1a2b3c"}`,
+		},
+		{
+			name:      "V1Read",
+			method:    "GET",
+			path:      "/api/driver/1",
+			header:    "X-API-Key",
+			value:     "drv_reader",
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"name":"John","license_number":"11-222-33"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			request.Header.Set("X-Request-ID", "1a2b3c")
+			if tc.header != "" {
+				request.Header.Set(tc.header, tc.value)
+			}
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			challenge := response.Header().Get("WWW-Authenticate")
+			t.Log("response WWW-Authenticate =>", challenge)
+			if challenge != tc.expChallenge {
+				t.Error("Expected =>", tc.expChallenge)
+			}
+			t.Log("response body =>", response.Body.String())
+			if response.Body.String() != tc.expBody+"\n" {
+				t.Error("Expected =>", tc.expBody)
+			}
+		})
+	}
+}
+
+func TestDriversAPIKeys(t *testing.T) {
+	keys := newInMemKeys(map[string][]string{
+		"drv_importer": {auth.ScopeRead, auth.ScopeImport},
+		"drv_admin":    {auth.ScopeAdmin},
+	})
+	srv := drivers.New(nopLogger{}, &inMemStorage{
+		db: map[uint64]*store.Driver{
+			1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		},
+	},
+		drivers.WithAuthenticator(auth.NewAPIKeys(keys)),
+		drivers.WithAPIKeys(keys),
+	)
+
+	do := func(method, path, key, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("X-API-Key", key)
+		response := httptest.NewRecorder()
+		srv.ServeHTTP(response, request)
+
+		var decoded map[string]interface{}
+		json.Unmarshal(response.Body.Bytes(), &decoded)
+		return response, decoded
+	}
+
+	// the importer can't manage keys
+	response, _ := do("POST", "/api/v2/keys", "drv_importer", `{"name":"reader","scopes":["drivers:read"]}`)
+	t.Log("create by importer =>", response.Code, response.Body.String())
+	if response.Code != http.StatusForbidden {
+		t.Error("Expected =>", http.StatusForbidden)
+	}
+
+	// invalid scopes are rejected
+	response, _ = do("POST", "/api/v2/keys", "drv_admin", `{"name":"reader","scopes":["drivers:write"]}`)
+	t.Log("create with unknown scope =>", response.Code, response.Body.String())
+	if response.Code != http.StatusBadRequest {
+		t.Error("Expected =>", http.StatusBadRequest)
+	}
+	if !strings.Contains(response.Body.String(), "invalid scopes; drivers:write is unknown") {
+		t.Error("Expected =>", "invalid scopes; drivers:write is unknown")
+	}
+
+	// a new key is shown once and works at once
+	response, created := do("POST", "/api/v2/keys", "drv_admin", `{"name":"reader","scopes":["drivers:read"]}`)
+	t.Log("create =>", response.Code, response.Body.String())
+	if response.Code != http.StatusCreated {
+		t.Error("Expected =>", http.StatusCreated)
+	}
+	key, _ := created["key"].(string)
+	if !strings.HasPrefix(key, auth.APIKeyPrefix) {
+		t.Error("Expected a key with prefix =>", auth.APIKeyPrefix)
+	}
+	if fmt.Sprint(created["scopes"]) != "[drivers:read]" {
+		t.Error("Expected scopes =>", "[drivers:read]")
+	}
+	id := fmt.Sprint(created["id"])
+
+	response, _ = do("GET", "/api/v2/drivers/1", key, "")
+	t.Log("read by the new key =>", response.Code)
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+
+	// a rotated key replaces the previous one
+	response, rotated := do("POST", "/api/v2/keys/"+id+"/rotate", "drv_admin", "")
+	t.Log("rotate =>", response.Code, response.Body.String())
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+	rotatedKey, _ := rotated["key"].(string)
+	if rotatedKey == "" || rotatedKey == key {
+		t.Error("Expected a new key")
+	}
+	if rotated["rotated_at"] == nil {
+		t.Error("Expected rotated_at")
+	}
+
+	response, _ = do("GET", "/api/v2/drivers/1", key, "")
+	t.Log("read by the previous key =>", response.Code)
+	if response.Code != http.StatusUnauthorized {
+		t.Error("Expected =>", http.StatusUnauthorized)
+	}
+	response, _ = do("GET", "/api/v2/drivers/1", rotatedKey, "")
+	t.Log("read by the rotated key =>", response.Code)
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+
+	// a revoked key doesn't work anymore
+	response, _ = do("DELETE", "/api/v2/keys/"+id, "drv_admin", "")
+	t.Log("revoke =>", response.Code, response.Body.String())
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+	response, _ = do("GET", "/api/v2/drivers/1", rotatedKey, "")
+	t.Log("read by the revoked key =>", response.Code)
+	if response.Code != http.StatusUnauthorized {
+		t.Error("Expected =>", http.StatusUnauthorized)
+	}
+	response, _ = do("DELETE", "/api/v2/keys/"+id, "drv_admin", "")
+	t.Log("revoke again =>", response.Code, response.Body.String())
+	if response.Code != http.StatusNotFound {
+		t.Error("Expected =>", http.StatusNotFound)
+	}
+}
+
+func TestDriversAudit(t *testing.T) {
+	storage := &inMemStorage{
+		db: map[uint64]*store.Driver{
+			1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		},
+	}
+	keys := newInMemKeys(map[string][]string{"drv_importer": {auth.ScopeImport}})
+	keys.CreateAPIKey(context.Background(), &store.APIKey{
+		Name:   "admin",
+		Hash:   auth.HashAPIKey("drv_admin"),
+		Scopes: []string{auth.ScopeAdmin},
+	})
+	srv := drivers.New(nopLogger{}, storage,
+		drivers.WithAuthenticator(auth.Schemes{auth.SchemeAPIKey: auth.NewAPIKeys(keys)}),
+		drivers.WithAudit(storage),
+	)
+
+	request := httptest.NewRequest("POST", "/api/v2/import", strings.NewReader(
+		`[{"id":1,"name":"John","license_number":"11-222-44"},{"id":2,"name":"Jane","license_number":"11-222-34"}]`,
+	))
+	request.Header.Set("X-Request-ID", "import-1")
+	request.Header.Set("X-API-Key", "drv_importer")
+	response := httptest.NewRecorder()
+	srv.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatal("Unexpected import status =>", response.Code, response.Body.String())
+	}
+
+	for _, tc := range []struct {
+		name      string
+		path      string
+		key       string
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:      "ByDriver",
+			path:      "/api/v2/audit?driver_id=1",
+			key:       "drv_admin",
+			expStatus: http.StatusOK,
+			expBody:   `{"data":[{"id":1,"driver_id":1,"operation":"import","actor":"apikey:1","request_id":"import-1","source_ip":"192.0.2.1","before":{"name":"John","license_number":"11-222-33"},"after":{"name":"John","license_number":"11-222-44"},"created_at":"2026-10-19T12:00:00Z"}],"links":{}}`,
+		},
+		{
+			name:      "Page",
+			path:      "/api/v2/audit?after=1&limit=1&since=2026-10-19T00:00:00Z",
+			key:       "drv_admin",
+			expStatus: http.StatusOK,
+			expBody:   `{"data":[{"id":2,"driver_id":2,"operation":"import","actor":"apikey:1","request_id":"import-1","source_ip":"192.0.2.1","before":null,"after":{"name":"Jane","license_number":"11-222-34"},"created_at":"2026-10-19T12:00:00Z"}],"links":{"next":"/api/v2/audit?after=2\u0026limit=1\u0026since=2026-10-19T00%3A00%3A00Z"}}`,
+		},
+		{
+			name:      "Since",
+			path:      "/api/v2/audit?since=2026-10-20T00:00:00Z",
+			key:       "drv_admin",
+			expStatus: http.StatusOK,
+			expBody:   `{"data":[],"links":{}}`,
+		},
+		{
+			name:      "InvalidSince",
+			path:      "/api/v2/audit?since=yesterday",
+			key:       "drv_admin",
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid format; since field should match RFC 3339 date-time, but was yesterday"}`,
+		},
+		{
+			name:      "V1",
+			path:      "/api/audit?driver_id=2",
+			key:       "drv_admin",
+			expStatus: http.StatusOK,
+			expBody:   `{"data":[{"id":2,"driver_id":2,"operation":"import","actor":"apikey:1","request_id":"import-1","source_ip":"192.0.2.1","before":null,"after":{"name":"Jane","license_number":"11-222-34"},"created_at":"2026-10-19T12:00:00Z"}],"links":{}}`,
+		},
+		{
+			name:      "V1Page",
+			path:      "/api/v1/audit?limit=1",
+			key:       "drv_admin",
+			expStatus: http.StatusOK,
+			expBody:   `{"data":[{"id":1,"driver_id":1,"operation":"import","actor":"apikey:1","request_id":"import-1","source_ip":"192.0.2.1","before":{"name":"John","license_number":"11-222-33"},"after":{"name":"John","license_number":"11-222-44"},"created_at":"2026-10-19T12:00:00Z"}],"links":{"next":"/api/v1/audit?after=1\u0026limit=1"}}`,
+		},
+		{
+			name:      "V1InvalidSince",
+			path:      "/api/audit?since=yesterday",
+			key:       "drv_admin",
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"error":"status=400, error=invalid format; since field should match RFC 3339 date-time, but was yesterday"}`,
+		},
+		{
+			name:      "WithoutScope",
+			path:      "/api/v2/audit",
+			key:       "drv_importer",
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; scope drivers:admin is required"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", tc.path, nil)
+			request.Header.Set("X-API-Key", tc.key)
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			body := strings.Replace(response.Body.String(), `,"request_id":"`+response.Header().Get("X-Request-ID")+`"}`, "}", 1)
+			t.Log("response body =>", body)
+			if body != tc.expBody+"\n" {
+				t.Error("Expected =>", tc.expBody)
+			}
+		})
+	}
+}
+
+func TestDriversRateLimit(t *testing.T) {
+	keys := newInMemKeys(map[string][]string{"drv_importer": {auth.ScopeRead, auth.ScopeImport}})
+	keys.CreateAPIKey(context.Background(), &store.APIKey{
+		Name:   "reader",
+		Hash:   auth.HashAPIKey("drv_reader"),
+		Scopes: []string{auth.ScopeRead},
+	})
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	budgets, err := ratelimit.NewAtomicBudgets(ratelimit.Budgets{
+		Read:   ratelimit.Limit{Rate: 1, Burst: 2},
+		Import: ratelimit.Limit{Rate: 0.5, Burst: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := ratelimit.NewMemory(ratelimit.WithClock(func() time.Time { return now }))
+	storage := &inMemStorage{
+		db: map[uint64]*store.Driver{
+			1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		},
+	}
+	srv := drivers.New(nopLogger{}, storage,
+		drivers.WithAuthenticator(auth.NewAPIKeys(keys)),
+		drivers.WithRateLimit(limiter, budgets),
+	)
+	anonymous := drivers.New(nopLogger{}, storage, drivers.WithRateLimit(limiter, budgets))
+	proxied := drivers.New(nopLogger{}, storage,
+		drivers.WithRateLimit(limiter, budgets),
+		drivers.WithTrustedProxies(1),
+	)
+
+	for _, tc := range []struct {
+		name          string
+		srv           http.Handler
+		method        string
+		path          string
+		key           string
+		remoteAddr    string
+		forwardedFor  string
+		advance       time.Duration
+		expStatus     int
+		expRemaining  string
+		expReset      string
+		expRetryAfter string
+		expBody       string
+	}{
+		{
+			name:         "First",
+			srv:          srv,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			key:          "drv_importer",
+			expStatus:    http.StatusOK,
+			expRemaining: "1",
+			expReset:     "1",
+		},
+		{
+			name:         "Burst",
+			srv:          srv,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			key:          "drv_importer",
+			expStatus:    http.StatusOK,
+			expRemaining: "0",
+			expReset:     "2",
+		},
+		{
+			name:          "Exhausted",
+			srv:           srv,
+			method:        "GET",
+			path:          "/api/v2/drivers/1",
+			key:           "drv_importer",
+			expStatus:     http.StatusTooManyRequests,
+			expRemaining:  "0",
+			expReset:      "2",
+			expRetryAfter: "1",
+			expBody:       `{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"too many requests; read budget of apikey:1 is exhausted"}`,
+		},
+		{
+			name:          "ExhaustedV1",
+			srv:           srv,
+			method:        "GET",
+			path:          "/api/driver/1",
+			key:           "drv_importer",
+			expStatus:     http.StatusTooManyRequests,
+			expRemaining:  "0",
+			expReset:      "2",
+			expRetryAfter: "1",
+			expBody:       `{"error":"status=429, error=too many requests; read budget of apikey:1 is exhausted"}`,
+		},
+		{
+			name:         "OtherKey",
+			srv:          srv,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			key:          "drv_reader",
+			expStatus:    http.StatusOK,
+			expRemaining: "1",
+			expReset:     "1",
+		},
+		{
+			name:         "ImportBudget",
+			srv:          srv,
+			method:       "POST",
+			path:         "/api/v2/import",
+			key:          "drv_importer",
+			expStatus:    http.StatusOK,
+			expRemaining: "0",
+			expReset:     "2",
+		},
+		{
+			name:          "ImportExhausted",
+			srv:           srv,
+			method:        "PUT",
+			path:          "/api/v2/drivers/1",
+			key:           "drv_importer",
+			advance:       time.Second,
+			expStatus:     http.StatusTooManyRequests,
+			expRemaining:  "0",
+			expReset:      "1",
+			expRetryAfter: "1",
+			expBody:       `{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"too many requests; import budget of apikey:1 is exhausted"}`,
+		},
+		{
+			name:         "Refilled",
+			srv:          srv,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			key:          "drv_importer",
+			expStatus:    http.StatusOK,
+			expRemaining: "0",
+			expReset:     "2",
+		},
+		{
+			name:         "AnonymousByIP",
+			srv:          anonymous,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			remoteAddr:   "192.0.2.1:1234",
+			expStatus:    http.StatusOK,
+			expRemaining: "1",
+			expReset:     "1",
+		},
+		{
+			name:         "AnonymousOtherPort",
+			srv:          anonymous,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			remoteAddr:   "192.0.2.1:4321",
+			expStatus:    http.StatusOK,
+			expRemaining: "0",
+			expReset:     "2",
+		},
+		{
+			name:         "AnonymousOtherIP",
+			srv:          anonymous,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			remoteAddr:   "192.0.2.2:1234",
+			expStatus:    http.StatusOK,
+			expRemaining: "1",
+			expReset:     "1",
+		},
+		{
+			name:         "AnonymousForwardedForNotTrusted",
+			srv:          anonymous,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			remoteAddr:   "192.0.2.2:1234",
+			forwardedFor: "198.51.100.7",
+			expStatus:    http.StatusOK,
+			expRemaining: "0",
+			expReset:     "2",
+		},
+		{
+			name:         "ProxiedByForwardedFor",
+			srv:          proxied,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: "198.51.100.1",
+			expStatus:    http.StatusOK,
+			expRemaining: "1",
+			expReset:     "1",
+		},
+		{
+			name:         "ProxiedOtherForwardedFor",
+			srv:          proxied,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: "198.51.100.2",
+			expStatus:    http.StatusOK,
+			expRemaining: "1",
+			expReset:     "1",
+		},
+		{
+			name:         "ProxiedForgedForwardedFor",
+			srv:          proxied,
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: "198.51.100.2, 198.51.100.1",
+			expStatus:    http.StatusOK,
+			expRemaining: "0",
+			expReset:     "2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.advance)
+
+			var body io.Reader
+			if tc.method != "GET" {
+				body = strings.NewReader(`[{"id":1,"name":"John","license_number":"11-222-33"}]`)
+				if tc.method == "PUT" {
+					body = strings.NewReader(`{"id":1,"name":"John","license_number":"11-222-33"}`)
+				}
+			}
+			request := httptest.NewRequest(tc.method, tc.path, body)
+			if tc.key != "" {
+				request.Header.Set("X-API-Key", tc.key)
+			}
+			if tc.remoteAddr != "" {
+				request.RemoteAddr = tc.remoteAddr
+			}
+			if tc.forwardedFor != "" {
+				request.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			response := httptest.NewRecorder()
+
+			tc.srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			for header, exp := range map[string]string{
+				"RateLimit-Remaining": tc.expRemaining,
+				"RateLimit-Reset":     tc.expReset,
+				"Retry-After":         tc.expRetryAfter,
+			} {
+				t.Log(header, "=>", response.Header().Get(header))
+				if response.Header().Get(header) != exp {
+					t.Error("Expected =>", exp)
+				}
+			}
+			if response.Header().Get("RateLimit-Limit") == "" {
+				t.Error("Expected RateLimit-Limit header")
+			}
+			if tc.expBody != "" {
+				body := strings.Replace(response.Body.String(), `,"request_id":"`+response.Header().Get("X-Request-ID")+`"}`, "}", 1)
+				t.Log("response body =>", body)
+				if body != tc.expBody+"\n" {
+					t.Error("Expected =>", tc.expBody)
+				}
+			}
+		})
+	}
+
+	// reloaded budgets are applied at once, unlimited requests have no headers
+	if err = budgets.Store(ratelimit.Budgets{Import: ratelimit.Limit{Rate: 1, Burst: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest("GET", "/api/v2/drivers/1", nil)
+	request.Header.Set("X-API-Key", "drv_importer")
+	response := httptest.NewRecorder()
+	srv.ServeHTTP(response, request)
+	t.Log("unlimited =>", response.Code, response.Header().Get("RateLimit-Limit"))
+	if response.Code != http.StatusOK || response.Header().Get("RateLimit-Limit") != "" {
+		t.Error("Expected the read limit to be disabled")
+	}
+
+	// requests are let through if the limiter fails
+	srv = drivers.New(nopLogger{}, storage, drivers.WithRateLimit(failingLimiter{}, budgets))
+	request = httptest.NewRequest("POST", "/api/v2/import", strings.NewReader(`[{"id":1,"name":"John","license_number":"11-222-33"}]`))
+	response = httptest.NewRecorder()
+	srv.ServeHTTP(response, request)
+	t.Log("failing limiter =>", response.Code)
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+}
+
+func TestDriversRateLimitOfInvalidCredentials(t *testing.T) {
+	keys := newInMemKeys(map[string][]string{"drv_reader": {auth.ScopeRead}})
+	budgets, err := ratelimit.NewAtomicBudgets(ratelimit.Budgets{
+		Read: ratelimit.Limit{Rate: 10, Burst: 10},
+		IP:   ratelimit.Limit{Rate: 1, Burst: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	srv := drivers.New(nopLogger{}, &inMemStorage{db: map[uint64]*store.Driver{}},
+		drivers.WithAuthenticator(auth.NewAPIKeys(keys)),
+		drivers.WithRateLimit(ratelimit.NewMemory(ratelimit.WithClock(func() time.Time { return now })), budgets),
+	)
+
+	// guessed keys are rejected with 401 until the ip budget is exhausted
+	for _, tc := range []struct {
+		name       string
+		key        string
+		remoteAddr string
+		expStatus  int
+		expBody    string
+	}{
+		{name: "First", key: "drv_guess1", remoteAddr: "192.0.2.1:1234", expStatus: http.StatusUnauthorized},
+		{name: "Second", key: "drv_guess2", remoteAddr: "192.0.2.1:1234", expStatus: http.StatusUnauthorized},
+		{name: "Third", key: "drv_guess3", remoteAddr: "192.0.2.1:1234", expStatus: http.StatusUnauthorized},
+		{
+			name:       "Exhausted",
+			key:        "drv_guess4",
+			remoteAddr: "192.0.2.1:1234",
+			expStatus:  http.StatusTooManyRequests,
+			expBody:    `{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"too many requests; ip budget of ip:192.0.2.1 is exhausted"}`,
+		},
+		{name: "ValidKeyOfExhaustedIP", key: "drv_reader", remoteAddr: "192.0.2.1:1234", expStatus: http.StatusTooManyRequests},
+		{name: "OtherIP", key: "drv_guess5", remoteAddr: "192.0.2.2:1234", expStatus: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/api/v2/drivers/1", nil)
+			request.Header.Set("X-API-Key", tc.key)
+			request.RemoteAddr = tc.remoteAddr
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			if tc.expStatus == http.StatusTooManyRequests && response.Header().Get("Retry-After") == "" {
+				t.Error("Expected Retry-After header")
+			}
+			if tc.expBody != "" {
+				body := strings.Replace(response.Body.String(), `,"request_id":"`+response.Header().Get("X-Request-ID")+`"}`, "}", 1)
+				t.Log("response body =>", body)
+				if body != tc.expBody+"\n" {
+					t.Error("Expected =>", tc.expBody)
+				}
+			}
+		})
+	}
+}
+
+func TestDriversBearer(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := auth.Schemes{
+		auth.SchemeAPIKey: auth.NewAPIKeys(newInMemKeys(nil)),
+		auth.SchemeBearer: auth.NewJWT(staticKeys{"sso": &key.PublicKey}, "https://sso.example.com", "drivers",
+			auth.WithPermissions(map[string][]string{"viewer": {auth.ScopeRead}})),
+	}
+	token := func(exp time.Duration) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"iss":   "https://sso.example.com",
+			"aud":   "drivers",
+			"sub":   "jane@example.com",
+			"exp":   time.Now().Add(exp).Unix(),
+			"scope": "viewer",
+		})
+		token.Header["kid"] = "sso"
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + s
+	}
+
+	for _, tc := range []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		getByIDErr    error
+		expStatus     int
+		expChallenge  string
+		expBody       string
+		expLog        string
+	}{
+		{
+			name:         "NoCredentials",
+			method:       "GET",
+			path:         "/api/v2/drivers/1",
+			expStatus:    http.StatusUnauthorized,
+			expChallenge: `ApiKey realm="drivers", Bearer realm="drivers"`,
+			expBody:      `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"unauthenticated; credentials are missing","request_id":"1a2b3c"}`,
+		},
+		{
+			name:          "Expired",
+			method:        "GET",
+			path:          "/api/v2/drivers/1",
+			authorization: token(-time.Hour),
+			expStatus:     http.StatusUnauthorized,
+			expChallenge:  `ApiKey realm="drivers", Bearer realm="drivers"`,
+			expBody:       `{"type":"about:blank","title":"Unauthorized","status":401,"detail":"unauthenticated; credentials are invalid; token has invalid claims: token is expired","request_id":"1a2b3c"}`,
+		},
+		{
+			name:          "Read",
+			method:        "GET",
+			path:          "/api/v2/drivers/1",
+			authorization: token(time.Hour),
+			expStatus:     http.StatusOK,
+			expBody:       `{"id":1,"name":"John","license_number":"11-222-33","links":{"self":"/api/v2/drivers/1"}}`,
+		},
+		{
+			name:          "ImportWithoutScope",
+			method:        "POST",
+			path:          "/api/v2/import",
+			authorization: token(time.Hour),
+			expStatus:     http.StatusForbidden,
+			expBody:       `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; scope drivers:import is required","request_id":"1a2b3c"}`,
+		},
+		{
+			name:          "SubjectIsLogged",
+			method:        "GET",
+			path:          "/api/v2/drivers/1",
+			authorization: token(time.Hour),
+			getByIDErr:    errors.New("internal"),
+			expStatus:     http.StatusInternalServerError,
+			expBody:       `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"internal","request_id":"1a2b3c"}`,
+			expLog:        `component=store method=GetByID`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			srv := drivers.New(log.NewLogfmtLogger(&logs), store.NewLoggingStore(&inMemStorage{
+				db: map[uint64]*store.Driver{
+					1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+				},
+				getByIDErr: tc.getByIDErr,
+			}), drivers.WithAuthenticator(authenticator))
+
+			request := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`[]`))
+			request.Header.Set("X-Request-ID", "1a2b3c")
+			if tc.authorization != "" {
+				request.Header.Set("Authorization", tc.authorization)
+			}
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			challenge := response.Header().Get("WWW-Authenticate")
+			t.Log("response WWW-Authenticate =>", challenge)
+			if challenge != tc.expChallenge {
+				t.Error("Expected =>", tc.expChallenge)
+			}
+			t.Log("response body =>", response.Body.String())
+			if response.Body.String() != tc.expBody+"\n" {
+				t.Error("Expected =>", tc.expBody)
+			}
+			if tc.expLog != "" {
+				t.Log("logs =>", logs.String())
+				if !strings.Contains(logs.String(), tc.expLog) || !strings.Contains(logs.String(), "subject=jwt:jane@example.com") {
+					t.Error("Expected =>", tc.expLog, "subject=jwt:jane@example.com")
+				}
+			}
+		})
+	}
+}
+
+func TestDriversRedaction(t *testing.T) {
+	conflict := &pq.Error{
+		Code:       "23505",
+		Message:    `duplicate key value violates unique constraint "drivers_license_number_key"`,
+		Constraint: "drivers_license_number_key",
+		Detail:     "Key (license_number)=(11-222-33) already exists.",
+	}
+
+	for _, tc := range []struct {
+		name         string
+		path         string
+		body         string
+		redactErrors bool
+		upsertErr    error
+		expStatus    int
+		expBody      string
+	}{
+		{
+			name:         "Conflict",
+			path:         "/api/v2/import",
+			body:         `[{"id":1,"name":"John","license_number":"11-222-33"}]`,
+			redactErrors: true,
+			upsertErr:    conflict,
+			expStatus:    http.StatusConflict,
+			expBody:      `{"type":"about:blank","title":"Conflict","status":409,"detail":"Key (license_number)=(***) already exists.","request_id":"1a2b3c"}`,
+		},
+		{
+			name:         "ConflictV1",
+			path:         "/api/v1/import",
+			body:         `[{"id":1,"name":"John","license_number":"11-222-33"}]`,
+			redactErrors: true,
+			upsertErr:    conflict,
+			expStatus:    http.StatusConflict,
+			expBody:      `{"error":"status=409, error=Key (license_number)=(***) already exists.","request_id":"1a2b3c"}`,
+		},
+		{
+			name:         "InvalidLicenseNumber",
+			path:         "/api/v2/import",
+			body:         `[{"id":1,"name":"John","license_number":"11-222-333"}]`,
+			redactErrors: true,
+			expStatus:    http.StatusBadRequest,
+			expBody:      `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid format; license_number field should match ^[0-9]{2}-[0-9]{3}-[0-9]{2}$, but was ***","request_id":"1a2b3c"}`,
+		},
+		{
+			name:      "ErrorsAreNotRedacted",
+			path:      "/api/v2/import",
+			body:      `[{"id":1,"name":"John","license_number":"11-222-33"}]`,
+			upsertErr: conflict,
+			expStatus: http.StatusConflict,
+			expBody:   `{"type":"about:blank","title":"Conflict","status":409,"detail":"Key (license_number)=(11-222-33) already exists.","request_id":"1a2b3c"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			srv := drivers.New(log.NewLogfmtLogger(&logs), store.NewLoggingStore(&inMemStorage{
+				db:        make(map[uint64]*store.Driver),
+				upsertErr: tc.upsertErr,
+			}), drivers.WithErrorRedaction(tc.redactErrors))
+
+			request := httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+			request.Header.Set("X-Request-ID", "1a2b3c")
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			t.Log("response body =>", response.Body.String())
+			if response.Body.String() != tc.expBody+"\n" {
+				t.Error("Expected =>", tc.expBody)
+			}
+
+			// license numbers are never logged
+			t.Log("logs =>", logs.String())
+			if !strings.Contains(logs.String(), "err=") {
+				t.Error("Expected the error to be logged")
+			}
+			if strings.Contains(logs.String(), "11-222-3") {
+				t.Error("Expected no license numbers in logs")
+			}
+		})
+	}
+}
+
+func TestDriversCORS(t *testing.T) {
+	policy := drivers.CORS{
+		AllowedOrigins: []string{"https://fleet.example.com"},
+		AllowedMethods: []string{"GET", "POST", "PUT"},
+		AllowedHeaders: []string{"Content-Type", "X-API-Key", "If-Match"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	for _, tc := range []struct {
+		name       string
+		policy     drivers.CORS
+		method     string
+		path       string
+		headers    map[string]string
+		expStatus  int
+		expHeaders map[string]string
+	}{
+		{
+			name:   "Preflight",
+			policy: policy,
+			method: "OPTIONS",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin":                         "https://fleet.example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "content-type, if-match",
+			},
+			expStatus: http.StatusNoContent,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://fleet.example.com",
+				"Access-Control-Allow-Methods":     "GET, POST, PUT",
+				"Access-Control-Allow-Headers":     "content-type, if-match",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Max-Age":           "600",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:   "PreflightOfV1",
+			policy: policy,
+			method: "OPTIONS",
+			path:   "/api/import",
+			headers: map[string]string{
+				"Origin":                        "https://fleet.example.com",
+				"Access-Control-Request-Method": "POST",
+			},
+			expStatus: http.StatusNoContent,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin":  "https://fleet.example.com",
+				"Access-Control-Allow-Methods": "GET, POST, PUT",
+				"Access-Control-Allow-Headers": "",
+			},
+		},
+		{
+			name:   "PreflightOfUnknownOrigin",
+			policy: policy,
+			method: "OPTIONS",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			expStatus: http.StatusForbidden,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "PreflightOfMethodNotAllowed",
+			policy: policy,
+			method: "OPTIONS",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin":                        "https://fleet.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			expStatus: http.StatusForbidden,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "PreflightOfHeaderNotAllowed",
+			policy: policy,
+			method: "OPTIONS",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin":                         "https://fleet.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "x-api-key, x-debug",
+			},
+			expStatus: http.StatusForbidden,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "OptionsWithoutPreflight",
+			policy: policy,
+			method: "OPTIONS",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin": "https://fleet.example.com",
+			},
+			expStatus: http.StatusMethodNotAllowed,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "https://fleet.example.com",
+			},
+		},
+		{
+			name:   "Request",
+			policy: policy,
+			method: "GET",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin": "https://fleet.example.com",
+			},
+			expStatus: http.StatusOK,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://fleet.example.com",
+				"Access-Control-Expose-Headers": strings.Join(drivers.DefaultCORSExposedHeaders, ", "),
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:   "RequestOfUnknownOrigin",
+			policy: policy,
+			method: "GET",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin": "https://evil.example.com",
+			},
+			expStatus: http.StatusOK,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "",
+				"Access-Control-Expose-Headers": "",
+			},
+		},
+		{
+			name: "AnyOrigin",
+			policy: drivers.CORS{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET"},
+				ExposedHeaders: []string{},
+			},
+			method: "GET",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin": "https://fleet.example.com",
+			},
+			expStatus: http.StatusOK,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "*",
+				"Access-Control-Expose-Headers": "",
+			},
+		},
+		{
+			name: "AnyOriginWithCredentials",
+			policy: drivers.CORS{
+				AllowedOrigins:   []string{"*"},
+				AllowedMethods:   []string{"GET"},
+				AllowedHeaders:   []string{"*"},
+				AllowCredentials: true,
+			},
+			method: "OPTIONS",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin":                         "https://fleet.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "authorization, x-debug",
+			},
+			expStatus: http.StatusNoContent,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Allow-Headers":     "authorization, x-debug",
+				"Access-Control-Max-Age":           "",
+			},
+		},
+		{
+			name: "ListedOriginWithCredentials",
+			policy: drivers.CORS{
+				AllowedOrigins:   []string{"*", "https://fleet.example.com"},
+				AllowedMethods:   []string{"GET"},
+				AllowCredentials: true,
+			},
+			method: "GET",
+			path:   "/api/v2/drivers/1",
+			headers: map[string]string{
+				"Origin": "https://Fleet.example.com",
+			},
+			expStatus: http.StatusOK,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://Fleet.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:      "Disabled",
+			method:    "OPTIONS",
+			path:      "/api/v2/drivers/1",
+			headers:   map[string]string{"Origin": "https://fleet.example.com", "Access-Control-Request-Method": "GET"},
+			expStatus: http.StatusMethodNotAllowed,
+			expHeaders: map[string]string{
+				"Access-Control-Allow-Origin": "",
+				"Vary":                        "",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := drivers.New(nopLogger{}, &inMemStorage{
+				db: map[uint64]*store.Driver{
+					1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+				},
+			}, drivers.WithCORS(tc.policy))
+
+			request := httptest.NewRequest(tc.method, tc.path, nil)
+			for k, v := range tc.headers {
+				request.Header.Set(k, v)
+			}
+			response := httptest.NewRecorder()
+
+			srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			for k, exp := range tc.expHeaders {
+				t.Log("response", k, "=>", response.Header().Get(k))
+				if response.Header().Get(k) != exp {
+					t.Error("Expected =>", exp)
+				}
+			}
+		})
+	}
+}
+
+func TestDriversCompression(t *testing.T) {
+	storage := &inMemStorage{db: make(map[uint64]*store.Driver)}
+	for id := uint64(1); id <= 100; id++ {
+		storage.db[id] = &store.Driver{ID: id, Name: "John", LicenseNumber: fmt.Sprintf("11-222-%02d", id%100)}
+	}
+	srv := drivers.New(nopLogger{}, storage)
+	limited := drivers.New(nopLogger{}, storage, drivers.WithMaxDecompressedBytes(256))
+	disabled := drivers.New(nopLogger{}, storage,
+		drivers.WithCompression(nil, 0),
+		drivers.WithMaxDecompressedBytes(0),
+	)
+
+	compressed := func(enc compress.Encoding, body string) string {
+		var b bytes.Buffer
+		w := enc.NewWriter(&b)
+		io.WriteString(w, body)
+		w.Close()
+		return b.String()
+	}
+	importBody := `[{"id":1,"name":"John","license_number":"11-222-33"},{"id":2,"name":"Jane","license_number":"11-222-34"}]`
+	largeBody := `[` + strings.Repeat(`{"id":1,"name":"John","license_number":"11-222-33"},`, 10) + `{"id":2}]`
+
+	for _, tc := range []struct {
+		name           string
+		srv            http.Handler
+		method         string
+		path           string
+		headers        map[string]string
+		body           string
+		expStatus      int
+		expEncoding    string
+		expBodyPrefix  string
+		expVaryEncoded bool
+	}{
+		{
+			name:           "Gzip",
+			srv:            srv,
+			method:         "GET",
+			path:           "/api/v2/drivers?limit=50",
+			headers:        map[string]string{"Accept-Encoding": "gzip"},
+			expStatus:      http.StatusOK,
+			expEncoding:    "gzip",
+			expBodyPrefix:  `{"data":[{"id":1,"name":"John","license_number":"11-222-01"`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "Brotli",
+			srv:            srv,
+			method:         "GET",
+			path:           "/api/v2/drivers?limit=50",
+			headers:        map[string]string{"Accept-Encoding": "gzip, deflate, br"},
+			expStatus:      http.StatusOK,
+			expEncoding:    "br",
+			expBodyPrefix:  `{"data":[{"id":1,`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "QualityValues",
+			srv:            srv,
+			method:         "GET",
+			path:           "/api/v2/drivers?limit=50",
+			headers:        map[string]string{"Accept-Encoding": "br;q=0.1, gzip"},
+			expStatus:      http.StatusOK,
+			expEncoding:    "gzip",
+			expBodyPrefix:  `{"data":[{"id":1,`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "OtherCodec",
+			srv:            srv,
+			method:         "GET",
+			path:           "/api/v2/drivers?limit=50",
+			headers:        map[string]string{"Accept-Encoding": "gzip", "Accept": "application/xml"},
+			expStatus:      http.StatusOK,
+			expEncoding:    "gzip",
+			expBodyPrefix:  `<drivers><driver><id>1</id>`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "V1Error",
+			srv:            srv,
+			method:         "GET",
+			path:           "/api/driver/101",
+			headers:        map[string]string{"Accept-Encoding": "gzip"},
+			expStatus:      http.StatusNotFound,
+			expBodyPrefix:  `{"error":"status=404, error=driver with id=101 is not found"`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "SmallResponse",
+			srv:            srv,
+			method:         "GET",
+			path:           "/api/v2/drivers/1",
+			headers:        map[string]string{"Accept-Encoding": "gzip"},
+			expStatus:      http.StatusOK,
+			expBodyPrefix:  `{"id":1,"name":"John"`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "NotAccepted",
+			srv:            srv,
+			method:         "GET",
+			path:           "/api/v2/drivers?limit=50",
+			headers:        map[string]string{"Accept-Encoding": "identity"},
+			expStatus:      http.StatusOK,
+			expBodyPrefix:  `{"data":[{"id":1,`,
+			expVaryEncoded: true,
+		},
+		{
+			name:          "Disabled",
+			srv:           disabled,
+			method:        "GET",
+			path:          "/api/v2/drivers?limit=50",
+			headers:       map[string]string{"Accept-Encoding": "gzip"},
+			expStatus:     http.StatusOK,
+			expBodyPrefix: `{"data":[{"id":1,`,
+		},
+		{
+			name:           "ImportGzip",
+			srv:            srv,
+			method:         "POST",
+			path:           "/api/v2/import",
+			headers:        map[string]string{"Content-Encoding": "gzip"},
+			body:           compressed(compress.Gzip, importBody),
+			expStatus:      http.StatusOK,
+			expBodyPrefix:  `{}`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "ImportBrotliV1",
+			srv:            srv,
+			method:         "POST",
+			path:           "/api/import",
+			headers:        map[string]string{"Content-Encoding": "br"},
+			body:           compressed(compress.Brotli, importBody),
+			expStatus:      http.StatusOK,
+			expBodyPrefix:  `{}`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "ImportOverDecompressedLimit",
+			srv:            limited,
+			method:         "POST",
+			path:           "/api/v2/import",
+			headers:        map[string]string{"Content-Encoding": "gzip"},
+			body:           compressed(compress.Gzip, largeBody),
+			expStatus:      http.StatusRequestEntityTooLarge,
+			expBodyPrefix:  `{"type":"about:blank","title":"Request Entity Too Large","status":413,"detail":"body is too large; it should be up to 256 bytes"`,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "ImportMalformed",
+			srv:            srv,
+			method:         "POST",
+			path:           "/api/v2/import",
+			headers:        map[string]string{"Content-Encoding": "gzip"},
+			body:           importBody,
+			expStatus:      http.StatusBadRequest,
+			expBodyPrefix:  `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid body; `,
+			expVaryEncoded: true,
+		},
+		{
+			name:           "ImportUnknownEncoding",
+			srv:            srv,
+			method:         "POST",
+			path:           "/api/v2/import",
+			headers:        map[string]string{"Content-Encoding": "deflate"},
+			body:           importBody,
+			expStatus:      http.StatusUnsupportedMediaType,
+			expBodyPrefix:  `{"type":"about:blank","title":"Unsupported Media Type","status":415,"detail":"content encoding of the request body is not supported"`,
+			expVaryEncoded: true,
+		},
+		{
+			name:          "ImportDecompressionDisabled",
+			srv:           disabled,
+			method:        "POST",
+			path:          "/api/v2/import",
+			headers:       map[string]string{"Content-Encoding": "gzip"},
+			body:          compressed(compress.Gzip, importBody),
+			expStatus:     http.StatusUnsupportedMediaType,
+			expBodyPrefix: `{"type":"about:blank","title":"Unsupported Media Type","status":415,`,
+		},
+		{
+			name:           "UpdateGzip",
+			srv:            srv,
+			method:         "PUT",
+			path:           "/api/v2/drivers/1",
+			headers:        map[string]string{"Content-Encoding": "gzip"},
+			body:           compressed(compress.Gzip, `{"name":"John","license_number":"11-222-33"}`),
+			expStatus:      http.StatusUnsupportedMediaType,
+			expBodyPrefix:  `{"type":"about:blank","title":"Unsupported Media Type","status":415,`,
+			expVaryEncoded: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for k, v := range tc.headers {
+				request.Header.Set(k, v)
+			}
+			response := httptest.NewRecorder()
+
+			tc.srv.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			t.Log("response Content-Encoding =>", response.Header().Get("Content-Encoding"))
+			if response.Header().Get("Content-Encoding") != tc.expEncoding {
+				t.Error("Expected =>", tc.expEncoding)
+			}
+			vary := strings.Join(response.Header().Values("Vary"), ", ")
+			t.Log("response Vary =>", vary)
+			if strings.Contains(vary, "Accept-Encoding") != tc.expVaryEncoded {
+				t.Error("Expected Accept-Encoding in Vary =>", tc.expVaryEncoded)
+			}
+
+			enc, err := compress.Default.Lookup(tc.expEncoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := io.NopCloser(response.Body)
+			if enc != nil {
+				body = enc.NewReader(body)
+			}
+			b, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal("Unexpected error =>", err)
+			}
+			t.Log("response body =>", string(b))
+			if !strings.HasPrefix(string(b), tc.expBodyPrefix) {
+				t.Error("Expected prefix =>", tc.expBodyPrefix)
+			}
+		})
+	}
+}
+
+// counter is a metrics.Counter which
+// sums values per label values
+func TestDriversTenants(t *testing.T) {
+	storage := &tenantStorage{tenants: map[string]*inMemStorage{
+		"acme": {db: map[uint64]*store.Driver{
+			1: {ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		}},
+		"globex": {db: map[uint64]*store.Driver{
+			2: {ID: 2, Name: "Jane", LicenseNumber: "11-222-34"},
+		}},
+	}}
+	// the operator's key is the first one, keys without
+	// a tenant of the context are bound to the default one
+	keys := newInMemKeys(map[string][]string{"drv_operator": {auth.ScopeAdmin, auth.ScopeTenants}})
+	for _, key := range []struct {
+		name   string
+		scopes []string
+		tenant string
+	}{
+		{name: "drv_admin", scopes: []string{auth.ScopeAdmin}},
+		{name: "drv_acme", scopes: []string{auth.ScopeRead, auth.ScopeImport}, tenant: "acme"},
+		{name: "drv_acme_admin", scopes: []string{auth.ScopeAdmin}, tenant: "acme"},
+		{name: "drv_globex", scopes: []string{auth.ScopeRead, auth.ScopeImport}, tenant: "globex"},
+	} {
+		ctx := context.Background()
+		if key.tenant != "" {
+			ctx = store.WithTenant(ctx, key.tenant)
+		}
+		keys.CreateAPIKey(ctx, &store.APIKey{Name: key.name, Hash: auth.HashAPIKey(key.name), Scopes: key.scopes})
+	}
+	srv := drivers.New(nopLogger{}, storage,
+		drivers.WithAuthenticator(auth.NewAPIKeys(keys)),
+		drivers.WithAPIKeys(keys),
+		drivers.WithAudit(storage),
+	)
+	anonymous := drivers.New(nopLogger{}, storage)
+
+	// cases share the storage, they are run in order
+	for _, tc := range []struct {
+		name      string
+		srv       http.Handler
+		method    string
+		path      string
+		key       string
+		tenant    string
+		body      string
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:      "ReadOwn",
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			key:       "drv_acme",
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"name":"John","license_number":"11-222-33","links":{"self":"/api/v2/drivers/1"}}`,
+		},
+		{
+			name:      "ReadOwnWithHeader",
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			key:       "drv_acme",
+			tenant:    "acme",
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"name":"John","license_number":"11-222-33","links":{"self":"/api/v2/drivers/1"}}`,
+		},
+		{
+			name:      "ReadAnother",
+			method:    "GET",
+			path:      "/api/v2/drivers/2",
+			key:       "drv_acme",
+			expStatus: http.StatusNotFound,
+			expBody:   `{"type":"about:blank","title":"Not Found","status":404,"detail":"driver with id=2 is not found"}`,
+		},
+		{
+			name:      "ChooseAnother",
+			method:    "GET",
+			path:      "/api/v2/drivers/2",
+			key:       "drv_acme",
+			tenant:    "globex",
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; credentials are bound to another tenant"}`,
+		},
+		{
+			name:      "UnboundKeyChoosesAnother",
+			method:    "GET",
+			path:      "/api/v2/drivers/2",
+			key:       "drv_admin",
+			tenant:    "other",
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; credentials are bound to another tenant"}`,
+		},
+		{
+			name:      "UnboundKeyImportsToAnother",
+			method:    "POST",
+			path:      "/api/v2/import",
+			key:       "drv_admin",
+			tenant:    "acme",
+			body:      `[{"id":1,"name":"Evelyn","license_number":"11-222-35"}]`,
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; credentials are bound to another tenant"}`,
+		},
+		{
+			name:      "AnonymousChoosesAnother",
+			srv:       anonymous,
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			tenant:    "acme",
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; credentials are bound to another tenant"}`,
+		},
+		{
+			name:      "AnonymousOfDefault",
+			srv:       anonymous,
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			tenant:    "default",
+			expStatus: http.StatusNotFound,
+			expBody:   `{"type":"about:blank","title":"Not Found","status":404,"detail":"driver with id=1 is not found"}`,
+		},
+		{
+			name:      "ListOwn",
+			method:    "GET",
+			path:      "/api/v2/drivers",
+			key:       "drv_globex",
+			expStatus: http.StatusOK,
+			expBody:   `{"data":[{"id":2,"name":"Jane","license_number":"11-222-34","links":{"self":"/api/v2/drivers/2"}}],"links":{}}`,
+		},
+		{
+			name:      "ImportSameIDAndLicenseNumber",
+			method:    "POST",
+			path:      "/api/v2/import",
+			key:       "drv_globex",
+			body:      `[{"id":1,"name":"Jimmy","license_number":"11-222-33"}]`,
+			expStatus: http.StatusOK,
+			expBody:   `{}`,
+		},
+		{
+			name:      "UpdateAnother",
+			method:    "PUT",
+			path:      "/api/v2/drivers/2",
+			key:       "drv_acme",
+			body:      `{"name":"Evelyn","license_number":"11-222-34"}`,
+			expStatus: http.StatusNotFound,
+			expBody:   `{"type":"about:blank","title":"Not Found","status":404,"detail":"driver with id=2 is not found"}`,
+		},
+		{
+			name:      "OperatorChoosesTenant",
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			key:       "drv_operator",
+			tenant:    "globex",
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"name":"Jimmy","license_number":"11-222-33","links":{"self":"/api/v2/drivers/1"}}`,
+		},
+		{
+			name:      "OperatorWithoutTenant",
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			key:       "drv_operator",
+			expStatus: http.StatusNotFound,
+			expBody:   `{"type":"about:blank","title":"Not Found","status":404,"detail":"driver with id=1 is not found"}`,
+		},
+		{
+			name:      "InvalidTenant",
+			method:    "GET",
+			path:      "/api/v2/drivers/1",
+			key:       "drv_operator",
+			tenant:    "Globex Inc.",
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid tenant; should be up to 63 lowercase letters, digits, '-' or '_'"}`,
+		},
+		{
+			name:      "AuditOfTenant",
+			method:    "GET",
+			path:      "/api/v2/audit",
+			key:       "drv_acme_admin",
+			expStatus: http.StatusOK,
+			expBody:   `{"data":[],"links":{}}`,
+		},
+		{
+			name:      "AdminOfTenantGrantsTenants",
+			method:    "POST",
+			path:      "/api/v2/keys",
+			key:       "drv_acme_admin",
+			body:      `{"name":"operator","scopes":["drivers:admin","drivers:tenants"]}`,
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; keys with drivers:tenants scope are managed by clients with it"}`,
+		},
+		{
+			name:      "AdminOfTenantRotatesKeyOfAnother",
+			method:    "POST",
+			path:      "/api/v2/keys/2/rotate",
+			key:       "drv_acme_admin",
+			expStatus: http.StatusNotFound,
+			expBody:   `{"type":"about:blank","title":"Not Found","status":404,"detail":"api key with id=2 is not found"}`,
+		},
+		{
+			name:      "AdminRotatesKeyOfOperator",
+			method:    "POST",
+			path:      "/api/v2/keys/1/rotate",
+			key:       "drv_admin",
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; keys with drivers:tenants scope are managed by clients with it"}`,
+		},
+		{
+			name:      "AdminRevokesKeyOfOperator",
+			method:    "DELETE",
+			path:      "/api/v2/keys/1",
+			key:       "drv_admin",
+			expStatus: http.StatusForbidden,
+			expBody:   `{"type":"about:blank","title":"Forbidden","status":403,"detail":"forbidden; keys with drivers:tenants scope are managed by clients with it"}`,
+		},
+		{
+			name:      "OperatorRevokesKeyOfTenant",
+			method:    "DELETE",
+			path:      "/api/v2/keys/4",
+			key:       "drv_operator",
+			tenant:    "acme",
+			expStatus: http.StatusOK,
+			expBody:   `{}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.key != "" {
+				request.Header.Set("X-API-Key", tc.key)
+			}
+			if tc.tenant != "" {
+				request.Header.Set(drivers.TenantHeader, tc.tenant)
+			}
+			response := httptest.NewRecorder()
+
+			handler := tc.srv
+			if handler == nil {
+				handler = srv
+			}
+			handler.ServeHTTP(response, request)
+
+			t.Log("response status =>", response.Code)
+			if response.Code != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			body := strings.Replace(response.Body.String(), `,"request_id":"`+response.Header().Get("X-Request-ID")+`"}`, "}", 1)
+			t.Log("response body =>", body)
+			if body != tc.expBody+"\n" {
+				t.Error("Expected =>", tc.expBody)
+			}
+		})
 	}
+
+	// drivers of one tenant are never overwritten by another
+	acme := storage.tenants["acme"].db
+	t.Log("acme drivers =>", len(acme), acme[1])
+	if len(acme) != 1 || acme[1].Name != "John" || acme[1].LicenseNumber != "11-222-33" {
+		t.Error("Expected =>", "only John of acme")
+	}
+	globex := storage.tenants["globex"].db
+	t.Log("globex drivers =>", len(globex), globex[1], globex[2])
+	if len(globex) != 2 || globex[1].Name != "Jimmy" || globex[2].Name != "Jane" {
+		t.Error("Expected =>", "Jimmy and Jane of globex")
+	}
+}
+
+type counter struct {
+	sync.Mutex
+	lvs    []string
+	values map[string]float64
+	parent *counter
+}
+
+func (c *counter) With(labelValues ...string) metrics.Counter {
+	return &counter{lvs: append(c.lvs, labelValues...), parent: c}
+}
+
+func (c *counter) Add(delta float64) {
+	var key []string
+	for i := 0; i+1 < len(c.lvs); i += 2 {
+		key = append(key, c.lvs[i]+"="+c.lvs[i+1])
+	}
+
+	c.parent.Lock()
+	c.parent.values[strings.Join(key, ",")] += delta
+	c.parent.Unlock()
+}
+
+// histogram is a metrics.Histogram which
+// counts observations per label values
+type histogram struct {
+	c *counter
+}
+
+func (h histogram) With(labelValues ...string) metrics.Histogram {
+	return histogram{h.c.With(labelValues...).(*counter)}
+}
+
+func (h histogram) Observe(float64) {
+	h.c.Add(1)
 }
 
 type inMemStorage struct {
 	store.DriversStore
 	sync.RWMutex
 
-	db map[uint64]*store.Driver
+	db         map[uint64]*store.Driver
+	getByIDErr error
+	upsertErr  error
+	events     []*store.AuditEvent
 }
 
-func (ms *inMemStorage) UpsertBatch(_ context.Context, drivers []*store.Driver) error {
+func (ms *inMemStorage) UpsertBatch(ctx context.Context, drivers []*store.Driver) error {
+	if ms.upsertErr != nil {
+		return ms.upsertErr
+	}
 	ms.Lock()
 	for _, driver := range drivers {
+		driver.Version = 1
+		stored, ok := ms.db[driver.ID]
+		if ok {
+			driver.Version = stored.Version + 1
+		}
 		ms.db[driver.ID] = driver
+		ms.audit(ctx, store.AuditImport, stored, driver)
 	}
 	ms.Unlock()
 	return nil
 }
 
+func (ms *inMemStorage) Update(ctx context.Context, driver *store.Driver, ifVersion uint64) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	stored, ok := ms.db[driver.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if ifVersion != 0 && stored.Version != ifVersion {
+		return store.ErrVersionMismatch
+	}
+
+	driver.Version = stored.Version + 1
+	driver.UpdatedAt = time.Now()
+	ms.db[driver.ID] = driver
+	ms.audit(ctx, store.AuditUpdate, stored, driver)
+	return nil
+}
+
+// audit records a change of the driver by the actor of ctx
+func (ms *inMemStorage) audit(ctx context.Context, operation string, before, after *store.Driver) {
+	actor := store.ActorFromContext(ctx)
+	event := &store.AuditEvent{
+		ID:        uint64(len(ms.events) + 1),
+		DriverID:  after.ID,
+		Operation: operation,
+		Actor:     actor.Subject,
+		RequestID: actor.RequestID,
+		SourceIP:  actor.SourceIP,
+		After:     &store.AuditValues{Name: after.Name, LicenseNumber: after.LicenseNumber},
+		CreatedAt: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	}
+	if before != nil {
+		event.Before = &store.AuditValues{Name: before.Name, LicenseNumber: before.LicenseNumber}
+	}
+	ms.events = append(ms.events, event)
+}
+
+func (ms *inMemStorage) ListAuditEvents(_ context.Context, filter store.AuditFilter) ([]*store.AuditEvent, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	var events []*store.AuditEvent
+	for _, event := range ms.events {
+		if event.ID > filter.AfterID && !event.CreatedAt.Before(filter.Since) &&
+			(filter.DriverID == 0 || event.DriverID == filter.DriverID) && len(events) < filter.Limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
 func (ms *inMemStorage) GetByID(_ context.Context, id uint64) (*store.Driver, error) {
 	ms.RLock()
 	defer ms.RUnlock()
 
+	if ms.getByIDErr != nil {
+		return nil, ms.getByIDErr
+	}
 	if driver, ok := ms.db[id]; ok {
 		return driver, nil
 	}
@@ -126,6 +2769,164 @@ func (ms *inMemStorage) GetByID(_ context.Context, id uint64) (*store.Driver, er
 	return nil, sql.ErrNoRows
 }
 
+func (ms *inMemStorage) List(_ context.Context, afterID uint64, limit int) ([]*store.Driver, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	var drivers []*store.Driver
+	for _, driver := range ms.db {
+		if driver.ID > afterID {
+			drivers = append(drivers, driver)
+		}
+	}
+	sort.Slice(drivers, func(i, j int) bool {
+		return drivers[i].ID < drivers[j].ID
+	})
+	if len(drivers) > limit {
+		drivers = drivers[:limit]
+	}
+
+	return drivers, nil
+}
+
+// tenantStorage is an in-memory store of drivers and audit events
+// isolated per tenant of ctx
+type tenantStorage struct {
+	sync.Mutex
+
+	tenants map[string]*inMemStorage
+}
+
+func (ts *tenantStorage) of(ctx context.Context) *inMemStorage {
+	ts.Lock()
+	defer ts.Unlock()
+
+	tenant := store.TenantFromContext(ctx)
+	ms, ok := ts.tenants[tenant]
+	if !ok {
+		ms = &inMemStorage{db: make(map[uint64]*store.Driver)}
+		ts.tenants[tenant] = ms
+	}
+	return ms
+}
+
+func (ts *tenantStorage) UpsertBatch(ctx context.Context, drivers []*store.Driver) error {
+	return ts.of(ctx).UpsertBatch(ctx, drivers)
+}
+
+func (ts *tenantStorage) GetByID(ctx context.Context, id uint64) (*store.Driver, error) {
+	return ts.of(ctx).GetByID(ctx, id)
+}
+
+func (ts *tenantStorage) List(ctx context.Context, afterID uint64, limit int) ([]*store.Driver, error) {
+	return ts.of(ctx).List(ctx, afterID, limit)
+}
+
+func (ts *tenantStorage) Update(ctx context.Context, driver *store.Driver, ifVersion uint64) error {
+	return ts.of(ctx).Update(ctx, driver, ifVersion)
+}
+
+func (ts *tenantStorage) ListAuditEvents(ctx context.Context, filter store.AuditFilter) ([]*store.AuditEvent, error) {
+	return ts.of(ctx).ListAuditEvents(ctx, filter)
+}
+
+// inMemKeys is an in-memory store.APIKeysStore,
+// revoked keys are deleted
+type inMemKeys struct {
+	sync.Mutex
+
+	keys   map[uint64]*store.APIKey
+	lastID uint64
+}
+
+// newInMemKeys stores plain keys with their scopes
+func newInMemKeys(scopes map[string][]string) *inMemKeys {
+	ks := &inMemKeys{keys: make(map[uint64]*store.APIKey)}
+	for key, s := range scopes {
+		ks.CreateAPIKey(context.Background(), &store.APIKey{
+			Name:   key,
+			Hash:   auth.HashAPIKey(key),
+			Scopes: s,
+		})
+	}
+	return ks
+}
+
+func (ks *inMemKeys) CreateAPIKey(ctx context.Context, key *store.APIKey) error {
+	ks.Lock()
+	defer ks.Unlock()
+
+	ks.lastID++
+	key.ID = ks.lastID
+	key.Tenant = store.TenantFromContext(ctx)
+	key.CreatedAt = time.Now()
+	ks.keys[key.ID] = key
+	return nil
+}
+
+func (ks *inMemKeys) GetAPIKeyByHash(_ context.Context, hash []byte) (*store.APIKey, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	for _, key := range ks.keys {
+		if bytes.Equal(key.Hash, hash) {
+			return key, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (ks *inMemKeys) GetAPIKey(ctx context.Context, id uint64) (*store.APIKey, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	key, ok := ks.keys[id]
+	if !ok || key.Tenant != store.TenantFromContext(ctx) {
+		return nil, sql.ErrNoRows
+	}
+	return key, nil
+}
+
+func (ks *inMemKeys) RotateAPIKey(ctx context.Context, id uint64, hash []byte) (*store.APIKey, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	key, ok := ks.keys[id]
+	if !ok || key.Tenant != store.TenantFromContext(ctx) {
+		return nil, sql.ErrNoRows
+	}
+	key.Hash = hash
+	key.RotatedAt = time.Now()
+	return key, nil
+}
+
+func (ks *inMemKeys) RevokeAPIKey(ctx context.Context, id uint64) error {
+	ks.Lock()
+	defer ks.Unlock()
+
+	if key, ok := ks.keys[id]; !ok || key.Tenant != store.TenantFromContext(ctx) {
+		return sql.ErrNoRows
+	}
+	delete(ks.keys, id)
+	return nil
+}
+
+// staticKeys are public keys of signers of tokens by key id
+type staticKeys map[string]crypto.PublicKey
+
+func (k staticKeys) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := k[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w; signing key %q is unknown", auth.ErrInvalidCredentials, kid)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("limiter is unavailable")
+}
+
 type nopLogger struct{}
 
 func (nopLogger) Log(...interface{}) error {
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// Pinger is a connection which can be verified, like *sql.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Statser is a connection pool which reports its statistics, like *sql.DB
+type Statser interface {
+	Stats() sql.DBStats
+}
+
+// Ping checks that the DB is reachable
+func Ping(db Pinger) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// Migrations checks that there are no migrations of the source
+// which are not applied to the DB yet
+func Migrations(db *sql.DB, dialect string, source migrate.MigrationSource) Checker {
+	return CheckerFunc(func(context.Context) error {
+		planned, _, err := migrate.PlanMigration(db, dialect, source, migrate.Up, 0)
+		if err != nil {
+			return err
+		}
+		if n := len(planned); n > 0 {
+			return fmt.Errorf("%d migrations are pending", n)
+		}
+		return nil
+	})
+}
+
+// PoolSaturation checks that the share of connections in use
+// is below the threshold (0, 1] of the pool limit,
+// a pool without the limit is never saturated
+func PoolSaturation(db Statser, threshold float64) Checker {
+	return CheckerFunc(func(context.Context) error {
+		stats := db.Stats()
+		if stats.MaxOpenConnections <= 0 {
+			return nil
+		}
+		if float64(stats.InUse) >= threshold*float64(stats.MaxOpenConnections) {
+			return fmt.Errorf("%d of %d connections are in use",
+				stats.InUse, stats.MaxOpenConnections)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,153 @@
+// Package health provides liveness and readiness probes of the Drivers app.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrShuttingDown is reported by readiness probe when the app is stopping
+var ErrShuttingDown = errors.New("service is shutting down")
+
+// DefaultTimeout is a default limit of time for all checks of a probe
+const DefaultTimeout = 2 * time.Second
+
+// Checker checks a dependency of the app, non-nil error means
+// that the dependency is not ready to serve requests
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is an adapter to use ordinary functions as Checkers
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Health holds checkers of the app dependencies and its shutdown state,
+// it is safe for concurrent use
+type Health struct {
+	timeout time.Duration
+
+	mu       sync.RWMutex
+	names    []string
+	checkers map[string]Checker
+
+	shuttingDown int32
+}
+
+// New is a constructor of Health, timeout limits all checks of a
+// readiness probe, DefaultTimeout is used when timeout is not positive
+func New(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Health{
+		timeout:  timeout,
+		checkers: make(map[string]Checker),
+	}
+}
+
+// Register adds the checker to readiness probe under the name,
+// a checker with the same name is replaced
+func (h *Health) Register(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.checkers[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checkers[name] = checker
+}
+
+// Shutdown flips readiness probe to failing, so load balancers
+// stop routing new requests to the app before it stops
+func (h *Health) Shutdown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// Check runs all registered checkers concurrently and returns
+// their errors by names, it returns nil when the app is ready
+func (h *Health) Check(ctx context.Context) map[string]error {
+	if atomic.LoadInt32(&h.shuttingDown) == 1 {
+		return map[string]error{"shutdown": ErrShuttingDown}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checkers := make([]Checker, len(names))
+	for i, name := range names {
+		checkers[i] = h.checkers[name]
+	}
+	h.mu.RUnlock()
+
+	errs := make([]error, len(checkers))
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func(i int, checker Checker) {
+			defer wg.Done()
+			errs[i] = checker.Check(ctx)
+		}(i, checker)
+	}
+	wg.Wait()
+
+	var failed map[string]error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if failed == nil {
+			failed = make(map[string]error)
+		}
+		failed[names[i]] = err
+	}
+	return failed
+}
+
+// LivenessHandler responds 200 while the process is able to serve HTTP
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, http.StatusOK, status{Status: "ok"})
+	})
+}
+
+// ReadinessHandler responds 200 when all checkers pass
+// and 503 with failed checks otherwise
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed := h.Check(r.Context())
+		if len(failed) == 0 {
+			writeStatus(w, http.StatusOK, status{Status: "ok"})
+			return
+		}
+
+		resp := status{Status: "unavailable", Checks: make(map[string]string, len(failed))}
+		for name, err := range failed {
+			resp.Checks[name] = err.Error()
+		}
+		writeStatus(w, http.StatusServiceUnavailable, resp)
+	})
+}
+
+type status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func writeStatus(w http.ResponseWriter, code int, s status) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(s)
+}
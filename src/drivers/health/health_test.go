@@ -0,0 +1,169 @@
+package health_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/health"
+)
+
+func TestReadiness(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		checkers  map[string]health.Checker
+		shutdown  bool
+		expCode   int
+		expStatus string
+		expChecks map[string]string
+	}{
+		{
+			name:      "NoCheckers",
+			expCode:   http.StatusOK,
+			expStatus: "ok",
+		},
+		{
+			name: "Ready",
+			checkers: map[string]health.Checker{
+				"db":  health.Ping(pinger{}),
+				"foo": health.CheckerFunc(func(context.Context) error { return nil }),
+			},
+			expCode:   http.StatusOK,
+			expStatus: "ok",
+		},
+		{
+			name: "Failed",
+			checkers: map[string]health.Checker{
+				"db":  health.Ping(pinger{errors.New("connection refused")}),
+				"foo": health.CheckerFunc(func(context.Context) error { return nil }),
+			},
+			expCode:   http.StatusServiceUnavailable,
+			expStatus: "unavailable",
+			expChecks: map[string]string{"db": "connection refused"},
+		},
+		{
+			name: "Timeout",
+			checkers: map[string]health.Checker{
+				"slow": health.CheckerFunc(func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				}),
+			},
+			expCode:   http.StatusServiceUnavailable,
+			expStatus: "unavailable",
+			expChecks: map[string]string{"slow": context.DeadlineExceeded.Error()},
+		},
+		{
+			name: "ShuttingDown",
+			checkers: map[string]health.Checker{
+				"db": health.Ping(pinger{}),
+			},
+			shutdown:  true,
+			expCode:   http.StatusServiceUnavailable,
+			expStatus: "unavailable",
+			expChecks: map[string]string{"shutdown": health.ErrShuttingDown.Error()},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := health.New(10 * time.Millisecond)
+			for name, checker := range tc.checkers {
+				h.Register(name, checker)
+			}
+			if tc.shutdown {
+				h.Shutdown()
+			}
+
+			response := httptest.NewRecorder()
+			h.ReadinessHandler().ServeHTTP(response, httptest.NewRequest("GET", "/readyz", nil))
+
+			t.Log("response.Code =>", response.Code)
+			if response.Code != tc.expCode {
+				t.Error("Expected =>", tc.expCode)
+			}
+
+			var body struct {
+				Status string            `json:"status"`
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+				t.Error("Unexpected error =>", err)
+			}
+			t.Log("body.Status =>", body.Status)
+			if body.Status != tc.expStatus {
+				t.Error("Expected =>", tc.expStatus)
+			}
+			t.Log("body.Checks =>", body.Checks)
+			if len(body.Checks) != len(tc.expChecks) {
+				t.Error("Expected =>", tc.expChecks)
+			}
+			for name, exp := range tc.expChecks {
+				if body.Checks[name] != exp {
+					t.Error("Expected =>", tc.expChecks)
+				}
+			}
+		})
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	h := health.New(0)
+	h.Register("db", health.Ping(pinger{errors.New("connection refused")}))
+	h.Shutdown()
+
+	response := httptest.NewRecorder()
+	h.LivenessHandler().ServeHTTP(response, httptest.NewRequest("GET", "/healthz", nil))
+
+	t.Log("response.Code =>", response.Code)
+	if response.Code != http.StatusOK {
+		t.Error("Expected =>", http.StatusOK)
+	}
+}
+
+func TestPoolSaturation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stats  sql.DBStats
+		expErr bool
+	}{
+		{
+			name:  "Unlimited",
+			stats: sql.DBStats{InUse: 100},
+		},
+		{
+			name:  "Below",
+			stats: sql.DBStats{MaxOpenConnections: 24, InUse: 12},
+		},
+		{
+			name:   "Saturated",
+			stats:  sql.DBStats{MaxOpenConnections: 24, InUse: 22},
+			expErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := health.PoolSaturation(statser(tc.stats), 0.9).Check(context.Background())
+			t.Log("err =>", err)
+			if (err != nil) != tc.expErr {
+				t.Error("Expected error =>", tc.expErr)
+			}
+		})
+	}
+}
+
+type pinger struct {
+	err error
+}
+
+func (p pinger) PingContext(context.Context) error {
+	return p.err
+}
+
+type statser sql.DBStats
+
+func (s statser) Stats() sql.DBStats {
+	return sql.DBStats(s)
+}
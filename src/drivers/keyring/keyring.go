@@ -0,0 +1,235 @@
+// Package keyring protects personal data of drivers at rest by envelope
+// encryption: every value is encrypted by a random data key, which is
+// encrypted (wrapped) by a key encryption key of the keyring. Keys are
+// rotated by adding a new current key, data keys wrapped by previous
+// keys are rewrapped without decryption of values. Values are found by
+// a blind index: HMAC of the plaintext by the index key of the keyring.
+package keyring
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IndexKeyID is a reserved id of the key of the blind index,
+// it can't be rotated without recomputation of the index
+const IndexKeyID = "index"
+
+// KeySize is a size of keys, they are AES-256 keys
+const KeySize = 32
+
+// version is a version of the format of ciphertexts:
+// version, len(kid), kid, wrapped data key, encrypted value,
+// wrapped keys and values are prefixed by their nonces
+const version = 1
+
+// Errors of ciphertexts
+var (
+	ErrMalformed  = errors.New("ciphertext is malformed")
+	ErrUnknownKey = errors.New("key of ciphertext is unknown")
+)
+
+// Keyring holds key encryption keys by ids, the current one
+// wraps data keys of new values, the rest unwrap them,
+// and the key of the blind index
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+	index   []byte
+}
+
+// Parse parses a keyring "id:key,id:key,index:key", keys are base64
+// encoded 32-byte keys, the first one is the current key,
+// newlines separate keys as well as commas
+func Parse(s string) (*Keyring, error) {
+	kr := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || len(id) > 255 {
+			return nil, errors.New("keyring entry should be id:base64-key")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("key %s should be %d base64 encoded bytes", id, KeySize)
+		}
+
+		if id == IndexKeyID {
+			kr.index = key
+			continue
+		}
+		if _, ok := kr.keys[id]; ok {
+			return nil, fmt.Errorf("key %s is duplicated", id)
+		}
+		if kr.keys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+		if kr.current == "" {
+			kr.current = id
+		}
+	}
+
+	if kr.current == "" {
+		return nil, errors.New("keyring has no keys")
+	}
+	if kr.index == nil {
+		return nil, fmt.Errorf("keyring has no %s key", IndexKeyID)
+	}
+	return kr, nil
+}
+
+// Load parses a keyring file
+func Load(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(data))
+}
+
+// Current returns the id of the current key
+func (kr *Keyring) Current() string {
+	return kr.current
+}
+
+// Encrypt encrypts plaintext by a new data key wrapped by the current key,
+// aad (e.g. a table, a column and an id) should be the same for decryption,
+// so ciphertexts can't be swapped
+func (kr *Keyring) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	b := header(kr.current)
+	b, err = seal(kr.keys[kr.current], b, dataKey, b)
+	if err != nil {
+		return nil, err
+	}
+	return seal(data, b, plaintext, aad)
+}
+
+// Decrypt decrypts ciphertext of Encrypt with the same aad
+func (kr *Keyring) Decrypt(ciphertext, aad []byte) ([]byte, error) {
+	c, err := kr.parse(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := c.kek.Open(nil, c.wrapped[:c.kek.NonceSize()], c.wrapped[c.kek.NonceSize():], c.header)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.value) < data.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := data.Open(nil, c.value[:data.NonceSize()], c.value[data.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+// Rewrap wraps the data key of ciphertext by the current key,
+// the value itself is not decrypted, it returns nil
+// if the data key is wrapped by the current key already
+func (kr *Keyring) Rewrap(ciphertext []byte) ([]byte, error) {
+	c, err := kr.parse(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if c.kid == kr.current {
+		return nil, nil
+	}
+
+	dataKey, err := c.kek.Open(nil, c.wrapped[:c.kek.NonceSize()], c.wrapped[c.kek.NonceSize():], c.header)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	b := header(kr.current)
+	if b, err = seal(kr.keys[kr.current], b, dataKey, b); err != nil {
+		return nil, err
+	}
+	return append(b, c.value...), nil
+}
+
+// Index returns the blind index of plaintext, equal
+// plaintexts have equal indexes whatever the current key is
+func (kr *Keyring) Index(plaintext []byte) []byte {
+	mac := hmac.New(sha256.New, kr.index)
+	mac.Write(plaintext)
+	return mac.Sum(nil)
+}
+
+// ciphertext is a parsed ciphertext of Encrypt
+type ciphertext struct {
+	header  []byte
+	kid     string
+	kek     cipher.AEAD
+	wrapped []byte
+	value   []byte
+}
+
+func (kr *Keyring) parse(b []byte) (*ciphertext, error) {
+	if len(b) < 2 || b[0] != version || len(b) < 2+int(b[1]) {
+		return nil, ErrMalformed
+	}
+	c := &ciphertext{header: b[:2+int(b[1])], kid: string(b[2 : 2+int(b[1])])}
+
+	var ok bool
+	if c.kek, ok = kr.keys[c.kid]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, c.kid)
+	}
+	wrappedSize := c.kek.NonceSize() + KeySize + c.kek.Overhead()
+	if len(b) < len(c.header)+wrappedSize {
+		return nil, ErrMalformed
+	}
+	c.wrapped = b[len(c.header) : len(c.header)+wrappedSize]
+	c.value = b[len(c.header)+wrappedSize:]
+	return c, nil
+}
+
+func header(kid string) []byte {
+	return append([]byte{version, byte(len(kid))}, kid...)
+}
+
+// seal appends a random nonce and plaintext encrypted by aead to dst
+func seal(aead cipher.AEAD, dst, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plaintext, bytes.Clone(aad)), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
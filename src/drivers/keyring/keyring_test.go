@@ -0,0 +1,213 @@
+package keyring_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/keyring"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, keyring.KeySize))
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		keys       string
+		expCurrent string
+		expErr     string
+	}{
+		{
+			name:       "Commas",
+			keys:       "k2:" + key(2) + ",k1:" + key(1) + ",index:" + key(9),
+			expCurrent: "k2",
+		},
+		{
+			name:       "Lines",
+			keys:       "# rotated on 2026-10-19\nk2:" + key(2) + "\n\nk1:" + key(1) + "\r\nindex:" + key(9) + "\n",
+			expCurrent: "k2",
+		},
+		{
+			name:   "NoKeys",
+			keys:   "index:" + key(9),
+			expErr: "keyring has no keys",
+		},
+		{
+			name:   "NoIndexKey",
+			keys:   "k1:" + key(1),
+			expErr: "keyring has no index key",
+		},
+		{
+			name:   "ShortKey",
+			keys:   "k1:c2hvcnQ=,index:" + key(9),
+			expErr: "key k1 should be 32 base64 encoded bytes",
+		},
+		{
+			name:   "NoID",
+			keys:   key(1),
+			expErr: "keyring entry should be id:base64-key",
+		},
+		{
+			name:   "Duplicated",
+			keys:   "k1:" + key(1) + ",k1:" + key(2) + ",index:" + key(9),
+			expErr: "key k1 is duplicated",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kr, err := keyring.Parse(tc.keys)
+			t.Log("err =>", err)
+			if tc.expErr != "" {
+				if err == nil || err.Error() != tc.expErr {
+					t.Error("Expected =>", tc.expErr)
+				}
+				if err != nil && strings.Contains(err.Error(), key(1)) {
+					t.Error("Expected the key not to be in the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("Unexpected error =>", err)
+			}
+
+			t.Log("kr.Current() =>", kr.Current())
+			if kr.Current() != tc.expCurrent {
+				t.Error("Expected =>", tc.expCurrent)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte("k1:"+key(1)+"\nindex:"+key(9)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := keyring.Load(path)
+	if err != nil {
+		t.Fatal("Unexpected error =>", err)
+	}
+	t.Log("kr.Current() =>", kr.Current())
+	if kr.Current() != "k1" {
+		t.Error("Expected =>", "k1")
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	old, err := keyring.Parse("k1:" + key(1) + ",index:" + key(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := keyring.Parse("k2:" + key(2) + ",k1:" + key(1) + ",index:" + key(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, aad := []byte("11-222-33"), []byte("drivers.license_number:1")
+	ciphertext, err := old.Encrypt(plaintext, aad)
+	if err != nil {
+		t.Fatal("Unexpected error =>", err)
+	}
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Error("Expected the plaintext to be encrypted")
+	}
+	again, _ := old.Encrypt(plaintext, aad)
+	if bytes.Equal(ciphertext, again) {
+		t.Error("Expected ciphertexts of equal plaintexts to differ")
+	}
+
+	rewrapped, err := rotated.Rewrap(ciphertext)
+	if err != nil {
+		t.Fatal("Unexpected error =>", err)
+	}
+	current, err := rotated.Rewrap(rewrapped)
+	t.Log("rotated.Rewrap(rewrapped) =>", current, err)
+	if current != nil || err != nil {
+		t.Error("Expected nothing to rewrap")
+	}
+
+	for _, tc := range []struct {
+		name       string
+		kr         *keyring.Keyring
+		ciphertext []byte
+		aad        []byte
+		expErr     error
+	}{
+		{
+			name:       "Old",
+			kr:         old,
+			ciphertext: ciphertext,
+			aad:        aad,
+		},
+		{
+			name:       "PreviousKey",
+			kr:         rotated,
+			ciphertext: ciphertext,
+			aad:        aad,
+		},
+		{
+			name:       "Rewrapped",
+			kr:         rotated,
+			ciphertext: rewrapped,
+			aad:        aad,
+		},
+		{
+			name:       "UnknownKey",
+			kr:         old,
+			ciphertext: rewrapped,
+			aad:        aad,
+			expErr:     keyring.ErrUnknownKey,
+		},
+		{
+			name:       "OtherAAD",
+			kr:         old,
+			ciphertext: ciphertext,
+			aad:        []byte("drivers.license_number:2"),
+			expErr:     keyring.ErrMalformed,
+		},
+		{
+			name:       "Truncated",
+			kr:         old,
+			ciphertext: ciphertext[:len(ciphertext)-1],
+			aad:        aad,
+			expErr:     keyring.ErrMalformed,
+		},
+		{
+			name:       "Empty",
+			kr:         old,
+			ciphertext: []byte{},
+			aad:        aad,
+			expErr:     keyring.ErrMalformed,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			decrypted, err := tc.kr.Decrypt(tc.ciphertext, tc.aad)
+			t.Log("err =>", err)
+			if !errors.Is(err, tc.expErr) {
+				t.Error("Expected =>", tc.expErr)
+			}
+			if tc.expErr != nil {
+				return
+			}
+			t.Log("decrypted =>", string(decrypted))
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Error("Expected =>", string(plaintext))
+			}
+		})
+	}
+
+	// the index is stable across rotations of keys
+	t.Log("old.Index(plaintext) =>", old.Index(plaintext))
+	if !bytes.Equal(old.Index(plaintext), rotated.Index(plaintext)) {
+		t.Error("Expected =>", rotated.Index(plaintext))
+	}
+	if bytes.Equal(old.Index(plaintext), old.Index([]byte("11-222-34"))) {
+		t.Error("Expected indexes of other plaintexts to differ")
+	}
+}
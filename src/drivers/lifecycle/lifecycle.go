@@ -0,0 +1,105 @@
+// Package lifecycle stops the Drivers app gracefully: it waits for a
+// termination signal and runs shutdown stages in order within a grace period.
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// DefaultGracePeriod is a default limit of time for all shutdown stages
+const DefaultGracePeriod = 25 * time.Second
+
+// Stage stops a part of the app, it should return as soon as ctx is done
+type Stage func(ctx context.Context) error
+
+// Manager holds shutdown stages of the app
+type Manager struct {
+	logger      log.Logger
+	gracePeriod time.Duration
+	signals     []os.Signal
+	names       []string
+	stages      []Stage
+}
+
+// New is a constructor of Manager, which traps SIGTERM (sent by
+// Heroku and Kubernetes) and SIGINT, gracePeriod limits all stages,
+// DefaultGracePeriod is used when gracePeriod is not positive
+func New(logger log.Logger, gracePeriod time.Duration) *Manager {
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+	return &Manager{
+		logger:      logger,
+		gracePeriod: gracePeriod,
+		signals:     []os.Signal{syscall.SIGTERM, os.Interrupt},
+	}
+}
+
+// OnShutdown appends the stage, stages run in order of appending
+func (m *Manager) OnShutdown(name string, stage Stage) {
+	m.names = append(m.names, name)
+	m.stages = append(m.stages, stage)
+}
+
+// Wait blocks until a termination signal is received
+// or an error appears in errs, the error is returned
+func (m *Manager) Wait(errs <-chan error) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, m.signals...)
+	defer signal.Stop(stop)
+
+	select {
+	case sig := <-stop:
+		level.Info(m.logger).Log("message", "shutting down", "signal", sig)
+		return nil
+	case err := <-errs:
+		level.Error(m.logger).Log("message", "shutting down", "err", err)
+		return err
+	}
+}
+
+// Shutdown runs all stages one by one, they share the grace period,
+// a failed stage does not prevent the next ones from running,
+// the first error is returned
+func (m *Manager) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.gracePeriod)
+	defer cancel()
+
+	var first error
+	for i, stage := range m.stages {
+		begin := time.Now()
+		err := stage(ctx)
+		if err != nil {
+			level.Error(m.logger).Log("stage", m.names[i], "took", time.Since(begin), "err", err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		level.Info(m.logger).Log("stage", m.names[i], "took", time.Since(begin))
+	}
+	return first
+}
+
+// Sleep returns a stage which waits for d, e.g. for load balancers
+// to notice that the app is not ready
+func Sleep(d time.Duration) Stage {
+	return func(ctx context.Context) error {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/konjoot/drivers-go-kit/src/drivers/lifecycle"
+)
+
+func TestWait(t *testing.T) {
+	m := lifecycle.New(log.NewNopLogger(), 0)
+
+	errs := make(chan error, 1)
+	errs <- errors.New("listen tcp :8080: bind: address already in use")
+	err := m.Wait(errs)
+	t.Log("Wait on error =>", err)
+	if fmt.Sprint(err) != "listen tcp :8080: bind: address already in use" {
+		t.Error("Expected =>", "listen tcp :8080: bind: address already in use")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	}()
+	err = m.Wait(make(chan error))
+	t.Log("Wait on SIGTERM =>", err)
+	if err != nil {
+		t.Error("Expected =>", nil)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var stages []string
+	stage := func(name string, err error) lifecycle.Stage {
+		return func(context.Context) error {
+			stages = append(stages, name)
+			return err
+		}
+	}
+
+	m := lifecycle.New(log.NewNopLogger(), 20*time.Millisecond)
+	m.OnShutdown("readiness", stage("readiness", nil))
+	m.OnShutdown("drain", lifecycle.Sleep(time.Second))
+	m.OnShutdown("http", stage("http", errors.New("http: Server closed")))
+	m.OnShutdown("db", stage("db", nil))
+
+	begin := time.Now()
+	err := m.Shutdown()
+	took := time.Since(begin)
+
+	t.Log("err =>", err)
+	if err != context.DeadlineExceeded {
+		t.Error("Expected =>", context.DeadlineExceeded)
+	}
+	t.Log("took =>", took)
+	if took > 500*time.Millisecond {
+		t.Error("Expected to be limited by the grace period")
+	}
+	t.Log("stages =>", stages)
+	if fmt.Sprint(stages) != "[readiness http db]" {
+		t.Error("Expected =>", "[readiness http db]")
+	}
+}
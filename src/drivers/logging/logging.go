@@ -0,0 +1,30 @@
+// Package logging carries a request scoped logger in context,
+// so every layer of the Drivers app logs with the same keyvals
+// (e.g. request_id) without passing a logger around.
+package logging
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+)
+
+// ctxKey type is needed to avoid
+// key collisions in context
+type ctxKey int
+
+const loggerKey ctxKey = 0
+
+// NewContext returns a copy of ctx which carries the logger
+func NewContext(ctx context.Context, logger log.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger stored in ctx,
+// or a logger which discards everything
+func FromContext(ctx context.Context) log.Logger {
+	if logger, ok := ctx.Value(loggerKey).(log.Logger); ok {
+		return logger
+	}
+	return log.NewNopLogger()
+}
@@ -3,10 +3,31 @@ package drivers
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/konjoot/drivers-go-kit/src/drivers/auth"
+	"github.com/konjoot/drivers-go-kit/src/drivers/certs"
+	"github.com/konjoot/drivers-go-kit/src/drivers/codec"
+	"github.com/konjoot/drivers-go-kit/src/drivers/compress"
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/logging"
+	"github.com/konjoot/drivers-go-kit/src/drivers/ratelimit"
+	"github.com/konjoot/drivers-go-kit/src/drivers/redact"
+	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ctxKey type is needed to avoid
@@ -14,44 +35,700 @@ import (
 type ctxKey string
 
 const (
-	requestIDName ctxKey = "X-Request-ID"
+	requestIDName   ctxKey = "X-Request-ID"
+	ifNoneMatchName ctxKey = "If-None-Match"
+	rateLimitName   ctxKey = "RateLimit"
+	redactorName    ctxKey = "Redactor"
+	compressionName ctxKey = "Compression"
+	tenantName      ctxKey = "X-Tenant-ID"
+	clientIPName    ctxKey = "Client-IP"
 )
 
-// logRecoverMiddleware wraps endpoints to provide logging of errors
-// and panic recovery
-func logRecoverMiddleware(logger log.Logger) endpoint.Middleware {
+// maxRequestIDLength limits untrusted X-Request-ID headers
+const maxRequestIDLength = 128
+
+// logRecoverMiddleware wraps endpoints to provide logging of panics
+// and panic recovery, the logger is taken from the context, it is bound
+// to the subject of the client by authMiddleware and redacts personal
+// data of records (see WithRedactor), errors are logged by logErrorHandler
+func logRecoverMiddleware() endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (out interface{}, err error) {
 			defer func() {
 				if rec := recover(); rec != nil {
-					logger.Log("request_id", ctx.Value(requestIDName), "panic", rec)
+					level.Error(logging.FromContext(ctx)).Log("panic", rec)
 					err = fmt.Errorf("%s", rec)
 				}
 			}()
-			out, err = next(ctx, request)
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// authMiddleware authenticates credentials of the context
+// and checks that the principal has the scope, the principal is
+// stored into the context and its subject is bound to the logger,
+// the middleware does nothing if the authenticator is nil
+func authMiddleware(a auth.Authenticator, scope string) endpoint.Middleware {
+	if a == nil {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+
+	challenge := auth.SchemeAPIKey + ` realm="` + auth.Realm + `"`
+	if c, ok := a.(auth.Challenger); ok {
+		challenge = c.Challenge()
+	}
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			principal, err := a.Authenticate(ctx, auth.CredentialsFromContext(ctx))
+			if auth.Unauthenticated(err) {
+				return nil, service.Unauthorized(err, challenge)
+			}
+			if err != nil {
+				return nil, service.InternalServerError(err)
+			}
+			if !principal.Allows(scope) {
+				return nil, service.Forbidden(fmt.Errorf(ErrForbiddenTempl, scope))
+			}
+
+			ctx = auth.NewContext(ctx, principal)
+			ctx = logging.NewContext(ctx, log.With(logging.FromContext(ctx), "subject", principal.Subject))
+			return next(ctx, request)
+		}
+	}
+}
+
+// populateTenant stores TenantHeader into the context for tenantMiddleware
+func populateTenant(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, tenantName, r.Header.Get(TenantHeader))
+}
+
+// tenantMiddleware stores the tenant of drivers into the context (see
+// store.WithTenant): the tenant of the principal, store.DefaultTenant
+// for principals without one and anonymous clients; only principals
+// with auth.ScopeTenants choose another tenant by TenantHeader, others
+// are rejected with 403, the tenant is bound to the logger
+func tenantMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			tenant := store.DefaultTenant
+			principal, ok := auth.FromContext(ctx)
+			if ok && principal.Tenant != "" {
+				tenant = principal.Tenant
+			}
+
+			if header, _ := ctx.Value(tenantName).(string); header != "" && header != tenant {
+				if !store.ValidTenant(header) {
+					return nil, service.BadRequest(service.ErrInvalidTenant)
+				}
+				if !ok || !principal.Allows(auth.ScopeTenants) {
+					return nil, service.Forbidden(ErrForeignTenant)
+				}
+				tenant = header
+			}
+
+			ctx = store.WithTenant(ctx, tenant)
+			ctx = logging.NewContext(ctx, log.With(logging.FromContext(ctx), "tenant", tenant))
+			return next(ctx, request)
+		}
+	}
+}
+
+// AnonymousActor is an actor of audit events of unauthenticated clients
+const AnonymousActor = "anonymous"
+
+// clientIP returns the IP of the client of the request: the remote IP or,
+// behind hops trusted proxies, the address appended to X-Forwarded-For
+// by the farthest of them, addresses before it are set by clients
+func clientIP(r *http.Request, hops int) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	if hops <= 0 {
+		return remoteIP
+	}
+
+	var forwarded []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(value, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(ip))
+		}
+	}
+	if len(forwarded) == 0 {
+		return remoteIP
+	}
+	i := len(forwarded) - hops
+	if i < 0 {
+		i = 0
+	}
+	if net.ParseIP(forwarded[i]) == nil {
+		return remoteIP
+	}
+	return forwarded[i]
+}
+
+// populateClientIP stores the IP of the client (see clientIP)
+// into the context for actorMiddleware
+func populateClientIP(hops int) httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return context.WithValue(ctx, clientIPName, clientIP(r, hops))
+	}
+}
+
+// actorMiddleware stores the actor of audit events into the context:
+// the subject of the principal or of a client certificate, the request id
+// and the IP of the client populated by populateClientIP
+func actorMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			subject := AnonymousActor
+			if principal, ok := auth.FromContext(ctx); ok {
+				subject = principal.Subject
+			} else if client := certs.SubjectFromContext(ctx); client != "" {
+				subject = "cert:" + client
+			}
+
+			sourceIP, _ := ctx.Value(clientIPName).(string)
+
+			return next(store.WithActor(ctx, store.Actor{
+				Subject:   subject,
+				RequestID: requestIDFrom(ctx),
+				SourceIP:  sourceIP,
+			}), request)
+		}
+	}
+}
+
+// ErrRateLimitedTempl is a template of an error of an exhausted budget
+var ErrRateLimitedTempl = "too many requests; %s budget of %s is exhausted"
+
+// rateLimitMiddleware takes a token of the client's bucket of the budget
+// of the scope, it rejects the request with 429 if the bucket is empty,
+// the client is the actor stored by actorMiddleware: the subject of
+// credentials or the IP of anonymous clients, the request is let
+// through if the limiter fails, the middleware does nothing if l is nil
+func rateLimitMiddleware(l ratelimit.Limiter, budgets *ratelimit.AtomicBudgets, scope string) endpoint.Middleware {
+	class := ratelimit.ClassRead
+	if scope == auth.ScopeImport {
+		class = ratelimit.ClassImport
+	}
+	return limitMiddleware(l, budgets, class, func(ctx context.Context) string {
+		client := store.ActorFromContext(ctx).Subject
+		if client == "" || client == AnonymousActor {
+			client = "ip:" + store.ActorFromContext(ctx).SourceIP
+		}
+		return client
+	})
+}
+
+// ipRateLimitMiddleware takes a token of the bucket of the client's IP
+// (see populateClientIP) of ratelimit.ClassIP budget, it goes before
+// authMiddleware, so requests with invalid credentials are limited too
+func ipRateLimitMiddleware(l ratelimit.Limiter, budgets *ratelimit.AtomicBudgets) endpoint.Middleware {
+	return limitMiddleware(l, budgets, ratelimit.ClassIP, func(ctx context.Context) string {
+		ip, _ := ctx.Value(clientIPName).(string)
+		return "ip:" + ip
+	})
+}
+
+// limitMiddleware takes a token of the bucket of the client of ctx
+// of the budget of the class, see rateLimitMiddleware
+func limitMiddleware(l ratelimit.Limiter, budgets *ratelimit.AtomicBudgets, class string, clientFrom func(context.Context) string) endpoint.Middleware {
+	if l == nil || budgets == nil {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			limit := budgets.Load().For(class)
+			if limit.Unlimited() {
+				return next(ctx, request)
+			}
+
+			client := clientFrom(ctx)
+
+			result, err := l.Take(ctx, class+"|"+client, limit)
 			if err != nil {
-				logger.Log("request_id", ctx.Value(requestIDName), "err", err)
+				level.Warn(logging.FromContext(ctx)).Log("message", "rate limit is not checked", "err", err)
+				return next(ctx, request)
 			}
+			if r, ok := ctx.Value(rateLimitName).(*ratelimit.Result); ok {
+				*r = result
+			}
+			if !result.Allowed {
+				return nil, service.TooManyRequests(fmt.Errorf(ErrRateLimitedTempl, class, client), result.Headers())
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// populateRateLimit stores a holder of the result of rateLimitMiddleware
+// into the context, so RateLimit-* headers are sent by writeRateLimit
+func populateRateLimit(ctx context.Context, _ *http.Request) context.Context {
+	return context.WithValue(ctx, rateLimitName, &ratelimit.Result{})
+}
+
+// writeRateLimit sets RateLimit-* headers of a successful response
+// if the rate of the request is limited
+func writeRateLimit(ctx context.Context, w http.ResponseWriter) context.Context {
+	if r, ok := ctx.Value(rateLimitName).(*ratelimit.Result); ok && r.Limit > 0 {
+		for k, values := range r.Headers() {
+			w.Header()[k] = values
+		}
+	}
+	return ctx
+}
+
+// logErrorHandler logs errors of transports: failures of decoding
+// requests, of endpoints and of encoding responses,
+// server errors are logged at error level, client errors at warn level
+type logErrorHandler struct{}
+
+func (logErrorHandler) Handle(ctx context.Context, err error) {
+	logger := logging.FromContext(ctx)
+	if codeFrom(err) >= http.StatusInternalServerError {
+		level.Error(logger).Log("err", err)
+		return
+	}
+	level.Warn(logger).Log("err", err)
+}
+
+// instrumentingMiddleware wraps endpoints to count requests and errors
+// and to measure latency, metrics are labelled by endpoint and status
+func instrumentingMiddleware(name string, m EndpointMetrics) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (out interface{}, err error) {
+			defer func(begin time.Time) {
+				status := http.StatusOK
+				if err != nil {
+					status = codeFrom(err)
+				}
+
+				lvs := []string{"endpoint", name, "status", strconv.Itoa(status)}
+				m.Requests.With(lvs...).Add(1)
+				if err != nil {
+					m.Errors.With(lvs...).Add(1)
+				}
+				m.Latency.With(lvs...).Observe(time.Since(begin).Seconds())
+			}(time.Now())
 
-			return out, err
+			return next(ctx, request)
 		}
 	}
 }
 
+// tracingMiddleware wraps endpoints to record a span per call,
+// the span is marked as failed if the endpoint returns an error
+func tracingMiddleware(name string, tracer trace.Tracer) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (out interface{}, err error) {
+			ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+			defer func() {
+				status := http.StatusOK
+				if err != nil {
+					status = codeFrom(err)
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				span.SetAttributes(
+					attribute.Int("http.response.status_code", status),
+					attribute.String("request_id", requestIDFrom(ctx)),
+				)
+				span.End()
+			}()
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// traceContextMiddleware decorates http.Handler
+// extracts a trace context (W3C traceparent and tracestate headers)
+// from request Headers and stores it into request's context,
+// so spans of endpoints continue the trace of a caller
+type traceContextMiddleware struct {
+	srv        http.Handler
+	propagator propagation.TextMapPropagator
+}
+
+func (tm *traceContextMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r = r.WithContext(tm.propagator.Extract(
+		r.Context(),
+		propagation.HeaderCarrier(r.Header),
+	))
+
+	tm.srv.ServeHTTP(w, r)
+}
+
 // requestIDMiddleware decorates http.Handler
 // get X-Request-ID (provided by Heroku)
-// from request Headers and
-// stores it into request's context
+// from request Headers or generates a new one
+// if it is missing or invalid, echoes it in response Headers and
+// stores it with a logger bound to it into request's context
 type requestIDMiddleware struct {
-	srv http.Handler
+	srv    http.Handler
+	logger log.Logger
 }
 
 func (rm *requestIDMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	r = r.WithContext(context.WithValue(
-		r.Context(),
-		requestIDName,
-		r.Header.Get(string(requestIDName)),
-	))
+	id := r.Header.Get(string(requestIDName))
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	w.Header().Set(string(requestIDName), id)
+
+	ctx := context.WithValue(r.Context(), requestIDName, id)
+	ctx = logging.NewContext(ctx, log.With(rm.logger, "request_id", id))
+
+	rm.srv.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// validRequestID reports whether the id is safe to be logged and echoed,
+// only letters, digits and "-_.:" are allowed
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDFrom returns the request id stored in ctx
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDName).(string)
+	return id
+}
+
+// clientSubjectMiddleware decorates http.Handler
+// stores the subject of a verified client certificate (mutual TLS)
+// into request's context for authorization and binds it
+// to the logger of request's context
+type clientSubjectMiddleware struct {
+	srv http.Handler
+}
+
+func (cm *clientSubjectMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	subject, err := certs.ClientSubject(r.TLS)
+	if err != nil {
+		cm.srv.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := certs.NewContext(r.Context(), subject)
+	ctx = logging.NewContext(ctx, log.With(logging.FromContext(ctx), "client", subject))
+
+	cm.srv.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// errorRedactionMiddleware decorates http.Handler
+// stores the redactor of error responses into request's context,
+// errors are encoded as they are without it
+type errorRedactionMiddleware struct {
+	srv      http.Handler
+	redactor redact.Redactor
+}
+
+func (em *errorRedactionMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	em.srv.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), redactorName, em.redactor)))
+}
+
+// errorRedactorFrom returns the redactor of error responses stored in ctx
+func errorRedactorFrom(ctx context.Context) redact.Redactor {
+	if r, ok := ctx.Value(redactorName).(redact.Redactor); ok {
+		return r
+	}
+	return redact.Nop
+}
+
+// accessLogMiddleware decorates http.Handler of the router
+// logs every request with the logger of request's context,
+// server errors are logged at error level, the rest at info level
+type accessLogMiddleware struct {
+	srv            http.Handler
+	router         *mux.Router
+	trustedProxies int
+}
+
+func (am *accessLogMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	begin := time.Now()
+
+	// the route is matched before serving, because the request
+	// which reaches the router's handlers is a copy
+	var route string
+	var match mux.RouteMatch
+	if am.router.Match(r, &match) && match.Route != nil {
+		route, _ = match.Route.GetPathTemplate()
+	}
+
+	rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+	am.srv.ServeHTTP(rw, r)
+
+	logger := level.Info(logging.FromContext(r.Context()))
+	if rw.status >= http.StatusInternalServerError {
+		logger = level.Error(logging.FromContext(r.Context()))
+	}
+
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	keyvals := []interface{}{
+		"method", r.Method,
+		"route", route,
+		"path", r.URL.Path,
+		"status", rw.status,
+		"bytes", rw.bytes,
+		"took", time.Since(begin),
+		"remote_ip", remoteIP,
+		"client_ip", clientIP(r, am.trustedProxies),
+	}
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		keyvals = append(keyvals, "forwarded_for", forwardedFor)
+	}
+	logger.Log(keyvals...)
+}
+
+// responseWriter records status and size of a response
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// corsMiddleware decorates http.Handler of the router
+// answers preflight requests (OPTIONS with Access-Control-Request-Method)
+// by the policy and allows cross-origin requests of allowed origins,
+// preflight requests which are not allowed are rejected with 403
+type corsMiddleware struct {
+	srv     http.Handler
+	policy  CORS
+	origins map[string]bool
+	methods map[string]bool
+	headers map[string]bool
+	exposed string
+}
+
+func newCORSMiddleware(srv http.Handler, policy CORS) *corsMiddleware {
+	cm := &corsMiddleware{
+		srv:     srv,
+		policy:  policy,
+		origins: make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+	for _, origin := range policy.AllowedOrigins {
+		cm.origins[strings.ToLower(origin)] = true
+	}
+	for _, method := range policy.AllowedMethods {
+		cm.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range policy.AllowedHeaders {
+		cm.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	exposed := policy.ExposedHeaders
+	if exposed == nil {
+		exposed = DefaultCORSExposedHeaders
+	}
+	cm.exposed = strings.Join(exposed, ", ")
+	return cm
+}
+
+func (cm *corsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	allowed := origin != "" && (cm.origins["*"] || cm.origins[strings.ToLower(origin)])
+	if preflight && (!allowed || !cm.allowsPreflight(r)) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if !allowed {
+		cm.srv.ServeHTTP(w, r)
+		return
+	}
+
+	// credentials are allowed to listed origins only,
+	// origins allowed by the wildcard never get them
+	if cm.origins[strings.ToLower(origin)] {
+		h.Set("Access-Control-Allow-Origin", origin)
+		if cm.policy.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+	} else {
+		h.Set("Access-Control-Allow-Origin", "*")
+	}
+
+	if !preflight {
+		if cm.exposed != "" {
+			h.Set("Access-Control-Expose-Headers", cm.exposed)
+		}
+		cm.srv.ServeHTTP(w, r)
+		return
+	}
+
+	h.Set("Access-Control-Allow-Methods", strings.Join(cm.policy.AllowedMethods, ", "))
+	if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+		h.Set("Access-Control-Allow-Headers", requested)
+	}
+	if cm.policy.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(cm.policy.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowsPreflight reports whether the method and
+// the headers of the preflight request are allowed
+func (cm *corsMiddleware) allowsPreflight(r *http.Request) bool {
+	if !cm.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))] {
+		return false
+	}
+	if cm.headers["*"] {
+		return true
+	}
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !cm.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// bodyLimitMiddleware decorates http.Handler
+// limits the size of request bodies, decoders
+// respond with 413 when a body exceeds the limit
+type bodyLimitMiddleware struct {
+	srv   http.Handler
+	limit int64
+}
+
+func (bm *bodyLimitMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, bm.limit)
+	bm.srv.ServeHTTP(w, r)
+}
+
+// deprecationMiddleware decorates http.Handler of a deprecated API version,
+// it announces the deprecation date (RFC 9745), the sunset date (if it is known),
+// the documentation and the successor version in response headers
+type deprecationMiddleware struct {
+	srv           http.Handler
+	deprecation   time.Time
+	sunset        time.Time
+	documentation string
+	successor     string
+}
+
+func (dm *deprecationMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Deprecation", "@"+strconv.FormatInt(dm.deprecation.Unix(), 10))
+	if !dm.sunset.IsZero() {
+		w.Header().Set("Sunset", dm.sunset.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Add("Link", "<"+dm.documentation+`>; rel="deprecation"; type="text/html"`)
+	w.Header().Add("Link", "<"+dm.successor+`>; rel="successor-version"`)
+
+	dm.srv.ServeHTTP(w, r)
+}
+
+// negotiationMiddleware decorates http.Handler
+// picks a codec for the response by Accept header
+// and stores it with the registry into request's context,
+// it responds with 406 if none of the accepted media types is supported,
+// an encoding of the response is picked by Accept-Encoding header
+type negotiationMiddleware struct {
+	srv              http.Handler
+	codecs           *codec.Registry
+	encodings        compress.Encodings
+	compressMinBytes int
+	encodeError      httptransport.ErrorEncoder
+}
+
+func (nm *negotiationMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept")
+
+	ctx := codec.NewContext(r.Context(), nm.codecs)
+	if len(nm.encodings) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if enc := nm.encodings.Negotiate(r.Header.Get("Accept-Encoding")); enc != nil {
+			ctx = context.WithValue(ctx, compressionName, compression{enc, nm.compressMinBytes})
+		}
+	}
+
+	c, err := nm.codecs.Negotiate(r.Header.Get("Accept"))
+	if err != nil {
+		nm.encodeError(ctx, err, w)
+		return
+	}
+
+	nm.srv.ServeHTTP(w, r.WithContext(codec.WithAccepted(ctx, c)))
+}
+
+// compression is an encoding of a response negotiated by negotiationMiddleware,
+// responses smaller than minBytes are not compressed
+type compression struct {
+	encoding compress.Encoding
+	minBytes int
+}
+
+// decompressionMiddleware decorates http.Handler
+// decompresses request bodies by Content-Encoding header,
+// decompressed bodies over the limit are rejected by decoders
+// with 413, decoders reject bodies of unknown encodings with 415
+type decompressionMiddleware struct {
+	srv   http.Handler
+	limit int64
+}
+
+func (dm *decompressionMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	enc, err := compress.Default.Lookup(r.Header.Get("Content-Encoding"))
+	if err != nil || enc == nil || dm.limit <= 0 {
+		dm.srv.ServeHTTP(w, r)
+		return
+	}
 
-	rm.srv.ServeHTTP(w, r)
+	r = r.Clone(r.Context())
+	r.Body = http.MaxBytesReader(w, enc.NewReader(r.Body), dm.limit)
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	dm.srv.ServeHTTP(w, r)
 }
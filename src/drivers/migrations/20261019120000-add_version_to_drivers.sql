@@ -0,0 +1,10 @@
+
+-- +migrate Up
+ALTER TABLE drivers
+    ADD COLUMN version    bigint      NOT NULL DEFAULT 1,
+    ADD COLUMN updated_at timestamptz NOT NULL DEFAULT now();
+
+-- +migrate Down
+ALTER TABLE drivers
+    DROP COLUMN version,
+    DROP COLUMN updated_at;
@@ -0,0 +1,14 @@
+
+-- +migrate Up
+CREATE TABLE api_keys (
+    id         bigserial   PRIMARY KEY,
+    name       text        NOT NULL,
+    hash       bytea       NOT NULL UNIQUE,
+    scopes     text[]      NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    rotated_at timestamptz,
+    revoked_at timestamptz
+);
+
+-- +migrate Down
+DROP TABLE api_keys;
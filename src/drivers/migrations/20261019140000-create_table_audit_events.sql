@@ -0,0 +1,30 @@
+-- +migrate Up
+CREATE TABLE audit_events (
+    id         bigserial   PRIMARY KEY,
+    driver_id  bigint      NOT NULL,
+    operation  text        NOT NULL,
+    actor      text        NOT NULL,
+    request_id text        NOT NULL,
+    source_ip  text        NOT NULL,
+    before     jsonb,
+    after      jsonb       NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX audit_events_driver_id_idx ON audit_events (driver_id, id);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+-- events are append-only
+-- +migrate StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_events_append_only();
+
+-- +migrate Down
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only();
@@ -0,0 +1,20 @@
+-- +migrate Up
+-- license numbers are encrypted by the app, they are unique by a blind index,
+-- plaintext license_number is NULL for encrypted rows ("migrate encrypt");
+-- plaintext rows are indexed as well by the app started with a keyring,
+-- so the index is unique between plaintext and encrypted rows
+ALTER TABLE drivers
+    ADD COLUMN license_number_enc   bytea,
+    ADD COLUMN license_number_index bytea CONSTRAINT drivers_license_number_index_key UNIQUE,
+    ALTER COLUMN license_number DROP NOT NULL,
+    ADD CONSTRAINT drivers_license_number_check
+        CHECK ((license_number IS NULL) <> (license_number_enc IS NULL)
+           AND (license_number_enc IS NULL OR license_number_index IS NOT NULL));
+
+-- +migrate Down
+-- it fails if there are encrypted rows, they can't be decrypted by SQL
+ALTER TABLE drivers
+    DROP CONSTRAINT drivers_license_number_check,
+    ALTER COLUMN license_number SET NOT NULL,
+    DROP COLUMN license_number_enc,
+    DROP COLUMN license_number_index;
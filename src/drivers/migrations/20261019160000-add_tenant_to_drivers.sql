@@ -0,0 +1,40 @@
+-- +migrate Up
+-- drivers are isolated per tenant (fleet operator): ids and license numbers
+-- are unique within a tenant, existing rows belong to the default tenant
+ALTER TABLE drivers
+    ADD COLUMN tenant_id text NOT NULL DEFAULT 'default',
+    DROP CONSTRAINT drivers_pkey,
+    ADD CONSTRAINT drivers_pkey PRIMARY KEY (tenant_id, id),
+    DROP CONSTRAINT drivers_license_number_key,
+    ADD CONSTRAINT drivers_license_number_key UNIQUE (tenant_id, license_number),
+    DROP CONSTRAINT drivers_license_number_index_key,
+    ADD CONSTRAINT drivers_license_number_index_key UNIQUE (tenant_id, license_number_index);
+
+ALTER TABLE audit_events
+    ADD COLUMN tenant_id text NOT NULL DEFAULT 'default';
+DROP INDEX audit_events_driver_id_idx;
+CREATE INDEX audit_events_driver_id_idx ON audit_events (tenant_id, driver_id, id);
+
+-- every key is bound to a tenant, existing keys belong to the default one,
+-- only keys with drivers:tenants scope may choose another by X-Tenant-ID header
+ALTER TABLE api_keys
+    ADD COLUMN tenant_id text NOT NULL DEFAULT 'default';
+
+-- +migrate Down
+-- it fails if ids or license numbers of drivers are shared by tenants
+ALTER TABLE api_keys
+    DROP COLUMN tenant_id;
+
+DROP INDEX audit_events_driver_id_idx;
+CREATE INDEX audit_events_driver_id_idx ON audit_events (driver_id, id);
+ALTER TABLE audit_events
+    DROP COLUMN tenant_id;
+
+ALTER TABLE drivers
+    DROP CONSTRAINT drivers_license_number_index_key,
+    ADD CONSTRAINT drivers_license_number_index_key UNIQUE (license_number_index),
+    DROP CONSTRAINT drivers_license_number_key,
+    ADD CONSTRAINT drivers_license_number_key UNIQUE (license_number),
+    DROP CONSTRAINT drivers_pkey,
+    ADD CONSTRAINT drivers_pkey PRIMARY KEY (id),
+    DROP COLUMN tenant_id;
@@ -0,0 +1,37 @@
+-- +migrate Up
+-- events are append-only, but license numbers of historical events are encrypted
+-- by "migrate encrypt", it updates them as drivers_audit_encryptor, the only role
+-- allowed to do it, the role is granted to the user running migrations
+-- +migrate StatementBegin
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'drivers_audit_encryptor') THEN
+        CREATE ROLE drivers_audit_encryptor NOLOGIN;
+    END IF;
+END;
+$$;
+-- +migrate StatementEnd
+GRANT SELECT, UPDATE ON audit_events TO drivers_audit_encryptor;
+GRANT drivers_audit_encryptor TO CURRENT_USER;
+
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND current_user = 'drivers_audit_encryptor' THEN
+        RETURN NULL;
+    END IF;
+    RAISE EXCEPTION 'audit_events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +migrate StatementEnd
+-- the role may be used by other databases of the cluster, so it's kept
+REVOKE ALL ON audit_events FROM drivers_audit_encryptor;
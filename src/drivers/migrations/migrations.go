@@ -0,0 +1,57 @@
+// Package migrations holds SQL migrations of the Drivers app,
+// they are embedded into the binary.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// FS holds the migrations, they are at the root
+//
+//go:embed *.sql
+var FS embed.FS
+
+// Dialect is a dialect of the migrations
+const Dialect = "postgres"
+
+// LockID is a key of Postgres advisory lock held while migrations are applied
+const LockID int64 = 0x64726976657273 // "drivers"
+
+// Source returns the migrations embedded into the binary
+// or, if dir is not empty, the migrations from the directory
+func Source(dir string) migrate.MigrationSource {
+	if dir != "" {
+		return &migrate.FileMigrationSource{Dir: dir}
+	}
+	return &migrate.EmbedFileSystemMigrationSource{
+		FileSystem: FS,
+		Root:       ".",
+	}
+}
+
+// WithLock runs f holding Postgres advisory lock, so replicas
+// booting at once apply migrations one by one, the lock holds
+// a connection of the pool, so f can't use all of them
+func WithLock(ctx context.Context, db *sql.DB, f func() error) (err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", LockID); err != nil {
+		return err
+	}
+	defer func() {
+		_, unlockErr := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", LockID)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return f()
+}
@@ -0,0 +1,44 @@
+package migrations_test
+
+import (
+	"testing"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/migrations"
+)
+
+func TestSource(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		dir  string
+	}{
+		{
+			name: "Embedded",
+		},
+		{
+			name: "Directory",
+			dir:  ".",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			found, err := migrations.Source(tc.dir).FindMigrations()
+			if err != nil {
+				t.Error("Unexpected error =>", err)
+			}
+
+			t.Log("len(migrations) =>", len(found))
+			if len(found) == 0 {
+				t.Error("Expected migrations")
+			}
+
+			for _, m := range found {
+				t.Log("migration =>", m.Id)
+				if len(m.Up) == 0 {
+					t.Error("Expected Up statements of =>", m.Id)
+				}
+				if len(m.Down) == 0 {
+					t.Error("Expected Down statements of =>", m.Id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Package ratelimit limits rates of requests of clients by token buckets.
+// A bucket is refilled at Rate tokens per second up to Burst tokens,
+// every request takes a token. Buckets are kept by a Limiter, Memory
+// keeps them in-process, distributed backends implement Limiter too.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limit is a budget of a bucket, a zero Rate means no limit
+type Limit struct {
+	// Rate is a number of tokens added per second
+	Rate float64
+	// Burst is a capacity of the bucket
+	Burst int
+}
+
+// Unlimited reports whether the limit allows everything
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// Result is an outcome of taking a token
+type Result struct {
+	Allowed bool
+	// Limit is a capacity of the bucket
+	Limit int
+	// Remaining is a number of tokens left in the bucket
+	Remaining int
+	// RetryAfter is a time till the next token, it is 0 if the token is taken
+	RetryAfter time.Duration
+	// Reset is a time till the bucket is full
+	Reset time.Duration
+}
+
+// Headers returns RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers of the result (draft-ietf-httpapi-ratelimit-headers) and Retry-After
+// if the request is rejected, times are rounded up to seconds
+func (r Result) Headers() http.Header {
+	h := http.Header{
+		"Ratelimit-Limit":     []string{strconv.Itoa(r.Limit)},
+		"Ratelimit-Remaining": []string{strconv.Itoa(r.Remaining)},
+		"Ratelimit-Reset":     []string{strconv.Itoa(ceilSeconds(r.Reset))},
+	}
+	if !r.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(r.RetryAfter)))
+	}
+	return h
+}
+
+// Limiter takes tokens of buckets by keys,
+// buckets of a distributed backend are shared by replicas
+type Limiter interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Budgets are limits of classes of endpoints
+type Budgets struct {
+	// Read limits reads of drivers and admin endpoints
+	Read Limit
+	// Import limits imports and updates of drivers
+	Import Limit
+	// IP limits every request of an IP before authentication,
+	// so guessing of credentials is limited too
+	IP Limit
+}
+
+// Classes of endpoints
+const (
+	ClassRead   = "read"
+	ClassImport = "import"
+	ClassIP     = "ip"
+)
+
+// For returns a limit of the class of endpoints
+func (b Budgets) For(class string) Limit {
+	switch class {
+	case ClassImport:
+		return b.Import
+	case ClassIP:
+		return b.IP
+	}
+	return b.Read
+}
+
+// validate reports invalid limits
+func (b Budgets) validate() error {
+	for class, l := range map[string]Limit{ClassRead: b.Read, ClassImport: b.Import, ClassIP: b.IP} {
+		if !l.Unlimited() && l.Burst < 1 {
+			return fmt.Errorf("burst of %s limit should be greater than 0, but not %d", class, l.Burst)
+		}
+	}
+	return nil
+}
+
+// AtomicBudgets holds a snapshot of Budgets, it is swapped atomically,
+// so the limits can be reloaded at runtime
+type AtomicBudgets struct {
+	p atomic.Pointer[Budgets]
+}
+
+// NewAtomicBudgets is a constructor of AtomicBudgets
+func NewAtomicBudgets(b Budgets) (*AtomicBudgets, error) {
+	ab := &AtomicBudgets{}
+	if err := ab.Store(b); err != nil {
+		return nil, err
+	}
+	return ab, nil
+}
+
+// Load returns the current snapshot
+func (ab *AtomicBudgets) Load() Budgets {
+	return *ab.p.Load()
+}
+
+// Store validates b and swaps the snapshot,
+// the snapshot is kept if b is invalid
+func (ab *AtomicBudgets) Store(b Budgets) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	ab.p.Store(&b)
+	return nil
+}
+
+// sweepInterval is an interval of removal of full buckets
+const sweepInterval = time.Minute
+
+// Memory is an in-process Limiter, buckets which
+// are full again are removed from time to time
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// MemoryOption sets an optional parameter of Memory
+type MemoryOption func(*Memory)
+
+// WithClock sets a clock of Memory, time.Now by default
+func WithClock(now func() time.Time) MemoryOption {
+	return func(m *Memory) { m.now = now }
+}
+
+// NewMemory is a constructor of Memory
+func NewMemory(opts ...MemoryOption) *Memory {
+	m := &Memory{buckets: make(map[string]*bucket), now: time.Now}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.lastSweep = m.now()
+	return m
+}
+
+// Take implements Limiter
+func (m *Memory) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	if limit.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	burst := float64(limit.Burst)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((burst - b.tokens) / limit.Rate)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep removes full buckets, they are equal to new ones
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Len returns a number of buckets kept
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.buckets)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,157 @@
+package ratelimit_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/ratelimit"
+)
+
+func TestMemory(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	limiter := ratelimit.NewMemory(ratelimit.WithClock(func() time.Time { return now }))
+	limit := ratelimit.Limit{Rate: 2, Burst: 3}
+
+	for _, tc := range []struct {
+		name      string
+		key       string
+		limit     ratelimit.Limit
+		advance   time.Duration
+		expResult string
+	}{
+		{
+			name:      "Full",
+			key:       "a",
+			limit:     limit,
+			expResult: "{true 3 2 0s 500ms}",
+		},
+		{
+			name:      "Burst",
+			key:       "a",
+			limit:     limit,
+			expResult: "{true 3 1 0s 1s}",
+		},
+		{
+			name:      "Last",
+			key:       "a",
+			limit:     limit,
+			expResult: "{true 3 0 0s 1.5s}",
+		},
+		{
+			name:      "Empty",
+			key:       "a",
+			limit:     limit,
+			expResult: "{false 3 0 500ms 1.5s}",
+		},
+		{
+			name:      "OtherKey",
+			key:       "b",
+			limit:     limit,
+			expResult: "{true 3 2 0s 500ms}",
+		},
+		{
+			name:      "Refilled",
+			key:       "a",
+			limit:     limit,
+			advance:   750 * time.Millisecond,
+			expResult: "{true 3 0 0s 1.25s}",
+		},
+		{
+			name:      "NotAboveBurst",
+			key:       "a",
+			limit:     limit,
+			advance:   time.Hour,
+			expResult: "{true 3 2 0s 500ms}",
+		},
+		{
+			name:      "Unlimited",
+			key:       "a",
+			expResult: "{true 0 0 0s 0s}",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.advance)
+
+			result, err := limiter.Take(context.Background(), tc.key, tc.limit)
+			if err != nil {
+				t.Error("Unexpected error =>", err)
+			}
+
+			t.Log("result =>", result)
+			if fmt.Sprint(result) != tc.expResult {
+				t.Error("Expected =>", tc.expResult)
+			}
+		})
+	}
+
+	// full buckets are removed
+	now = now.Add(time.Hour)
+	limiter.Take(context.Background(), "c", limit)
+	t.Log("limiter.Len() =>", limiter.Len())
+	if limiter.Len() != 1 {
+		t.Error("Expected =>", 1)
+	}
+}
+
+func TestResultHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		result     ratelimit.Result
+		expHeaders string
+	}{
+		{
+			name:       "Allowed",
+			result:     ratelimit.Result{Allowed: true, Limit: 10, Remaining: 9, Reset: 100 * time.Millisecond},
+			expHeaders: "map[Ratelimit-Limit:[10] Ratelimit-Remaining:[9] Ratelimit-Reset:[1]]",
+		},
+		{
+			name:       "Rejected",
+			result:     ratelimit.Result{Limit: 10, RetryAfter: 1500 * time.Millisecond, Reset: 10 * time.Second},
+			expHeaders: "map[Ratelimit-Limit:[10] Ratelimit-Remaining:[0] Ratelimit-Reset:[10] Retry-After:[2]]",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := tc.result.Headers()
+			t.Log("headers =>", headers)
+			if fmt.Sprint(headers) != tc.expHeaders {
+				t.Error("Expected =>", tc.expHeaders)
+			}
+		})
+	}
+}
+
+func TestAtomicBudgets(t *testing.T) {
+	budgets, err := ratelimit.NewAtomicBudgets(ratelimit.Budgets{
+		Read:   ratelimit.Limit{Rate: 10, Burst: 20},
+		Import: ratelimit.Limit{Rate: 1, Burst: 5},
+		IP:     ratelimit.Limit{Rate: 50, Burst: 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = budgets.Store(ratelimit.Budgets{IP: ratelimit.Limit{Rate: 1}})
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected an error of the zero burst of the ip budget")
+	}
+
+	err = budgets.Store(ratelimit.Budgets{Import: ratelimit.Limit{Rate: 1}})
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected an error of the zero burst")
+	}
+
+	t.Log("budgets.Load() =>", budgets.Load())
+	if budgets.Load().For(ratelimit.ClassImport) != (ratelimit.Limit{Rate: 1, Burst: 5}) {
+		t.Error("Expected the budgets to be kept")
+	}
+	if budgets.Load().For(ratelimit.ClassRead) != (ratelimit.Limit{Rate: 10, Burst: 20}) {
+		t.Error("Expected the read budget")
+	}
+	if budgets.Load().For(ratelimit.ClassIP) != (ratelimit.Limit{Rate: 50, Burst: 100}) {
+		t.Error("Expected the ip budget")
+	}
+}
@@ -0,0 +1,139 @@
+// Package redact masks personal data of drivers, license numbers and names,
+// in messages which leave the app: logs and error responses. Values are found
+// by their context (e.g. Postgres details of violated constraints, fields
+// of JSON and logfmt) and license numbers by their format.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Mask replaces redacted values
+const Mask = "***"
+
+// Redactor masks personal data in a message
+type Redactor interface {
+	Redact(message string) string
+}
+
+// Func is an adapter of a function to Redactor
+type Func func(message string) string
+
+// Redact implements Redactor
+func (f Func) Redact(message string) string {
+	return f(message)
+}
+
+// Nop is a Redactor which keeps messages as they are
+var Nop Redactor = Func(func(message string) string { return message })
+
+// Patterns is a Redactor masking matches of regular expressions,
+// if an expression has groups, only the groups are masked,
+// so the rest of the match is kept as a context
+type Patterns []*regexp.Regexp
+
+// fields are expressions of values of personal data in their context
+var fields = []string{
+	// Postgres details: Key (license_number)=(11-222-33) already exists.
+	`Key \([^)]*\)=\((.*)\)`,
+	// Postgres details: Failing row contains (1, John, 11-222-33).
+	`Failing row contains \((.*)\)`,
+	// JSON: "name":"John"
+	`"(?:name|license_number)"\s*:\s*"((?:[^"\\]|\\.)*)"`,
+	// logfmt: name="John Doe", license_number=11-222-33
+	`\b(?:name|license_number)=("(?:[^"\\]|\\.)*"|[^\s,;]+)`,
+	// validation errors: license_number field should match ..., but was 11-222-333
+	`field should match .*, but was (.*)`,
+}
+
+// New returns Patterns masking values of personal data in their context and
+// license numbers matching licenseNumberPattern (e.g. the validation rule),
+// anchors of the pattern (^ and $) are dropped to find numbers in messages
+func New(licenseNumberPattern string) (Patterns, error) {
+	p := make(Patterns, 0, len(fields)+1)
+	for _, field := range fields {
+		p = append(p, regexp.MustCompile(field))
+	}
+
+	licenseNumber := strings.TrimSuffix(strings.TrimPrefix(licenseNumberPattern, "^"), "$")
+	if licenseNumber == "" {
+		return p, nil
+	}
+	re, err := regexp.Compile("(?:" + licenseNumber + ")")
+	if err != nil {
+		return nil, fmt.Errorf("license number pattern: %v", err)
+	}
+	return append(p, re), nil
+}
+
+// Default masks license numbers of the default format, NN-NNN-NN
+var Default, _ = New(`^[0-9]{2}-[0-9]{3}-[0-9]{2}$`)
+
+// Redact implements Redactor
+func (p Patterns) Redact(message string) string {
+	for _, re := range p {
+		message = mask(re, message)
+	}
+	return message
+}
+
+// mask replaces matches of re in s, or their groups, with Mask
+func mask(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if len(m) == 2 {
+			m = append(m, m[0], m[1]) // no groups, the whole match is masked
+		}
+		for i := 2; i < len(m); i += 2 {
+			if m[i] < last {
+				continue // an unmatched or a nested group
+			}
+			b.WriteString(s[last:m[i]])
+			b.WriteString(Mask)
+			last = m[i+1]
+		}
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// NewLogger decorates the logger to redact values of records, strings
+// and errors are redacted, keys and values of other types (e.g. levels)
+// are kept as they are, so they still can be filtered
+func NewLogger(next log.Logger, r Redactor) log.Logger {
+	return &logger{next, r}
+}
+
+type logger struct {
+	next     log.Logger
+	redactor Redactor
+}
+
+// Log implements log.Logger
+func (l *logger) Log(keyvals ...interface{}) error {
+	redacted := make([]interface{}, len(keyvals))
+	for i, v := range keyvals {
+		if i%2 == 1 {
+			switch v := v.(type) {
+			case string:
+				redacted[i] = l.redactor.Redact(v)
+				continue
+			case error:
+				redacted[i] = l.redactor.Redact(v.Error())
+				continue
+			}
+		}
+		redacted[i] = v
+	}
+	return l.next.Log(redacted...)
+}
@@ -0,0 +1,121 @@
+package redact_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/konjoot/drivers-go-kit/src/drivers/redact"
+)
+
+func TestPatterns(t *testing.T) {
+	custom, err := redact.New(`^[A-Z]{2}[0-9]{6}$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		redactor redact.Redactor
+		message  string
+		expected string
+	}{
+		{
+			name:     "UniqueViolation",
+			redactor: redact.Default,
+			message:  "status=409, error=Key (license_number)=(11-222-33) already exists.",
+			expected: "status=409, error=Key (license_number)=(***) already exists.",
+		},
+		{
+			name:     "BlindIndex",
+			redactor: redact.Default,
+			message:  `Key (license_number_index)=(\x0102) already exists.`,
+			expected: "Key (license_number_index)=(***) already exists.",
+		},
+		{
+			name:     "CheckViolation",
+			redactor: redact.Default,
+			message:  "Failing row contains (1, John Smith, AB123456, null, null, 1).",
+			expected: "Failing row contains (***).",
+		},
+		{
+			name:     "JSON",
+			redactor: redact.Default,
+			message:  `panic: {"id":1,"name":"John \"Jack\" Smith","license_number":"AB123456"}`,
+			expected: `panic: {"id":1,"name":"***","license_number":"***"}`,
+		},
+		{
+			name:     "Logfmt",
+			redactor: redact.Default,
+			message:  `id=1 name="John Smith" license_number=AB123456 hostname=db`,
+			expected: `id=1 name=*** license_number=*** hostname=db`,
+		},
+		{
+			name:     "Validation",
+			redactor: redact.Default,
+			message:  "invalid format; license_number field should match ^[0-9]{2}-[0-9]{3}-[0-9]{2}$, but was 11-222-333",
+			expected: "invalid format; license_number field should match ^[0-9]{2}-[0-9]{3}-[0-9]{2}$, but was ***",
+		},
+		{
+			name:     "LicenseNumbers",
+			redactor: redact.Default,
+			message:  "drivers 11-222-33 and 11-222-34 are taken",
+			expected: "drivers *** and *** are taken",
+		},
+		{
+			name:     "CustomLicenseNumbers",
+			redactor: custom,
+			message:  "driver AB123456 is taken, 11-222-33 is not a license number",
+			expected: "driver *** is taken, 11-222-33 is not a license number",
+		},
+		{
+			name:     "NoPersonalData",
+			redactor: redact.Default,
+			message:  "driver with id=1 has been modified; its version is not 2",
+			expected: "driver with id=1 has been modified; its version is not 2",
+		},
+		{
+			name:     "Nop",
+			redactor: redact.Nop,
+			message:  "Key (license_number)=(11-222-33) already exists.",
+			expected: "Key (license_number)=(11-222-33) already exists.",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			redacted := tc.redactor.Redact(tc.message)
+			t.Log("redacted =>", redacted)
+			if redacted != tc.expected {
+				t.Error("Expected =>", tc.expected)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := redact.New("^[0-9")
+	t.Log("err =>", err)
+	if err == nil {
+		t.Error("Expected an error of the invalid pattern")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := level.NewFilter(log.NewLogfmtLogger(&buf), level.AllowWarn())
+	logger = redact.NewLogger(logger, redact.Default)
+
+	level.Info(logger).Log("err", "11-222-33")
+	level.Warn(logger).Log(
+		"err", errors.New("Key (license_number)=(11-222-33) already exists."),
+		"message", "driver 11-222-34",
+		"id", 1,
+	)
+
+	expected := "level=warn err=\"Key (license_number)=(***) already exists.\" message=\"driver ***\" id=1\n"
+	t.Log("logs =>", buf.String())
+	if buf.String() != expected {
+		t.Error("Expected =>", expected)
+	}
+}
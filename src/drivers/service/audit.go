@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+// AuditService is an interface for reading of audit events of drivers
+type AuditService interface {
+	Events(context.Context, store.AuditFilter) ([]*store.AuditEvent, error)
+}
+
+// NewAuditService is a constructor of AuditService
+func NewAuditService(db store.AuditStore) AuditService {
+	return &auditService{store: db}
+}
+
+// auditService is an implementation of AuditService interface
+type auditService struct {
+	store store.AuditStore
+}
+
+// Events provides main logic of paginated listing of audit events,
+// AfterID of the filter is an id of the last event from the previous page
+func (as *auditService) Events(ctx context.Context, filter store.AuditFilter) ([]*store.AuditEvent, error) {
+	if filter.Limit < MinPageSize || filter.Limit > MaxPageSize {
+		return nil, BadRequest(fmt.Errorf(ErrInvalidRangeTempl,
+			"limit", MinPageSize, MaxPageSize, filter.Limit),
+		)
+	}
+
+	events, err := as.store.ListAuditEvents(ctx, filter)
+	if err != nil {
+		return nil, InternalServerError(err)
+	}
+
+	return events, nil
+}
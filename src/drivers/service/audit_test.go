@@ -0,0 +1,79 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+)
+
+func TestAuditEvents(t *testing.T) {
+	since := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name        string
+		filter      store.AuditFilter
+		storeEvents []*store.AuditEvent
+		storeErr    error
+		expErr      error
+		expEvents   int
+	}{
+		{
+			name:        "Success",
+			filter:      store.AuditFilter{DriverID: 1, Since: since, Limit: 2},
+			storeEvents: []*store.AuditEvent{{ID: 1, DriverID: 1}, {ID: 3, DriverID: 1}},
+			expEvents:   2,
+		},
+		{
+			name:   "ErrLimitIsTooSmall",
+			filter: store.AuditFilter{Limit: 0},
+			expErr: service.BadRequest(errors.New("invalid value; limit should be from 1 to 1000, but not 0")),
+		},
+		{
+			name:   "ErrLimitIsTooBig",
+			filter: store.AuditFilter{Limit: 1001},
+			expErr: service.BadRequest(errors.New("invalid value; limit should be from 1 to 1000, but not 1001")),
+		},
+		{
+			name:     "ErrInternalServerError",
+			filter:   store.AuditFilter{Limit: 2},
+			storeErr: errors.New("internal"),
+			expErr:   service.InternalServerError(errors.New("internal")),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auditMock := &mockAudit{events: tc.storeEvents, err: tc.storeErr}
+			svc := service.NewAuditService(auditMock)
+
+			events, err := svc.Events(context.Background(), tc.filter)
+
+			t.Log("err =>", err)
+			if fmt.Sprint(err) != fmt.Sprint(tc.expErr) {
+				t.Error("Expected =>", tc.expErr)
+			}
+			t.Log("len(events) =>", len(events))
+			if len(events) != tc.expEvents {
+				t.Error("Expected =>", tc.expEvents)
+			}
+			if tc.expErr == nil && auditMock.filter != tc.filter {
+				t.Error("Expected the filter to be passed =>", tc.filter)
+			}
+		})
+	}
+}
+
+// mockAudit returns the events and records the filter
+type mockAudit struct {
+	events []*store.AuditEvent
+	err    error
+	filter store.AuditFilter
+}
+
+func (ma *mockAudit) ListAuditEvents(_ context.Context, filter store.AuditFilter) ([]*store.AuditEvent, error) {
+	ma.filter = filter
+	return ma.events, ma.err
+}
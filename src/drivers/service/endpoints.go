@@ -24,3 +24,76 @@ func MakeDriversGetByIDEndpoint(svc DriversService) endpoint.Endpoint {
 		return svc.GetByID(ctx, req.ID)
 	}
 }
+
+// MakeDriversListEndpoint connects router handler with
+// List method of DriversService
+func MakeDriversListEndpoint(svc DriversService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(driversListRequest)
+		drivers, err := svc.List(ctx, req.AfterID, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := DriversListResponse{Drivers: drivers, Limit: req.Limit}
+		if len(drivers) == req.Limit {
+			resp.NextAfterID = drivers[len(drivers)-1].ID
+		}
+		return resp, nil
+	}
+}
+
+// MakeDriversUpdateEndpoint connects router handler with
+// Update method of DriversService
+func MakeDriversUpdateEndpoint(svc DriversService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(driversUpdateRequest)
+		return svc.Update(ctx, req.Driver, req.IfVersion)
+	}
+}
+
+// MakeKeysCreateEndpoint connects router handler with
+// Create method of KeysService
+func MakeKeysCreateEndpoint(svc KeysService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(keysCreateRequest)
+		return svc.Create(ctx, req.Name, req.Scopes)
+	}
+}
+
+// MakeKeysRotateEndpoint connects router handler with
+// Rotate method of KeysService
+func MakeKeysRotateEndpoint(svc KeysService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(keysByIDRequest)
+		return svc.Rotate(ctx, req.ID)
+	}
+}
+
+// MakeKeysRevokeEndpoint connects router handler with
+// Revoke method of KeysService
+func MakeKeysRevokeEndpoint(svc KeysService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(keysByIDRequest)
+		err := svc.Revoke(ctx, req.ID)
+		return emptyResponse{}, err
+	}
+}
+
+// MakeAuditListEndpoint connects router handler with
+// Events method of AuditService
+func MakeAuditListEndpoint(svc AuditService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(auditListRequest)
+		events, err := svc.Events(ctx, req.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := AuditListResponse{Events: events, Filter: req.Filter}
+		if len(events) == req.Filter.Limit {
+			resp.NextAfterID = events[len(events)-1].ID
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/auth"
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+// Limits of a name of an API key
+const (
+	MinKeyNameLength = 1
+	MaxKeyNameLength = 100
+)
+
+// Plain errors of API keys
+var (
+	ErrNoScopes     = errors.New("invalid scopes; at least one scope is required")
+	ErrTenantsScope = errors.New("forbidden; keys with drivers:tenants scope are managed by clients with it")
+)
+
+// ErrUnknownScopeTempl is a template of an error of an unknown scope
+var ErrUnknownScopeTempl = "invalid scopes; %s is unknown, should be one of %v"
+
+// KeysService is an interface for management of API keys,
+// a plain key is returned only when it is created or rotated;
+// keys are managed within the tenant of ctx (see store.WithTenant)
+type KeysService interface {
+	Create(ctx context.Context, name string, scopes []string) (*IssuedKey, error)
+	Rotate(ctx context.Context, id uint64) (*IssuedKey, error)
+	Revoke(ctx context.Context, id uint64) error
+}
+
+// IssuedKey is an API key with its plain secret
+type IssuedKey struct {
+	*store.APIKey
+	Key string
+}
+
+// NewKeysService is a constructor of KeysService
+func NewKeysService(db store.APIKeysStore) KeysService {
+	return &keysService{store: db}
+}
+
+// keysService is an implementation of KeysService interface
+type keysService struct {
+	store store.APIKeysStore
+}
+
+// Create issues a new key with the scopes,
+// the key is bound to the tenant of ctx
+func (ks *keysService) Create(ctx context.Context, name string, scopes []string) (*IssuedKey, error) {
+	nameRunesLen := len([]rune(name))
+	if nameRunesLen < MinKeyNameLength || nameRunesLen > MaxKeyNameLength {
+		return nil, BadRequest(fmt.Errorf(ErrInvalidLengthTempl,
+			"name", MinKeyNameLength, MaxKeyNameLength, nameRunesLen))
+	}
+	if len(scopes) == 0 {
+		return nil, BadRequest(ErrNoScopes)
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return nil, BadRequest(fmt.Errorf(ErrUnknownScopeTempl, scope, auth.Scopes))
+		}
+	}
+	if err := checkManager(ctx, scopes); err != nil {
+		return nil, err
+	}
+
+	key, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, InternalServerError(err)
+	}
+
+	apiKey := &store.APIKey{Name: name, Hash: hash, Scopes: scopes}
+	if err = ks.store.CreateAPIKey(ctx, apiKey); err != nil {
+		return nil, InternalServerError(err)
+	}
+	return &IssuedKey{APIKey: apiKey, Key: key}, nil
+}
+
+// Rotate replaces the secret of a key, the previous one stops working at once
+func (ks *keysService) Rotate(ctx context.Context, id uint64) (*IssuedKey, error) {
+	if id == 0 {
+		return nil, BadRequest(ErrZeroID)
+	}
+	if err := ks.checkKeyManager(ctx, id); err != nil {
+		return nil, err
+	}
+
+	key, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, InternalServerError(err)
+	}
+
+	apiKey, err := ks.store.RotateAPIKey(ctx, id, hash)
+	if err == sql.ErrNoRows {
+		return nil, NotFound(fmt.Errorf(ErrNotFoundTempl, "api key", "id", id))
+	}
+	if err != nil {
+		return nil, InternalServerError(err)
+	}
+	return &IssuedKey{APIKey: apiKey, Key: key}, nil
+}
+
+// Revoke revokes a key, it can't be used anymore
+func (ks *keysService) Revoke(ctx context.Context, id uint64) error {
+	if id == 0 {
+		return BadRequest(ErrZeroID)
+	}
+	if err := ks.checkKeyManager(ctx, id); err != nil {
+		return err
+	}
+
+	err := ks.store.RevokeAPIKey(ctx, id)
+	if err == sql.ErrNoRows {
+		return NotFound(fmt.Errorf(ErrNotFoundTempl, "api key", "id", id))
+	}
+	if err != nil {
+		return InternalServerError(err)
+	}
+	return nil
+}
+
+// checkKeyManager checks the principal of ctx may manage the key
+// with the id by its scopes (see checkManager)
+func (ks *keysService) checkKeyManager(ctx context.Context, id uint64) error {
+	if _, ok := auth.FromContext(ctx); !ok {
+		return nil
+	}
+	apiKey, err := ks.store.GetAPIKey(ctx, id)
+	if err == sql.ErrNoRows {
+		return NotFound(fmt.Errorf(ErrNotFoundTempl, "api key", "id", id))
+	}
+	if err != nil {
+		return InternalServerError(err)
+	}
+	return checkManager(ctx, apiKey.Scopes)
+}
+
+// checkManager forbids management of keys with auth.ScopeTenants
+// to principals without it, otherwise an admin of a tenant could
+// issue a key of every tenant; there is no principal in ctx
+// of "keys" subcommand
+func checkManager(ctx context.Context, scopes []string) error {
+	principal, ok := auth.FromContext(ctx)
+	if !ok || principal.Allows(auth.ScopeTenants) {
+		return nil
+	}
+	for _, scope := range scopes {
+		if scope == auth.ScopeTenants {
+			return Forbidden(ErrTenantsScope)
+		}
+	}
+	return nil
+}
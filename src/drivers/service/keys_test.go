@@ -0,0 +1,232 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/konjoot/drivers-go-kit/src/drivers/auth"
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+)
+
+func TestKeysCreate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		keyName   string
+		scopes    []string
+		principal *auth.Principal
+		createErr error
+		expErr    error
+	}{
+		{
+			name:    "Success",
+			keyName: "importer",
+			scopes:  []string{auth.ScopeRead, auth.ScopeImport},
+		},
+		{
+			name:    "EmptyName",
+			keyName: "",
+			scopes:  []string{auth.ScopeRead},
+			expErr:  service.BadRequest(errors.New("invalid length; field name should be from 1 to 100 UTF-8 symbols, but not 0")),
+		},
+		{
+			name:    "TooLongName",
+			keyName: strings.Repeat("a", 101),
+			scopes:  []string{auth.ScopeRead},
+			expErr:  service.BadRequest(errors.New("invalid length; field name should be from 1 to 100 UTF-8 symbols, but not 101")),
+		},
+		{
+			name:    "NoScopes",
+			keyName: "importer",
+			expErr:  service.BadRequest(service.ErrNoScopes),
+		},
+		{
+			name:    "UnknownScope",
+			keyName: "importer",
+			scopes:  []string{"drivers:write"},
+			expErr:  service.BadRequest(errors.New("invalid scopes; drivers:write is unknown, should be one of [drivers:read drivers:import drivers:admin drivers:tenants]")),
+		},
+		{
+			name:      "AdminGrantsTenants",
+			keyName:   "operator",
+			scopes:    []string{auth.ScopeAdmin, auth.ScopeTenants},
+			principal: &auth.Principal{Subject: "apikey:1", Scopes: []string{auth.ScopeAdmin}},
+			expErr:    service.Forbidden(service.ErrTenantsScope),
+		},
+		{
+			name:      "OperatorGrantsTenants",
+			keyName:   "operator",
+			scopes:    []string{auth.ScopeAdmin, auth.ScopeTenants},
+			principal: &auth.Principal{Subject: "apikey:1", Scopes: []string{auth.ScopeAdmin, auth.ScopeTenants}},
+		},
+		{
+			name:    "CommandGrantsTenants",
+			keyName: "operator",
+			scopes:  []string{auth.ScopeTenants},
+		},
+		{
+			name:      "StoreFailure",
+			keyName:   "importer",
+			scopes:    []string{auth.ScopeRead},
+			createErr: errors.New("connection refused"),
+			expErr:    service.InternalServerError(errors.New("connection refused")),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			keysMock := &mockKeys{createErr: tc.createErr}
+			svc := service.NewKeysService(keysMock)
+
+			ctx := context.Background()
+			if tc.principal != nil {
+				ctx = auth.NewContext(ctx, *tc.principal)
+			}
+			issued, err := svc.Create(ctx, tc.keyName, tc.scopes)
+
+			t.Log("err =>", err)
+			if (err == nil) != (tc.expErr == nil) || (err != nil && err.Error() != tc.expErr.Error()) {
+				t.Error("Expected =>", tc.expErr)
+			}
+			if tc.expErr != nil {
+				return
+			}
+
+			t.Log("issued.Key =>", issued.Key)
+			if !strings.HasPrefix(issued.Key, auth.APIKeyPrefix) {
+				t.Error("Expected a key with prefix =>", auth.APIKeyPrefix)
+			}
+			if string(keysMock.created.Hash) != string(auth.HashAPIKey(issued.Key)) {
+				t.Error("Expected the hash of the key to be stored")
+			}
+		})
+	}
+}
+
+func TestKeysRotateRevoke(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		id           uint64
+		principal    *auth.Principal
+		keyScopes    []string
+		storeErr     error
+		expRotateErr error
+		expRevokeErr error
+	}{
+		{
+			name: "Success",
+			id:   1,
+		},
+		{
+			name:         "ZeroID",
+			expRotateErr: service.BadRequest(service.ErrZeroID),
+			expRevokeErr: service.BadRequest(service.ErrZeroID),
+		},
+		{
+			name:         "NotFound",
+			id:           2,
+			storeErr:     sql.ErrNoRows,
+			expRotateErr: service.NotFound(errors.New("api key with id=2 is not found")),
+			expRevokeErr: service.NotFound(errors.New("api key with id=2 is not found")),
+		},
+		{
+			name:         "StoreFailure",
+			id:           1,
+			storeErr:     errors.New("connection refused"),
+			expRotateErr: service.InternalServerError(errors.New("connection refused")),
+			expRevokeErr: service.InternalServerError(errors.New("connection refused")),
+		},
+		{
+			name:      "Admin",
+			id:        1,
+			principal: &auth.Principal{Subject: "apikey:1", Scopes: []string{auth.ScopeAdmin}},
+			keyScopes: []string{auth.ScopeRead},
+		},
+		{
+			name:         "AdminOfKeyWithTenants",
+			id:           1,
+			principal:    &auth.Principal{Subject: "apikey:1", Scopes: []string{auth.ScopeAdmin}},
+			keyScopes:    []string{auth.ScopeRead, auth.ScopeTenants},
+			expRotateErr: service.Forbidden(service.ErrTenantsScope),
+			expRevokeErr: service.Forbidden(service.ErrTenantsScope),
+		},
+		{
+			name:      "OperatorOfKeyWithTenants",
+			id:        1,
+			principal: &auth.Principal{Subject: "apikey:1", Scopes: []string{auth.ScopeAdmin, auth.ScopeTenants}},
+			keyScopes: []string{auth.ScopeRead, auth.ScopeTenants},
+		},
+		{
+			name:         "AdminOfUnknownKey",
+			id:           2,
+			principal:    &auth.Principal{Subject: "apikey:1", Scopes: []string{auth.ScopeAdmin}},
+			storeErr:     sql.ErrNoRows,
+			expRotateErr: service.NotFound(errors.New("api key with id=2 is not found")),
+			expRevokeErr: service.NotFound(errors.New("api key with id=2 is not found")),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := service.NewKeysService(&mockKeys{
+				scopes:    tc.keyScopes,
+				rotateErr: tc.storeErr,
+				revokeErr: tc.storeErr,
+			})
+			ctx := context.Background()
+			if tc.principal != nil {
+				ctx = auth.NewContext(ctx, *tc.principal)
+			}
+
+			issued, err := svc.Rotate(ctx, tc.id)
+			t.Log("rotate err =>", err)
+			if (err == nil) != (tc.expRotateErr == nil) || (err != nil && err.Error() != tc.expRotateErr.Error()) {
+				t.Error("Expected =>", tc.expRotateErr)
+			}
+			if err == nil && string(issued.Hash) != string(auth.HashAPIKey(issued.Key)) {
+				t.Error("Expected the hash of the new key to be stored")
+			}
+
+			err = svc.Revoke(ctx, tc.id)
+			t.Log("revoke err =>", err)
+			if (err == nil) != (tc.expRevokeErr == nil) || (err != nil && err.Error() != tc.expRevokeErr.Error()) {
+				t.Error("Expected =>", tc.expRevokeErr)
+			}
+		})
+	}
+}
+
+type mockKeys struct {
+	created   *store.APIKey
+	scopes    []string
+	createErr error
+	rotateErr error
+	revokeErr error
+}
+
+func (mk *mockKeys) CreateAPIKey(_ context.Context, key *store.APIKey) error {
+	key.ID = 1
+	mk.created = key
+	return mk.createErr
+}
+
+func (mk *mockKeys) GetAPIKey(_ context.Context, id uint64) (*store.APIKey, error) {
+	if mk.rotateErr != nil {
+		return nil, mk.rotateErr
+	}
+	return &store.APIKey{ID: id, Scopes: mk.scopes}, nil
+}
+
+func (mk *mockKeys) GetAPIKeyByHash(context.Context, []byte) (*store.APIKey, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (mk *mockKeys) RotateAPIKey(_ context.Context, id uint64, hash []byte) (*store.APIKey, error) {
+	if mk.rotateErr != nil {
+		return nil, mk.rotateErr
+	}
+	return &store.APIKey{ID: id, Hash: hash}, nil
+}
+
+func (mk *mockKeys) RevokeAPIKey(context.Context, uint64) error {
+	return mk.revokeErr
+}
@@ -14,9 +14,22 @@ import (
 
 // Plain errors
 var (
-	ErrDriverNotFound = errors.New("driver is not found")
-	ErrEmptySet       = errors.New("empty set")
-	ErrZeroID         = errors.New("invalid id; should be greater then 0")
+	ErrDriverNotFound     = errors.New("driver is not found")
+	ErrEmptySet           = errors.New("empty set")
+	ErrZeroID             = errors.New("invalid id; should be greater then 0")
+	ErrIDMismatch         = errors.New("invalid id; should be equal to the id in the path")
+	ErrInvalidIfMatch     = errors.New("invalid If-Match; should be a single entity tag or *")
+	ErrWeakETag           = errors.New("weak entity tag never matches in If-Match")
+	ErrUnknownETag        = errors.New("entity tag in If-Match is unknown")
+	ErrLicenseNumberTaken = errors.New("license number is taken by another driver")
+	ErrInvalidTenant      = errors.New("invalid tenant; should be up to 63 lowercase letters, digits, '-' or '_'")
+)
+
+// Limits of a page size for List
+const (
+	MinPageSize     = 1
+	MaxPageSize     = 1000
+	DefaultPageSize = 100
 )
 
 // Templates for errors with formatting
@@ -25,6 +38,10 @@ var (
 	ErrInvalidFormatTempl           = "invalid format; %s field should match %s, but was %s"
 	ErrNotFoundTempl                = "%s with %s=%d is not found"
 	ErrInvalidCollectionLengthTempl = "invalid collection length; collection %s should be from %d to %d elements, but not %d"
+	ErrInvalidRangeTempl            = "invalid value; %s should be from %d to %d, but not %d"
+	ErrVersionMismatchTempl         = "%s with %s=%d has been modified; its version is not %d"
+	ErrInvalidBodyTempl             = "invalid body; %w"
+	ErrBodyTooLargeTempl            = "body is too large; it should be up to %d bytes"
 )
 
 var regexpString = `^[0-9]{2}-[0-9]{3}-[0-9]{2}$`
@@ -34,37 +51,62 @@ var validLicenseNumber = regexp.MustCompile(regexpString)
 type DriversService interface {
 	Import(context.Context, []*store.Driver) error
 	GetByID(context.Context, uint64) (*store.Driver, error)
+	List(ctx context.Context, afterID uint64, limit int) ([]*store.Driver, error)
+	Update(ctx context.Context, driver *store.Driver, ifVersion uint64) (*store.Driver, error)
+}
+
+// Option is a functional option of DriversService
+type Option func(*driversService)
+
+// WithSettings sets a snapshot of rules which is read by every call,
+// DefaultSettings are used by default
+func WithSettings(settings *AtomicSettings) Option {
+	return func(drs *driversService) {
+		drs.settings = settings
+	}
 }
 
 // NewDriversService is a constructor of DriversService
-func NewDriversService(db store.DriversStore) DriversService {
-	return &driversService{store: db}
+func NewDriversService(db store.DriversStore, opts ...Option) DriversService {
+	drs := &driversService{store: db}
+	for _, opt := range opts {
+		opt(drs)
+	}
+	if drs.settings == nil {
+		drs.settings, _ = NewAtomicSettings(DefaultSettings())
+	}
+	return drs
 }
 
 // driversService is an implementation of DriversService interface
 type driversService struct {
-	store store.DriversStore
+	store    store.DriversStore
+	settings *AtomicSettings
 }
 
 // Import provides main logic of insertion of an array of drivers
 func (drs *driversService) Import(ctx context.Context, drivers []*store.Driver) error {
+	settings := drs.settings.Load()
 
 	driversLength := len(drivers)
-	if driversLength < 1 || driversLength > 1000 {
+	if driversLength < 1 || driversLength > settings.MaxImportSize {
 		return BadRequest(fmt.Errorf(ErrInvalidCollectionLengthTempl,
-			"drivers", 1, 1000, driversLength),
+			"drivers", 1, settings.MaxImportSize, driversLength),
 		)
 	}
 
 	for _, driver := range drivers {
-		if err := validateDriver(driver); err != nil {
+		if err := validateDriver(driver, settings); err != nil {
 			return BadRequest(err)
 		}
 	}
 
 	err := drs.store.UpsertBatch(ctx, drivers)
-	if e, ok := err.(*pq.Error); ok && e.Constraint == "drivers_license_number_key" {
-		return Conflict(fmt.Errorf(e.Detail))
+	if err == store.ErrDraining {
+		return ServiceUnavailable(err)
+	}
+	if conflict := licenseNumberConflict(err); conflict != nil {
+		return conflict
 	}
 	if err != nil {
 		return InternalServerError(err)
@@ -92,21 +134,62 @@ func (drs *driversService) GetByID(ctx context.Context, id uint64) (*store.Drive
 	return driver, nil
 }
 
-func validateDriver(driver *store.Driver) error {
+// List provides main logic of paginated listing of drivers,
+// afterID is an id of the last driver from the previous page
+func (drs *driversService) List(ctx context.Context, afterID uint64, limit int) ([]*store.Driver, error) {
+	if limit < MinPageSize || limit > MaxPageSize {
+		return nil, BadRequest(fmt.Errorf(ErrInvalidRangeTempl,
+			"limit", MinPageSize, MaxPageSize, limit),
+		)
+	}
+
+	drivers, err := drs.store.List(ctx, afterID, limit)
+	if err != nil {
+		return nil, InternalServerError(err)
+	}
+
+	return drivers, nil
+}
+
+// Update provides main logic of an update of a single driver,
+// if ifVersion is not 0 the driver is updated only if it has this version
+func (drs *driversService) Update(ctx context.Context, driver *store.Driver, ifVersion uint64) (*store.Driver, error) {
+	if err := validateDriver(driver, drs.settings.Load()); err != nil {
+		return nil, BadRequest(err)
+	}
+
+	err := drs.store.Update(ctx, driver, ifVersion)
+	if err == sql.ErrNoRows {
+		return nil, NotFound(fmt.Errorf(ErrNotFoundTempl, "driver", "id", driver.ID))
+	}
+	if err == store.ErrVersionMismatch {
+		return nil, PreconditionFailed(fmt.Errorf(ErrVersionMismatchTempl, "driver", "id", driver.ID, ifVersion))
+	}
+	if conflict := licenseNumberConflict(err); conflict != nil {
+		return nil, conflict
+	}
+	if err != nil {
+		return nil, InternalServerError(err)
+	}
+
+	return driver, nil
+}
+
+func validateDriver(driver *store.Driver, settings Settings) error {
 	if driver.ID == 0 {
 		return ErrZeroID
 	}
 
 	nameRunesLen := len([]rune(driver.Name))
-	if nameRunesLen < 4 || nameRunesLen > 1000 {
+	if nameRunesLen < settings.MinNameLength || nameRunesLen > settings.MaxNameLength {
 		return fmt.Errorf(ErrInvalidLengthTempl,
-			"name", 4, 1000, nameRunesLen)
+			"name", settings.MinNameLength, settings.MaxNameLength, nameRunesLen)
 	}
 
-	if !validLicenseNumber.MatchString(driver.LicenseNumber) {
+	if !settings.licenseNumber.MatchString(driver.LicenseNumber) {
 		return fmt.Errorf(ErrInvalidFormatTempl,
 			"license_number",
-			regexpString,
+			settings.LicenseNumberPattern,
 			driver.LicenseNumber,
 		)
 	}
@@ -123,16 +206,60 @@ func BadRequest(err error) error {
 	return &statusError{http.StatusBadRequest, err}
 }
 
+// Unauthorized is a shortcut for StatusError(http.StatusUnauthorized, err),
+// the challenge is sent in WWW-Authenticate header
+func Unauthorized(err error, challenge string) error {
+	return &challengeError{statusError{http.StatusUnauthorized, err}, challenge}
+}
+
+// Forbidden is a shortcut for StatusError(http.StatusForbidden, err)
+func Forbidden(err error) error {
+	return &statusError{http.StatusForbidden, err}
+}
+
 // NotFound is a shortcut for StatusError(http.StatusNotFound, err)
 func NotFound(err error) error {
 	return &statusError{http.StatusNotFound, err}
 }
 
+// licenseNumberConflict returns Conflict if err violates uniqueness of
+// license numbers, the detail of a violation of the blind index
+// of encrypted license numbers is meaningless, so it is not returned
+func licenseNumberConflict(err error) error {
+	e, ok := err.(*pq.Error)
+	if !ok {
+		return nil
+	}
+	switch e.Constraint {
+	case "drivers_license_number_key":
+		return Conflict(errors.New(e.Detail))
+	case "drivers_license_number_index_key":
+		return Conflict(ErrLicenseNumberTaken)
+	}
+	return nil
+}
+
 // Conflict is a shortcut for StatusError(http.StatusConflict, err)
 func Conflict(err error) error {
 	return &statusError{http.StatusConflict, err}
 }
 
+// PreconditionFailed is a shortcut for StatusError(http.StatusPreconditionFailed, err)
+func PreconditionFailed(err error) error {
+	return &statusError{http.StatusPreconditionFailed, err}
+}
+
+// TooManyRequests is a shortcut for StatusError(http.StatusTooManyRequests, err),
+// the headers (e.g. Retry-After) are sent with the response
+func TooManyRequests(err error, headers http.Header) error {
+	return &headersError{statusError{http.StatusTooManyRequests, err}, headers}
+}
+
+// ServiceUnavailable is a shortcut for StatusError(http.StatusServiceUnavailable, err)
+func ServiceUnavailable(err error) error {
+	return &statusError{http.StatusServiceUnavailable, err}
+}
+
 // InternalServerError is a shortcut for StatusError(http.StatusInternalServerError, err)
 func InternalServerError(err error) error {
 	return &statusError{http.StatusInternalServerError, err}
@@ -153,3 +280,27 @@ func (se *statusError) Error() string {
 func (se *statusError) Status() int {
 	return se.status
 }
+
+func (se *statusError) Unwrap() error {
+	return se.err
+}
+
+type challengeError struct {
+	statusError
+	challenge string
+}
+
+// Headers implements httptransport.Headerer
+func (ce *challengeError) Headers() http.Header {
+	return http.Header{"Www-Authenticate": []string{ce.challenge}}
+}
+
+type headersError struct {
+	statusError
+	headers http.Header
+}
+
+// Headers implements httptransport.Headerer
+func (he *headersError) Headers() http.Header {
+	return he.headers
+}
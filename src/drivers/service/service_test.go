@@ -104,6 +104,21 @@ func TestDriversImport(t *testing.T) {
 			},
 			expErr: service.Conflict(errors.New("detail")),
 		},
+		{
+			name: "UniqIndexConstraintViolation",
+			drivers: []*store.Driver{
+				{
+					ID:            1,
+					Name:          "John",
+					LicenseNumber: "11-222-33",
+				},
+			},
+			importErr: &pq.Error{
+				Constraint: "drivers_license_number_index_key",
+				Detail:     `Key (license_number_index)=(\x0102) already exists.`,
+			},
+			expErr: service.Conflict(service.ErrLicenseNumberTaken),
+		},
 		{
 			name: "InternalServerError",
 			drivers: []*store.Driver{
@@ -116,6 +131,18 @@ func TestDriversImport(t *testing.T) {
 			importErr: errors.New("internal"),
 			expErr:    service.InternalServerError(errors.New("internal")),
 		},
+		{
+			name: "Draining",
+			drivers: []*store.Driver{
+				{
+					ID:            1,
+					Name:          "John",
+					LicenseNumber: "11-222-33",
+				},
+			},
+			importErr: store.ErrDraining,
+			expErr:    service.ServiceUnavailable(store.ErrDraining),
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			dbMock = &mockStore{importErr: tc.importErr}
@@ -191,6 +218,228 @@ func TestDriversGetByID(t *testing.T) {
 	}
 }
 
+func TestDriversList(t *testing.T) {
+	var (
+		drivers []*store.Driver
+		err     error
+		srv     service.DriversService
+		dbMock  *mockStore
+	)
+
+	for _, tc := range []struct {
+		name         string
+		limit        int
+		storeDrivers []*store.Driver
+		storeErr     error
+		expErr       error
+		expDrivers   []*store.Driver
+	}{
+		{
+			name:         "Success",
+			limit:        2,
+			storeDrivers: []*store.Driver{{ID: 1}, {ID: 2}},
+			expDrivers:   []*store.Driver{{ID: 1}, {ID: 2}},
+		},
+		{
+			name:   "ErrLimitIsTooSmall",
+			limit:  0,
+			expErr: service.BadRequest(errors.New("invalid value; limit should be from 1 to 1000, but not 0")),
+		},
+		{
+			name:   "ErrLimitIsTooBig",
+			limit:  1001,
+			expErr: service.BadRequest(errors.New("invalid value; limit should be from 1 to 1000, but not 1001")),
+		},
+		{
+			name:     "ErrInternalServerError",
+			limit:    2,
+			storeErr: errors.New("internal"),
+			expErr:   service.InternalServerError(errors.New("internal")),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dbMock = &mockStore{
+				listDrivers: tc.storeDrivers,
+				listErr:     tc.storeErr,
+			}
+			srv = service.NewDriversService(dbMock)
+			drivers, err = srv.List(context.Background(), 0, tc.limit)
+			t.Log("err =>", err)
+			if fmt.Sprint(err) != fmt.Sprint(tc.expErr) {
+				t.Error("Expected =>", tc.expErr)
+			}
+			t.Log("len(drivers) =>", len(drivers))
+			if len(drivers) != len(tc.expDrivers) {
+				t.Error("Expected =>", len(tc.expDrivers))
+				t.FailNow()
+			}
+			for i, driver := range drivers {
+				t.Log("driver =>", driver)
+				if fmt.Sprint(driver) != fmt.Sprint(tc.expDrivers[i]) {
+					t.Error("Expected =>", tc.expDrivers[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDriversUpdate(t *testing.T) {
+	var (
+		driver *store.Driver
+		err    error
+		srv    service.DriversService
+		dbMock *mockStore
+	)
+
+	for _, tc := range []struct {
+		name      string
+		driver    *store.Driver
+		ifVersion uint64
+		updateErr error
+		expErr    error
+		expDriver *store.Driver
+	}{
+		{
+			name:      "Success",
+			driver:    &store.Driver{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+			ifVersion: 1,
+			expDriver: &store.Driver{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+		},
+		{
+			name:   "InvalidDriver",
+			driver: &store.Driver{ID: 1, Name: "jo", LicenseNumber: "11-222-33"},
+			expErr: service.BadRequest(errors.New("invalid length; field name should be from 4 to 1000 UTF-8 symbols, but not 2")),
+		},
+		{
+			name:      "ErrNotFound",
+			driver:    &store.Driver{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+			updateErr: sql.ErrNoRows,
+			expErr:    service.NotFound(errors.New("driver with id=1 is not found")),
+		},
+		{
+			name:      "ErrVersionMismatch",
+			driver:    &store.Driver{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+			ifVersion: 2,
+			updateErr: store.ErrVersionMismatch,
+			expErr:    service.PreconditionFailed(errors.New("driver with id=1 has been modified; its version is not 2")),
+		},
+		{
+			name:   "UniqConstraintViolation",
+			driver: &store.Driver{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+			updateErr: &pq.Error{
+				Constraint: "drivers_license_number_key",
+				Detail:     "detail",
+			},
+			expErr: service.Conflict(errors.New("detail")),
+		},
+		{
+			name:   "UniqIndexConstraintViolation",
+			driver: &store.Driver{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+			updateErr: &pq.Error{
+				Constraint: "drivers_license_number_index_key",
+				Detail:     `Key (license_number_index)=(\x0102) already exists.`,
+			},
+			expErr: service.Conflict(service.ErrLicenseNumberTaken),
+		},
+		{
+			name:      "ErrInternalServerError",
+			driver:    &store.Driver{ID: 1, Name: "John", LicenseNumber: "11-222-33"},
+			updateErr: errors.New("internal"),
+			expErr:    service.InternalServerError(errors.New("internal")),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dbMock = &mockStore{updateErr: tc.updateErr}
+			srv = service.NewDriversService(dbMock)
+			driver, err = srv.Update(context.Background(), tc.driver, tc.ifVersion)
+			t.Log("err =>", err)
+			if fmt.Sprint(err) != fmt.Sprint(tc.expErr) {
+				t.Error("Expected =>", tc.expErr)
+			}
+			t.Log("driver =>", driver)
+			if fmt.Sprint(driver) != fmt.Sprint(tc.expDriver) {
+				t.Error("Expected =>", tc.expDriver)
+			}
+		})
+	}
+}
+
+func TestDriversImportSettings(t *testing.T) {
+	settings, err := service.NewAtomicSettings(service.DefaultSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := service.NewDriversService(&mockStore{}, service.WithSettings(settings))
+
+	drivers := []*store.Driver{
+		{ID: 1, Name: "Joe", LicenseNumber: "AB-1234"},
+		{ID: 2, Name: "Jack", LicenseNumber: "CD-5678"},
+	}
+
+	err = srv.Import(context.Background(), drivers)
+	t.Log("err with default settings =>", err)
+	if fmt.Sprint(err) != "status=400, error=invalid length; field name should be from 4 to 1000 UTF-8 symbols, but not 3" {
+		t.Error("Expected =>", "status=400, error=invalid length; field name should be from 4 to 1000 UTF-8 symbols, but not 3")
+	}
+
+	for _, tc := range []struct {
+		name     string
+		settings service.Settings
+		expErr   string
+	}{
+		{
+			name: "InvalidPattern",
+			settings: service.Settings{
+				MaxImportSize:        1,
+				MinNameLength:        3,
+				MaxNameLength:        100,
+				LicenseNumberPattern: "^[A-Z{2}$",
+			},
+			expErr: "invalid license number pattern: error parsing regexp: missing closing ]: `[A-Z{2}$`",
+		},
+		{
+			name: "InvalidNameLength",
+			settings: service.Settings{
+				MaxImportSize:        1,
+				MinNameLength:        100,
+				MaxNameLength:        3,
+				LicenseNumberPattern: "^[A-Z]{2}-[0-9]{4}$",
+			},
+			expErr: "name length should be from 1 to max name length 3, but not 100",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := settings.Store(tc.settings)
+			t.Log("err =>", err)
+			if fmt.Sprint(err) != tc.expErr {
+				t.Error("Expected =>", tc.expErr)
+			}
+		})
+	}
+
+	err = settings.Store(service.Settings{
+		MaxImportSize:        1,
+		MinNameLength:        3,
+		MaxNameLength:        100,
+		LicenseNumberPattern: "^[A-Z]{2}-[0-9]{4}$",
+	})
+	if err != nil {
+		t.Error("Unexpected error =>", err)
+	}
+
+	err = srv.Import(context.Background(), drivers)
+	t.Log("err with reloaded settings =>", err)
+	if fmt.Sprint(err) != "status=400, error=invalid collection length; collection drivers should be from 1 to 1 elements, but not 2" {
+		t.Error("Expected =>", "status=400, error=invalid collection length; collection drivers should be from 1 to 1 elements, but not 2")
+	}
+
+	err = srv.Import(context.Background(), drivers[:1])
+	t.Log("err with reloaded settings =>", err)
+	if err != nil {
+		t.Error("Expected =>", nil)
+	}
+}
+
 type mockStore struct {
 	store.DriversStore
 
@@ -198,6 +447,11 @@ type mockStore struct {
 	getByIDErr    error
 
 	importErr error
+
+	listDrivers []*store.Driver
+	listErr     error
+
+	updateErr error
 }
 
 func (ms *mockStore) GetByID(context.Context, uint64) (*store.Driver, error) {
@@ -207,3 +461,11 @@ func (ms *mockStore) GetByID(context.Context, uint64) (*store.Driver, error) {
 func (ms *mockStore) UpsertBatch(context.Context, []*store.Driver) error {
 	return ms.importErr
 }
+
+func (ms *mockStore) List(context.Context, uint64, int) ([]*store.Driver, error) {
+	return ms.listDrivers, ms.listErr
+}
+
+func (ms *mockStore) Update(context.Context, *store.Driver, uint64) error {
+	return ms.updateErr
+}
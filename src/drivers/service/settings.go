@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// Settings are rules of DriversService which can be changed at runtime
+type Settings struct {
+	// MaxImportSize limits a number of drivers in an import
+	MaxImportSize int
+	// MinNameLength and MaxNameLength limit a name of a driver in UTF-8 symbols
+	MinNameLength int
+	MaxNameLength int
+	// LicenseNumberPattern is a regular expression of valid license numbers
+	LicenseNumberPattern string
+
+	licenseNumber *regexp.Regexp
+}
+
+// DefaultSettings returns rules of DriversService used by default
+func DefaultSettings() Settings {
+	return Settings{
+		MaxImportSize:        1000,
+		MinNameLength:        4,
+		MaxNameLength:        1000,
+		LicenseNumberPattern: regexpString,
+		licenseNumber:        validLicenseNumber,
+	}
+}
+
+// compile validates s and compiles its pattern
+func (s *Settings) compile() error {
+	if s.MaxImportSize < 1 {
+		return fmt.Errorf("max import size should be greater than 0, but not %d", s.MaxImportSize)
+	}
+	if s.MinNameLength < 1 || s.MinNameLength > s.MaxNameLength {
+		return fmt.Errorf("name length should be from 1 to max name length %d, but not %d",
+			s.MaxNameLength, s.MinNameLength)
+	}
+
+	licenseNumber, err := regexp.Compile(s.LicenseNumberPattern)
+	if err != nil {
+		return fmt.Errorf("invalid license number pattern: %v", err)
+	}
+	s.licenseNumber = licenseNumber
+	return nil
+}
+
+// AtomicSettings holds a snapshot of Settings, it is swapped atomically,
+// so the service reads consistent rules while they are being reloaded
+type AtomicSettings struct {
+	p atomic.Pointer[Settings]
+}
+
+// NewAtomicSettings is a constructor of AtomicSettings
+func NewAtomicSettings(s Settings) (*AtomicSettings, error) {
+	as := &AtomicSettings{}
+	if err := as.Store(s); err != nil {
+		return nil, err
+	}
+	return as, nil
+}
+
+// Load returns the current snapshot
+func (as *AtomicSettings) Load() Settings {
+	return *as.p.Load()
+}
+
+// Store validates s and swaps the snapshot,
+// the snapshot is kept if s is invalid
+func (as *AtomicSettings) Store(s Settings) error {
+	if err := s.compile(); err != nil {
+		return err
+	}
+	as.p.Store(&s)
+	return nil
+}
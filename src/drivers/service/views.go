@@ -2,12 +2,17 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/konjoot/drivers-go-kit/src/drivers/codec"
+	"github.com/konjoot/drivers-go-kit/src/drivers/compress"
 	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
 )
 
@@ -15,32 +20,227 @@ type driversGetByIDRequest struct {
 	ID uint64 `json:"id"`
 }
 
-// DecodeDriversGetByIDRequest is a request decoder for GetByID endpoint
+// DecodeDriversGetByIDRequest is a request decoder for GetByID endpoint of API v1
 func DecodeDriversGetByIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
-	vars := mux.Vars(r)
-	idString, ok := vars["id"]
+	id, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+	return driversGetByIDRequest{ID: id}, nil
+}
+
+// pathID returns the id from the path of the request
+func pathID(r *http.Request) (uint64, error) {
+	idString, ok := mux.Vars(r)["id"]
 	if !ok {
-		return nil, errors.New("Bad routing")
+		return 0, errors.New("Bad routing")
 	}
 
-	id, err := strconv.Atoi(idString)
+	id, err := strconv.ParseUint(idString, 10, 64)
 	if err != nil {
-		return nil, err
+		return 0, BadRequest(fmt.Errorf(ErrInvalidFormatTempl, "id", "uint64", idString))
 	}
-	return driversGetByIDRequest{ID: uint64(id)}, nil
+	return id, nil
 }
 
 type driversImportRequest struct {
 	Drivers []*store.Driver
 }
 
-// DecodeDriversImportRequest is a request decoder for Import endpoint
-func DecodeDriversImportRequest(_ context.Context, r *http.Request) (interface{}, error) {
+// DecodeDriversImportRequest is a request decoder for Import endpoint of API v1,
+// the body is decoded by a codec chosen by Content-Type header
+func DecodeDriversImportRequest(ctx context.Context, r *http.Request) (interface{}, error) {
 	var request driversImportRequest
-	if err := json.NewDecoder(r.Body).Decode(&request.Drivers); err != nil {
+	if err := decodeBody(ctx, r, &request.Drivers); err != nil {
 		return nil, err
 	}
 	return request, nil
 }
 
-type emptyResponse struct{}
+// decodeBody decodes the body by a codec chosen by Content-Type header,
+// a malformed body is a bad request, a body over the limit
+// of http.MaxBytesReader is too large, compressed bodies are
+// unsupported unless they are decompressed by a middleware
+func decodeBody(ctx context.Context, r *http.Request, v interface{}) error {
+	if enc := r.Header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		return StatusError(http.StatusUnsupportedMediaType, compress.ErrUnsupportedEncoding)
+	}
+
+	c, err := codec.FromContext(ctx).Lookup(r.Header.Get("Content-Type"))
+	if err != nil {
+		return StatusError(http.StatusUnsupportedMediaType, err)
+	}
+
+	err = c.Decode(r.Body, v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &tooLarge):
+		return StatusError(http.StatusRequestEntityTooLarge, fmt.Errorf(ErrBodyTooLargeTempl, tooLarge.Limit))
+	case err == codec.ErrUnsupportedType:
+		return StatusError(http.StatusUnsupportedMediaType, err)
+	}
+	return BadRequest(fmt.Errorf(ErrInvalidBodyTempl, err))
+}
+
+type auditListRequest struct {
+	Filter store.AuditFilter
+}
+
+// DecodeAuditListRequest is a request decoder for audit List endpoint of API v1,
+// it reads "driver_id", "since" (RFC 3339), "after" and "limit" query parameters
+func DecodeAuditListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	filter, err := decodeAuditFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	return auditListRequest{Filter: filter}, nil
+}
+
+// decodeAuditFilter reads a filter of audit events from query parameters
+func decodeAuditFilter(r *http.Request) (store.AuditFilter, error) {
+	afterID, limit, err := decodePage(r)
+	if err != nil {
+		return store.AuditFilter{}, err
+	}
+	filter := store.AuditFilter{AfterID: afterID, Limit: limit}
+	query := r.URL.Query()
+
+	if driverID := query.Get("driver_id"); driverID != "" {
+		id, err := strconv.ParseUint(driverID, 10, 64)
+		if err != nil {
+			return filter, BadRequest(fmt.Errorf(ErrInvalidFormatTempl, "driver_id", "uint64", driverID))
+		}
+		filter.DriverID = id
+	}
+
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, BadRequest(fmt.Errorf(ErrInvalidFormatTempl, "since", "RFC 3339 date-time", since))
+		}
+		filter.Since = t
+	}
+
+	return filter, nil
+}
+
+// decodePage reads "after" and "limit" query parameters of a listing
+func decodePage(r *http.Request) (afterID uint64, limit int, err error) {
+	limit = DefaultPageSize
+	query := r.URL.Query()
+
+	if after := query.Get("after"); after != "" {
+		if afterID, err = strconv.ParseUint(after, 10, 64); err != nil {
+			return 0, 0, BadRequest(fmt.Errorf(ErrInvalidFormatTempl, "after", "uint64", after))
+		}
+	}
+
+	if l := query.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil {
+			return 0, 0, BadRequest(fmt.Errorf(ErrInvalidFormatTempl, "limit", "int", l))
+		}
+	}
+
+	return afterID, limit, nil
+}
+
+type keysCreateRequest struct {
+	XMLName xml.Name `json:"-" xml:"api_key"`
+	Name    string   `json:"name" xml:"name"`
+	Scopes  []string `json:"scopes" xml:"scopes>scope"`
+}
+
+// DecodeKeysCreateRequest is a request decoder for Create endpoint of API keys,
+// the body is decoded by a codec chosen by Content-Type header
+func DecodeKeysCreateRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var request keysCreateRequest
+	if err := decodeBody(ctx, r, &request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type keysByIDRequest struct {
+	ID uint64
+}
+
+// DecodeKeysByIDRequest is a request decoder for Rotate and Revoke
+// endpoints of API keys, the id is taken from the path
+func DecodeKeysByIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+	return keysByIDRequest{ID: id}, nil
+}
+
+// ETag returns an entity tag of a driver's version in a representation
+// (e.g. "json-gzip"), so representations of a version have distinct tags
+func ETag(version uint64, representation string) string {
+	return `"` + strconv.FormatUint(version, 10) + "-" + representation + `"`
+}
+
+// ETagMatches reports whether the value of If-None-Match header
+// matches the entity tag, entity tags are compared weakly
+func ETagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIfMatch returns a version from the value of If-Match header,
+// 0 means there is no condition, weak entity tags never match,
+// an entity tag of any representation of the version matches
+func parseIfMatch(ifMatch string) (uint64, error) {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, nil
+	}
+	if strings.HasPrefix(ifMatch, "W/") {
+		return 0, PreconditionFailed(ErrWeakETag)
+	}
+
+	if len(ifMatch) < 3 || ifMatch[0] != '"' || ifMatch[len(ifMatch)-1] != '"' {
+		return 0, BadRequest(ErrInvalidIfMatch)
+	}
+	tag := ifMatch[1 : len(ifMatch)-1]
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		tag = tag[:i]
+	}
+	version, err := strconv.ParseUint(tag, 10, 64)
+	if err != nil || version == 0 {
+		return 0, PreconditionFailed(ErrUnknownETag)
+	}
+	return version, nil
+}
+
+type emptyResponse struct {
+	XMLName xml.Name `json:"-" xml:"response"`
+}
+
+// MarshalProto implements codec.ProtoMarshaler, emptyResponse is an Empty message
+func (emptyResponse) MarshalProto() ([]byte, error) {
+	return nil, nil
+}
+
+// DriversListResponse is a page of drivers returned by List endpoint,
+// NextAfterID is a cursor for the next page, it is 0 for the last page
+type DriversListResponse struct {
+	Drivers     []*store.Driver
+	Limit       int
+	NextAfterID uint64
+}
+
+// AuditListResponse is a page of audit events returned by audit List endpoint,
+// NextAfterID is a cursor for the next page, it is 0 for the last page
+type AuditListResponse struct {
+	Events      []*store.AuditEvent
+	Filter      store.AuditFilter
+	NextAfterID uint64
+}
@@ -0,0 +1,103 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+)
+
+// fuzzMaxBodyBytes is a body limit of fuzzed requests, so 413 is fuzzed too
+const fuzzMaxBodyBytes = 1 << 10
+
+var bodySeeds = []struct {
+	contentType string
+	body        string
+}{
+	{"", `[{"id":1,"name":"John","license_number":"11-222-33"}]`},
+	{"application/json", `[{"id":1,"name":"John","license_number":"11-222-33","age":30}]`},
+	{"application/json", `[{"id":"1"},{"id":-1},{"name":5}]`},
+	{"application/json", `{"id":1,"name":"John","license_number":"11-222-33"}`},
+	{"application/json", `[] []`},
+	{"application/json", `[{"id":1}`},
+	{"application/json", `null`},
+	{"application/msgpack", "\x91\x83\xa2id\x01\xa4name\xa4John\xaelicense_number\xa911-222-33"},
+	{"application/msgpack", "\xdd\xff\xff\xff\xff"},
+	{"application/protobuf", "\x0a\x0f\x08\x01\x12\x04John\x1a\x0511-22"},
+	{"application/xml", `<drivers><driver><id>1</id><name>John</name></driver></drivers>`},
+	{"application/xml", `<driver><id>1</id></driver><driver/>`},
+	{"text/plain", `id=1`},
+}
+
+func FuzzDecodeDriversImportRequest(f *testing.F) {
+	for _, seed := range bodySeeds {
+		f.Add(seed.contentType, seed.body)
+	}
+
+	f.Fuzz(func(t *testing.T, contentType, body string) {
+		r := httptest.NewRequest("POST", "/api/import", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r.Body = http.MaxBytesReader(nil, r.Body, fuzzMaxBodyBytes)
+
+		_, err := service.DecodeDriversImportRequest(context.Background(), r)
+		checkDecodeError(t, err)
+	})
+}
+
+func FuzzDecodeV2DriversImportRequest(f *testing.F) {
+	for _, seed := range bodySeeds {
+		f.Add(seed.contentType, seed.body)
+	}
+
+	f.Fuzz(func(t *testing.T, contentType, body string) {
+		r := httptest.NewRequest("POST", "/api/v2/import", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r.Body = http.MaxBytesReader(nil, r.Body, fuzzMaxBodyBytes)
+
+		_, err := service.DecodeV2DriversImportRequest(context.Background(), r)
+		checkDecodeError(t, err)
+	})
+}
+
+func FuzzDecodeV2DriversUpdateRequest(f *testing.F) {
+	for _, seed := range bodySeeds {
+		f.Add("1", `"1"`, seed.contentType, seed.body)
+	}
+	f.Add("abc", "*", "", `{"id":1}`)
+	f.Add("1", `W/"1"`, "", `{"id":2}`)
+
+	f.Fuzz(func(t *testing.T, id, ifMatch, contentType, body string) {
+		r := httptest.NewRequest("PUT", "/api/v2/drivers/1", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("If-Match", ifMatch)
+		r.Body = http.MaxBytesReader(nil, r.Body, fuzzMaxBodyBytes)
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+
+		_, err := service.DecodeV2DriversUpdateRequest(context.Background(), r)
+		checkDecodeError(t, err)
+	})
+}
+
+// checkDecodeError fails if a decoder fails with a server error,
+// every malformed request is a client's fault
+func checkDecodeError(t *testing.T, err error) {
+	if err == nil {
+		return
+	}
+
+	var statuser interface{ Status() int }
+	if !errors.As(err, &statuser) {
+		t.Fatal("Expected a status error =>", err)
+	}
+	switch statuser.Status() {
+	case http.StatusBadRequest, http.StatusPreconditionFailed,
+		http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+	default:
+		t.Fatal("Unexpected status =>", statuser.Status(), err)
+	}
+}
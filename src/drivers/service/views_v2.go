@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+)
+
+// decoders of API v2 are kept apart from v1 ones,
+// so the versions may evolve independently
+
+// DecodeV2DriversGetByIDRequest is a request decoder for GetByID endpoint of API v2
+func DecodeV2DriversGetByIDRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+	return driversGetByIDRequest{ID: id}, nil
+}
+
+// DecodeV2DriversImportRequest is a request decoder for Import endpoint of API v2,
+// the body is decoded by a codec chosen by Content-Type header
+func DecodeV2DriversImportRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var request driversImportRequest
+	if err := decodeBody(ctx, r, &request.Drivers); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type driversListRequest struct {
+	AfterID uint64
+	Limit   int
+}
+
+// DecodeV2DriversListRequest is a request decoder for List endpoint of API v2,
+// it reads "after" and "limit" query parameters
+func DecodeV2DriversListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	afterID, limit, err := decodePage(r)
+	if err != nil {
+		return nil, err
+	}
+	return driversListRequest{AfterID: afterID, Limit: limit}, nil
+}
+
+// DecodeV2AuditListRequest is a request decoder for audit List endpoint of API v2,
+// it reads "driver_id", "since" (RFC 3339), "after" and "limit" query parameters
+func DecodeV2AuditListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	filter, err := decodeAuditFilter(r)
+	if err != nil {
+		return nil, err
+	}
+	return auditListRequest{Filter: filter}, nil
+}
+
+type driversUpdateRequest struct {
+	Driver    *store.Driver
+	IfVersion uint64
+}
+
+// DecodeV2DriversUpdateRequest is a request decoder for Update endpoint of API v2,
+// the id is taken from the path, the body is decoded by a codec chosen
+// by Content-Type header and a version condition is taken from If-Match header
+func DecodeV2DriversUpdateRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ifVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		return nil, err
+	}
+
+	driver := &store.Driver{}
+	if err := decodeBody(ctx, r, driver); err != nil {
+		return nil, err
+	}
+	if driver.ID != 0 && driver.ID != id {
+		return nil, BadRequest(ErrIDMismatch)
+	}
+	driver.ID = id
+
+	return driversUpdateRequest{Driver: driver, IfVersion: ifVersion}, nil
+}
@@ -0,0 +1,431 @@
+package drivers
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/konjoot/drivers-go-kit/src/drivers/auth"
+	"github.com/konjoot/drivers-go-kit/src/drivers/codec"
+	store "github.com/konjoot/drivers-go-kit/src/drivers/datastore"
+	"github.com/konjoot/drivers-go-kit/src/drivers/service"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// makeV2Router registers handlers of API v2 in the router
+func makeV2Router(router *mux.Router, svc service.DriversService, o options) {
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(encodeV2Error),
+		httptransport.ServerErrorHandler(logErrorHandler{}),
+		httptransport.ServerBefore(auth.HTTPToContext(), httptransport.PopulateRequestContext, populateClientIP(o.trustedProxies), populateTenant, populateRateLimit),
+		httptransport.ServerAfter(writeRateLimit),
+	}
+	middleware := func(name, scope string) endpoint.Middleware {
+		return endpoint.Chain(
+			tracingMiddleware("v2."+name, o.tracer),
+			instrumentingMiddleware("v2."+name, o.metrics),
+			ipRateLimitMiddleware(o.limiter, o.budgets),
+			authMiddleware(o.authn, scope),
+			tenantMiddleware(),
+			actorMiddleware(),
+			rateLimitMiddleware(o.limiter, o.budgets, scope),
+			logRecoverMiddleware(),
+		)
+	}
+	handler := func(next http.Handler) http.Handler {
+		return &negotiationMiddleware{
+			srv:              next,
+			codecs:           o.codecs,
+			encodings:        o.encodings,
+			compressMinBytes: o.compressMinBytes,
+			encodeError:      encodeV2Error,
+		}
+	}
+
+	router.Methods("POST").Path("/import").Handler(handler(&decompressionMiddleware{
+		srv: httptransport.NewServer(
+			middleware("import", auth.ScopeImport)(service.MakeDriversImportEndpoint(svc)),
+			service.DecodeV2DriversImportRequest,
+			encodeV2Response,
+			options...,
+		),
+		limit: o.maxDecompressedBytes,
+	}))
+	router.Methods("GET").Path("/drivers").Handler(handler(httptransport.NewServer(
+		middleware("list", auth.ScopeRead)(service.MakeDriversListEndpoint(svc)),
+		service.DecodeV2DriversListRequest,
+		encodeV2Response,
+		options...,
+	)))
+	router.Methods("GET").Path("/drivers/{id}").Handler(handler(httptransport.NewServer(
+		middleware("get_by_id", auth.ScopeRead)(service.MakeDriversGetByIDEndpoint(svc)),
+		service.DecodeV2DriversGetByIDRequest,
+		encodeV2Response,
+		append(options, httptransport.ServerBefore(populateIfNoneMatch))...,
+	)))
+	router.Methods("PUT").Path("/drivers/{id}").Handler(handler(httptransport.NewServer(
+		middleware("update", auth.ScopeImport)(service.MakeDriversUpdateEndpoint(svc)),
+		service.DecodeV2DriversUpdateRequest,
+		encodeV2Response,
+		options...,
+	)))
+
+	if o.audit != nil {
+		router.Methods("GET").Path("/audit").Handler(handler(httptransport.NewServer(
+			middleware("audit", auth.ScopeAdmin)(service.MakeAuditListEndpoint(service.NewAuditService(o.audit))),
+			service.DecodeV2AuditListRequest,
+			encodeV2Response,
+			options...,
+		)))
+	}
+
+	// management of API keys makes sense only if they are authenticated
+	if o.apiKeys != nil && o.authn != nil {
+		keys := service.NewKeysService(o.apiKeys)
+		router.Methods("POST").Path("/keys").Handler(handler(httptransport.NewServer(
+			middleware("create_key", auth.ScopeAdmin)(service.MakeKeysCreateEndpoint(keys)),
+			service.DecodeKeysCreateRequest,
+			encodeV2Response,
+			options...,
+		)))
+		router.Methods("POST").Path("/keys/{id}/rotate").Handler(handler(httptransport.NewServer(
+			middleware("rotate_key", auth.ScopeAdmin)(service.MakeKeysRotateEndpoint(keys)),
+			service.DecodeKeysByIDRequest,
+			encodeV2Response,
+			options...,
+		)))
+		router.Methods("DELETE").Path("/keys/{id}").Handler(handler(httptransport.NewServer(
+			middleware("revoke_key", auth.ScopeAdmin)(service.MakeKeysRevokeEndpoint(keys)),
+			service.DecodeKeysByIDRequest,
+			encodeV2Response,
+			options...,
+		)))
+	}
+
+	router.NotFoundHandler = errorHandler{ErrHandlerNotFound, encodeV2Error}
+	router.MethodNotAllowedHandler = errorHandler{ErrMethodNotAllowed, encodeV2Error}
+}
+
+// driverV2 is a v2 representation of a driver
+type driverV2 struct {
+	XMLName       xml.Name `json:"-" xml:"driver"`
+	ID            uint64   `json:"id" xml:"id"`
+	Name          string   `json:"name" xml:"name"`
+	LicenseNumber string   `json:"license_number" xml:"license_number"`
+	Links         linksV2  `json:"links" xml:"links"`
+}
+
+// MarshalProto implements codec.ProtoMarshaler, driverV2 is a Driver message
+func (d driverV2) MarshalProto() ([]byte, error) {
+	return codec.AppendProtoDriver(nil, &store.Driver{
+		ID:            d.ID,
+		Name:          d.Name,
+		LicenseNumber: d.LicenseNumber,
+	}, d.Links.Self), nil
+}
+
+// driversPageV2 is a v2 representation of a page of drivers
+type driversPageV2 struct {
+	XMLName xml.Name   `json:"-" xml:"drivers"`
+	Data    []driverV2 `json:"data" xml:"driver"`
+	Links   linksV2    `json:"links" xml:"links"`
+}
+
+// MarshalProto implements codec.ProtoMarshaler, driversPageV2 is a DriversPage message
+func (p driversPageV2) MarshalProto() ([]byte, error) {
+	var b []byte
+	for _, driver := range p.Data {
+		m, _ := driver.MarshalProto()
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	if p.Links.Next != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, codec.AppendProtoString(nil, 2, p.Links.Next))
+	}
+	return b, nil
+}
+
+type linksV2 struct {
+	Self string `json:"self,omitempty" xml:"self,omitempty"`
+	Next string `json:"next,omitempty" xml:"next,omitempty"`
+}
+
+// auditEventV2 is a v2 representation of an audit event
+type auditEventV2 struct {
+	XMLName   xml.Name       `json:"-" xml:"audit_event"`
+	ID        uint64         `json:"id" xml:"id"`
+	DriverID  uint64         `json:"driver_id" xml:"driver_id"`
+	Operation string         `json:"operation" xml:"operation"`
+	Actor     string         `json:"actor" xml:"actor"`
+	RequestID string         `json:"request_id" xml:"request_id"`
+	SourceIP  string         `json:"source_ip" xml:"source_ip"`
+	Before    *auditValuesV2 `json:"before" xml:"before,omitempty"`
+	After     *auditValuesV2 `json:"after" xml:"after"`
+	CreatedAt string         `json:"created_at" xml:"created_at"`
+}
+
+type auditValuesV2 struct {
+	Name          string `json:"name" xml:"name"`
+	LicenseNumber string `json:"license_number" xml:"license_number"`
+}
+
+// appendProto appends an AuditValues message as the field num, nil values are absent
+func (v *auditValuesV2) appendProto(b []byte, num protowire.Number) []byte {
+	if v == nil {
+		return b
+	}
+	m := codec.AppendProtoString(nil, 1, v.Name)
+	m = codec.AppendProtoString(m, 2, v.LicenseNumber)
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// MarshalProto implements codec.ProtoMarshaler, auditEventV2 is an AuditEvent message
+func (e auditEventV2) MarshalProto() ([]byte, error) {
+	b := protowire.AppendTag(nil, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, e.ID)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, e.DriverID)
+	b = codec.AppendProtoString(b, 3, e.Operation)
+	b = codec.AppendProtoString(b, 4, e.Actor)
+	b = codec.AppendProtoString(b, 5, e.RequestID)
+	b = codec.AppendProtoString(b, 6, e.SourceIP)
+	b = e.Before.appendProto(b, 7)
+	b = e.After.appendProto(b, 8)
+	return codec.AppendProtoString(b, 9, e.CreatedAt), nil
+}
+
+// auditPageV2 is a v2 representation of a page of audit events
+type auditPageV2 struct {
+	XMLName xml.Name       `json:"-" xml:"audit_events"`
+	Data    []auditEventV2 `json:"data" xml:"audit_event"`
+	Links   linksV2        `json:"links" xml:"links"`
+}
+
+// MarshalProto implements codec.ProtoMarshaler, auditPageV2 is an AuditPage message
+func (p auditPageV2) MarshalProto() ([]byte, error) {
+	var b []byte
+	for _, event := range p.Data {
+		m, _ := event.MarshalProto()
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	if p.Links.Next != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, codec.AppendProtoString(nil, 2, p.Links.Next))
+	}
+	return b, nil
+}
+
+func newAuditEventV2(event *store.AuditEvent) auditEventV2 {
+	values := func(v *store.AuditValues) *auditValuesV2 {
+		if v == nil {
+			return nil
+		}
+		return &auditValuesV2{Name: v.Name, LicenseNumber: v.LicenseNumber}
+	}
+	return auditEventV2{
+		ID:        event.ID,
+		DriverID:  event.DriverID,
+		Operation: event.Operation,
+		Actor:     event.Actor,
+		RequestID: event.RequestID,
+		SourceIP:  event.SourceIP,
+		Before:    values(event.Before),
+		After:     values(event.After),
+		CreatedAt: event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// newAuditPageV2 returns a representation of the page, the link
+// to the next page keeps the path of the request and the filter
+func newAuditPageV2(ctx context.Context, resp service.AuditListResponse) auditPageV2 {
+	page := auditPageV2{Data: make([]auditEventV2, 0, len(resp.Events))}
+	for _, event := range resp.Events {
+		page.Data = append(page.Data, newAuditEventV2(event))
+	}
+	if resp.NextAfterID != 0 {
+		query := url.Values{}
+		if resp.Filter.DriverID != 0 {
+			query.Set("driver_id", strconv.FormatUint(resp.Filter.DriverID, 10))
+		}
+		if !resp.Filter.Since.IsZero() {
+			query.Set("since", resp.Filter.Since.Format(time.RFC3339Nano))
+		}
+		query.Set("after", strconv.FormatUint(resp.NextAfterID, 10))
+		query.Set("limit", strconv.Itoa(resp.Filter.Limit))
+		path, _ := ctx.Value(httptransport.ContextKeyRequestPath).(string)
+		page.Links.Next = path + "?" + query.Encode()
+	}
+	return page
+}
+
+// problemV2 is an error representation of v2 (RFC 7807)
+type problemV2 struct {
+	XMLName xml.Name `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type    string   `json:"type" xml:"type"`
+	Title   string   `json:"title" xml:"title"`
+	Status  int      `json:"status" xml:"status"`
+	Detail  string   `json:"detail,omitempty" xml:"detail,omitempty"`
+	// RequestID is an extension member to correlate the problem with logs
+	RequestID string `json:"request_id,omitempty" xml:"request_id,omitempty"`
+	// Path is an extension member with a JSON path of an invalid value of a request body
+	Path string `json:"path,omitempty" xml:"path,omitempty"`
+}
+
+// MarshalProto implements codec.ProtoMarshaler, problemV2 is a Problem message
+func (p problemV2) MarshalProto() ([]byte, error) {
+	b := codec.AppendProtoString(nil, 1, p.Type)
+	b = codec.AppendProtoString(b, 2, p.Title)
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(p.Status))
+	b = codec.AppendProtoString(b, 4, p.Detail)
+	b = codec.AppendProtoString(b, 5, p.RequestID)
+	return codec.AppendProtoString(b, 6, p.Path), nil
+}
+
+// keyV2 is a v2 representation of an API key,
+// the plain key is present only when it is created or rotated
+type keyV2 struct {
+	XMLName   xml.Name `json:"-" xml:"api_key"`
+	ID        uint64   `json:"id" xml:"id"`
+	Name      string   `json:"name" xml:"name"`
+	Scopes    []string `json:"scopes" xml:"scopes>scope"`
+	Tenant    string   `json:"tenant,omitempty" xml:"tenant,omitempty"`
+	Key       string   `json:"key" xml:"key"`
+	CreatedAt string   `json:"created_at" xml:"created_at"`
+	RotatedAt string   `json:"rotated_at,omitempty" xml:"rotated_at,omitempty"`
+
+	status int
+}
+
+// StatusCode implements httptransport.StatusCoder
+func (k keyV2) StatusCode() int {
+	return k.status
+}
+
+// MarshalProto implements codec.ProtoMarshaler, keyV2 is an ApiKey message
+func (k keyV2) MarshalProto() ([]byte, error) {
+	b := protowire.AppendTag(nil, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, k.ID)
+	b = codec.AppendProtoString(b, 2, k.Name)
+	for _, scope := range k.Scopes {
+		b = codec.AppendProtoString(b, 3, scope)
+	}
+	b = codec.AppendProtoString(b, 4, k.Key)
+	b = codec.AppendProtoString(b, 5, k.CreatedAt)
+	b = codec.AppendProtoString(b, 6, k.RotatedAt)
+	return codec.AppendProtoString(b, 7, k.Tenant), nil
+}
+
+// newKeyV2 returns a representation of the issued key,
+// a key which has never been rotated is just created
+func newKeyV2(key *service.IssuedKey) keyV2 {
+	k := keyV2{
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		Tenant:    key.Tenant,
+		Key:       key.Key,
+		CreatedAt: key.CreatedAt.UTC().Format(time.RFC3339),
+		status:    http.StatusCreated,
+	}
+	if !key.RotatedAt.IsZero() {
+		k.RotatedAt = key.RotatedAt.UTC().Format(time.RFC3339)
+		k.status = http.StatusOK
+	}
+	return k
+}
+
+func newDriverV2(driver *store.Driver) driverV2 {
+	return driverV2{
+		ID:            driver.ID,
+		Name:          driver.Name,
+		LicenseNumber: driver.LicenseNumber,
+		Links: linksV2{
+			Self: fmt.Sprintf("/api/v2/drivers/%d", driver.ID),
+		},
+	}
+}
+
+// encodeV2Response encodes the response with the codec negotiated by Accept header
+func encodeV2Response(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	switch resp := response.(type) {
+	case *store.Driver:
+		if writeValidators(ctx, w, resp) {
+			return nil
+		}
+		response = newDriverV2(resp)
+	case service.DriversListResponse:
+		page := driversPageV2{Data: make([]driverV2, 0, len(resp.Drivers))}
+		for _, driver := range resp.Drivers {
+			page.Data = append(page.Data, newDriverV2(driver))
+		}
+		if resp.NextAfterID != 0 {
+			page.Links.Next = fmt.Sprintf("/api/v2/drivers?after=%d&limit=%d",
+				resp.NextAfterID, resp.Limit)
+		}
+		response = page
+	case *service.IssuedKey:
+		response = newKeyV2(resp)
+	case service.AuditListResponse:
+		response = newAuditPageV2(ctx, resp)
+	}
+
+	status := http.StatusOK
+	if sc, ok := response.(httptransport.StatusCoder); ok {
+		status = sc.StatusCode()
+	}
+
+	c := codec.Accepted(ctx)
+	w.Header().Set("Content-Type", c.ContentType())
+	return writeBody(ctx, w, status, c, response)
+}
+
+// encodeV2Error encodes the error as a problem,
+// JSON and XML problems have their own media types
+func encodeV2Error(ctx context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeV2Error with nil error")
+	}
+
+	status := codeFrom(err)
+	detail := err.Error()
+	if cause := errors.Unwrap(err); cause != nil {
+		detail = cause.Error()
+	}
+
+	var path string
+	var decodeErr *codec.DecodeError
+	if errors.As(err, &decodeErr) {
+		path = decodeErr.Path
+	}
+
+	c := codec.Accepted(ctx)
+	switch c {
+	case codec.JSON, codec.StrictJSON:
+		w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+	case codec.XML:
+		w.Header().Set("Content-Type", "application/problem+xml; charset=utf-8")
+	default:
+		w.Header().Set("Content-Type", c.ContentType())
+	}
+	writeErrorHeaders(w, err)
+	writeBody(ctx, w, status, c, problemV2{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    errorRedactorFrom(ctx).Redact(detail),
+		RequestID: requestIDFrom(ctx),
+		Path:      path,
+	})
+}